@@ -0,0 +1,302 @@
+package drc
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// how colors are composited onto the framebuffer, the porter-duff
+// operators come first followed by the separable blend modes which
+// composite like source over with the colors mixed by the mode
+const (
+	BLEND_SRC_OVER = iota
+	BLEND_CLEAR
+	BLEND_SRC
+	BLEND_DST
+	BLEND_DST_OVER
+	BLEND_SRC_IN
+	BLEND_DST_IN
+	BLEND_SRC_OUT
+	BLEND_DST_OUT
+	BLEND_SRC_ATOP
+	BLEND_DST_ATOP
+	BLEND_XOR
+	BLEND_ADD
+
+	BLEND_MULTIPLY
+	BLEND_SCREEN
+	BLEND_OVERLAY
+	BLEND_DARKEN
+	BLEND_LIGHTEN
+	BLEND_COLOR_DODGE
+	BLEND_COLOR_BURN
+	BLEND_HARD_LIGHT
+	BLEND_SOFT_LIGHT
+	BLEND_DIFFERENCE
+	BLEND_EXCLUSION
+)
+
+// clip is the region drawing is limited to, the mask
+// scales the coverage of the pixels inside the rectangle,
+// the paths made the mask and are kept in pixels for export
+type clip struct {
+	rect  image.Rectangle
+	mask  *image.Alpha
+	paths []clipPath
+}
+
+type clipPath struct {
+	path *Path
+	rule int
+}
+
+// layer is a framebuffer that was replaced by an offscreen
+// one and what to composite the offscreen one back with
+type layer struct {
+	dst     *image.RGBA
+	opacity float64
+	blend   int
+}
+
+func (c *Context) SetBlend(mode int) {
+	s := &c.styles[len(c.styles)-1]
+	s.Blend = mode
+}
+
+// ClipRect limits drawing to the pixels inside the rectangle
+// and the current clip, it is restored by Restore
+func (c *Context) ClipRect(r image.Rectangle) {
+	cl := &c.clips[len(c.clips)-1]
+	cl.rect = cl.rect.Intersect(r)
+}
+
+// ClipPath limits drawing to the inside of the path and the
+// current clip, the path is transformed by the current matrix
+// and filled with the fill rule of the style, the edges of the
+// clip are anti-aliased unless the style says otherwise
+func (c *Context) ClipPath(p *Path) {
+	s := &c.styles[len(c.styles)-1]
+	m := c.transforms[len(c.transforms)-1]
+	cl := &c.clips[len(c.clips)-1]
+
+	mask := image.NewAlpha(cl.rect)
+	lo, hi := cl.rect.Max, cl.rect.Min
+	imageutil.RasterizePath(p.flatten(&m), s.FillRule, cl.rect, func(x, y int, a float64) {
+		if s.NoSmooth {
+			if a < 0.5 {
+				return
+			}
+			a = 1
+		}
+		if cl.mask != nil {
+			a *= float64(cl.mask.AlphaAt(x, y).A) / 255
+		}
+		if v := f64.Clamp8(a*255, 0, 255); v != 0 {
+			mask.SetAlpha(x, y, color.Alpha{v})
+			lo.X, lo.Y = min(lo.X, x), min(lo.Y, y)
+			hi.X, hi.Y = max(hi.X, x+1), max(hi.Y, y+1)
+		}
+	})
+	cl.rect = image.Rectangle{lo, hi}.Intersect(cl.rect)
+	cl.mask = mask
+	cl.paths = append(cl.paths[:len(cl.paths):len(cl.paths)], clipPath{p.transform(&m), s.FillRule})
+}
+
+// BeginLayer redirects drawing to a transparent offscreen layer
+// until EndLayer composites it back with the opacity and the blend
+// mode of the style, layers nest
+func (c *Context) BeginLayer(opacity float64) {
+	if c.record(command{op: CMD_BEGIN_LAYER, args: [6]float64{opacity}}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	c.layers = append(c.layers, layer{c.framebuffer, opacity, s.Blend})
+	c.framebuffer = image.NewRGBA(c.drawRect())
+}
+
+func (c *Context) EndLayer() {
+	if c.record(command{op: CMD_END_LAYER}) {
+		return
+	}
+
+	n := len(c.layers) - 1
+	if n < 0 {
+		return
+	}
+	l := c.layers[n]
+	c.layers = c.layers[:n]
+
+	src := c.framebuffer
+	c.framebuffer = l.dst
+	r := src.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			p := src.Pix[i : i+4 : i+4]
+			if p[3] == 0 && l.blend == BLEND_SRC_OVER {
+				continue
+			}
+			j := l.dst.PixOffset(x, y)
+			d := l.dst.Pix[j : j+4 : j+4]
+			composite(d, color.RGBA{p[0], p[1], p[2], p[3]}, l.opacity, l.blend)
+		}
+	}
+}
+
+// drawRect is the part of the framebuffer drawing can touch
+func (c *Context) drawRect() image.Rectangle {
+	return c.clips[len(c.clips)-1].rect.Intersect(c.framebuffer.Bounds())
+}
+
+// blend composites the color with the pixel scaled by the
+// coverage after the depth test and the clip
+func (c *Context) blend(x, y int, z float64, col color.RGBA, cov float64) {
+	fb := c.framebuffer
+	r := c.bounds
+	cl := &c.clips[len(c.clips)-1]
+	if !image.Pt(x, y).In(cl.rect) || !image.Pt(x, y).In(fb.Rect) {
+		return
+	}
+	if cl.mask != nil {
+		cov *= float64(cl.mask.AlphaAt(x, y).A) / 255
+	}
+
+	n := (y-r.Min.Y)*r.Dx() + x - r.Min.X
+	if cov <= 0 || z > c.zbuffer[n] {
+		return
+	}
+	c.zbuffer[n] = z
+
+	s := &c.styles[len(c.styles)-1]
+	i := fb.PixOffset(x, y)
+	composite(fb.Pix[i:i+4:i+4], col, math.Min(cov, 1), s.Blend)
+}
+
+// composite blends the premultiplied source over the destination
+// pixel with the mode, the coverage fades between the destination
+// and the result so operators like source do not clear what is
+// outside of the shape
+func composite(d []uint8, col color.RGBA, cov float64, mode int) {
+	if mode == BLEND_SRC_OVER {
+		t := 1 - float64(col.A)*cov/255
+		d[0] = f64.Clamp8(float64(col.R)*cov+float64(d[0])*t, 0, 255)
+		d[1] = f64.Clamp8(float64(col.G)*cov+float64(d[1])*t, 0, 255)
+		d[2] = f64.Clamp8(float64(col.B)*cov+float64(d[2])*t, 0, 255)
+		d[3] = f64.Clamp8(float64(col.A)*cov+float64(d[3])*t, 0, 255)
+		return
+	}
+
+	s := [4]float64{float64(col.R) / 255, float64(col.G) / 255, float64(col.B) / 255, float64(col.A) / 255}
+	b := [4]float64{float64(d[0]) / 255, float64(d[1]) / 255, float64(d[2]) / 255, float64(d[3]) / 255}
+	as, ab := s[3], b[3]
+
+	// fractions of the source and destination kept
+	var fa, fb float64
+	var o [4]float64
+	switch mode {
+	case BLEND_CLEAR:
+	case BLEND_SRC:
+		fa = 1
+	case BLEND_DST:
+		fb = 1
+	case BLEND_DST_OVER:
+		fa, fb = 1-ab, 1
+	case BLEND_SRC_IN:
+		fa = ab
+	case BLEND_DST_IN:
+		fb = as
+	case BLEND_SRC_OUT:
+		fa = 1 - ab
+	case BLEND_DST_OUT:
+		fb = 1 - as
+	case BLEND_SRC_ATOP:
+		fa, fb = ab, 1-as
+	case BLEND_DST_ATOP:
+		fa, fb = 1-ab, as
+	case BLEND_XOR:
+		fa, fb = 1-ab, 1-as
+	case BLEND_ADD:
+		fa, fb = 1, 1
+	default:
+		// the straight colors are mixed where both are present
+		// and each keeps its own color where the other is not
+		for i := 0; i < 3; i++ {
+			cs, cb := unpremul(s[i], as), unpremul(b[i], ab)
+			o[i] = s[i]*(1-ab) + b[i]*(1-as) + as*ab*blendChannel(cs, cb, mode)
+		}
+		o[3] = as + ab*(1-as)
+	}
+	if mode < BLEND_MULTIPLY {
+		for i := range o {
+			o[i] = s[i]*fa + b[i]*fb
+		}
+	}
+
+	for i := range o {
+		d[i] = f64.Clamp8(f64.Lerp(cov, b[i], o[i])*255, 0, 255)
+	}
+}
+
+func unpremul(c, a float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return math.Min(c/a, 1)
+}
+
+// blendChannel mixes the straight source and backdrop
+// channels with a separable blend mode
+func blendChannel(cs, cb float64, mode int) float64 {
+	switch mode {
+	case BLEND_MULTIPLY:
+		return cs * cb
+	case BLEND_SCREEN:
+		return cs + cb - cs*cb
+	case BLEND_OVERLAY:
+		return blendChannel(cb, cs, BLEND_HARD_LIGHT)
+	case BLEND_DARKEN:
+		return math.Min(cs, cb)
+	case BLEND_LIGHTEN:
+		return math.Max(cs, cb)
+	case BLEND_COLOR_DODGE:
+		switch {
+		case cb == 0:
+			return 0
+		case cs >= 1:
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case BLEND_COLOR_BURN:
+		switch {
+		case cb >= 1:
+			return 1
+		case cs <= 0:
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case BLEND_HARD_LIGHT:
+		if cs <= 0.5 {
+			return cb * 2 * cs
+		}
+		return blendChannel(2*cs-1, cb, BLEND_SCREEN)
+	case BLEND_SOFT_LIGHT:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		d := math.Sqrt(cb)
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		}
+		return cb + (2*cs-1)*(d-cb)
+	case BLEND_DIFFERENCE:
+		return math.Abs(cs - cb)
+	case BLEND_EXCLUSION:
+		return cs + cb - 2*cs*cb
+	}
+	return cs
+}
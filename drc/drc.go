@@ -14,6 +14,32 @@ type Context struct {
 	transforms  []f64.Mat4
 	styles      []Style
 	zbuffer     []float64
+	clips       []clip
+	layers      []layer
+
+	// bounds of the framebuffer the context was made with,
+	// the z-buffer covers it while layers may be smaller
+	bounds image.Rectangle
+
+	// drawing is recorded instead of drawn while deferred,
+	// a tile limits replaying the commands to part of the image
+	deferred bool
+	commands []command
+	tile     *image.Rectangle
+	tileSize int
+
+	// bounds of the layers begun while deferred
+	layerBounds []image.Rectangle
+
+	// commands are also kept here while recording
+	recording *Recording
+
+	// once a projection is set the transforms
+	// are model matrices in the vertex pipeline
+	projected  bool
+	projection f64.Mat4
+	view       f64.Mat4
+	viewport   image.Rectangle
 }
 
 type Style struct {
@@ -24,6 +50,40 @@ type Style struct {
 	Fill       color.RGBA
 	NoFill     bool
 	NoStroke   bool
+
+	// how paths are filled and stroked
+	FillRule   int
+	LineJoin   int
+	LineCap    int
+	MiterLimit float64
+	Dash       []float64
+	DashOffset float64
+
+	// draw paths without anti-aliasing
+	NoSmooth bool
+
+	// how colors are composited onto the framebuffer
+	Blend int
+
+	// font and size of text in pixels, nil is the default font,
+	// the leading is the distance between lines, zero uses the
+	// line height of the font
+	Font         *Font
+	TextSize     float64
+	TextAlign    int
+	TextBaseline int
+	Leading      float64
+
+	// texture sampled by triangles, nil is solid white
+	Texture *Texture
+
+	// which faces of triangles are dropped
+	Cull int
+
+	// computes the color of a fragment of a triangle,
+	// returning false discards the fragment, nil uses
+	// the vertex color times the texture
+	Shader func(f *Fragment) bool
 }
 
 func New(framebuffer *image.RGBA) *Context {
@@ -34,9 +94,14 @@ func New(framebuffer *image.RGBA) *Context {
 
 	c := &Context{}
 	c.framebuffer = framebuffer
+	c.bounds = r
 	c.transforms = append(c.transforms, M)
 	c.styles = append(c.styles, c.defaultStyle())
 	c.zbuffer = make([]float64, r.Dx()*r.Dy())
+	c.clips = append(c.clips, clip{rect: r})
+	c.projection = M
+	c.view = M
+	c.viewport = r
 	c.Clear()
 	return c
 }
@@ -92,6 +157,11 @@ func (c *Context) NoStroke() {
 	s.NoStroke = true
 }
 
+func (c *Context) NoFill() {
+	s := &c.styles[len(c.styles)-1]
+	s.NoFill = true
+}
+
 func (c *Context) SetLineWidth(lw float64) {
 	s := &c.styles[len(c.styles)-1]
 	s.LineWidth = lw
@@ -113,13 +183,20 @@ func (c *Context) LineWidth() float64 {
 }
 
 func (c *Context) pixel(x, y int, z float64, col color.RGBA) {
-	fb := c.framebuffer
-	r := fb.Bounds()
-	n := y*r.Dx() + x
-	if 0 <= n && n < len(c.zbuffer) && z <= c.zbuffer[n] {
-		c.zbuffer[n] = z
-		fb.SetRGBA(x, y, col)
+	c.blend(x, y, z, col, 1)
+}
+
+// coverPixel blends the color with its alpha scaled
+// by how much of the pixel is covered
+func (c *Context) coverPixel(x, y int, z float64, col color.RGBA, cov float64) {
+	s := &c.styles[len(c.styles)-1]
+	if s.NoSmooth {
+		if cov < 0.5 {
+			return
+		}
+		cov = 1
 	}
+	c.blend(x, y, z, col, cov)
 }
 
 func (c *Context) pixelRegion(x, y int, z float64, col color.RGBA) {
@@ -139,11 +216,26 @@ func (c *Context) Point(x, y int) {
 }
 
 func (c *Context) Point3(x, y, z float64) {
+	if c.record(command{op: CMD_POINT, args: [6]float64{x, y, z}}) {
+		return
+	}
+
 	s := &c.styles[len(c.styles)-1]
+	if c.projected {
+		p := c.clipPoint(f64.Vec3{x, y, z})
+		if !insideClip(p) {
+			return
+		}
+		q := c.toScreen(p)
+		x, y, z = q.X, q.Y, q.Z
+	}
 	c.pixelRegion(int(x+0.5), int(y+0.5), z, s.Stroke)
 }
 
 func (c *Context) Line(x0, y0, x1, y1 int) {
+	if c.record(command{op: CMD_LINE, args: [6]float64{float64(x0), float64(y0), float64(x1), float64(y1)}}) {
+		return
+	}
 	c.lineConstantZ(x0, y0, x1, y1, 1)
 }
 
@@ -205,9 +297,22 @@ func (c *Context) Line3p(p0, p1 f64.Vec3) {
 }
 
 func (c *Context) Line3(x0, y0, z0, x1, y1, z1 float64) {
+	if c.record(command{op: CMD_LINE3, args: [6]float64{x0, y0, z0, x1, y1, z1}}) {
+		return
+	}
+
 	p0 := f64.Vec3{x0, y0, z0}
 	p1 := f64.Vec3{x1, y1, z1}
 
+	if c.projected {
+		q0, q1, ok := clipLine(c.clipPoint(p0), c.clipPoint(p1))
+		if !ok {
+			return
+		}
+		c.lineDepth(c.toScreen(q0).XYZ(), c.toScreen(q1).XYZ())
+		return
+	}
+
 	m := c.transforms[len(c.transforms)-1]
 	p0 = m.Transform3(p0)
 	p1 = m.Transform3(p1)
@@ -261,6 +366,10 @@ func (c *Context) Line3(x0, y0, z0, x1, y1, z1 float64) {
 }
 
 func (c *Context) Circle(xm, ym, r int) {
+	if c.record(command{op: CMD_CIRCLE, args: [6]float64{float64(xm), float64(ym), float64(r)}}) {
+		return
+	}
+
 	s := &c.styles[len(c.styles)-1]
 
 loop:
@@ -353,21 +462,34 @@ func (c *Context) SetMatrix(m f64.Mat4) {
 }
 
 func (c *Context) Clear() {
-	for i := range c.zbuffer {
-		c.zbuffer[i] = math.MaxFloat32
+	if c.record(command{op: CMD_CLEAR}) {
+		return
+	}
+
+	r := c.framebuffer.Bounds()
+	if c.tile != nil {
+		r = r.Intersect(*c.tile)
+	}
+	z := r.Intersect(c.bounds)
+	for y := z.Min.Y; y < z.Max.Y; y++ {
+		n := (y-c.bounds.Min.Y)*c.bounds.Dx() + z.Min.X - c.bounds.Min.X
+		for i := range c.zbuffer[n : n+z.Dx()] {
+			c.zbuffer[n+i] = math.MaxFloat32
+		}
 	}
 
 	s := &c.styles[len(c.styles)-1]
-	fb := c.framebuffer
-	draw.Draw(fb, fb.Bounds(), image.NewUniform(s.Background), image.ZP, draw.Over)
+	draw.Draw(c.framebuffer, r, image.NewUniform(s.Background), r.Min, draw.Over)
 }
 
 func (c *Context) Save() {
 	c.PushMatrix(c.transforms[len(c.transforms)-1])
 	c.PushStyle(c.styles[len(c.styles)-1])
+	c.clips = append(c.clips, c.clips[len(c.clips)-1])
 }
 
 func (c *Context) Restore() {
 	c.PopMatrix()
 	c.PopStyle()
+	c.clips = c.clips[:len(c.clips)-1]
 }
@@ -0,0 +1,241 @@
+// https://learn.microsoft.com/en-us/typography/opentype/spec/gpos
+// https://learn.microsoft.com/en-us/typography/opentype/spec/chapter2
+
+package drc
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// gposKern is the pair adjustment of the kern feature of the gpos
+// table, sfnt only reads the legacy kern table that newer fonts like
+// roboto do not have, malformed tables read as no kerning
+type gposKern struct {
+	data []byte
+
+	// the pair adjustment subtables of every lookup of the feature
+	lookups [][]int
+}
+
+// parseGPOSKern finds the kern feature in the gpos table of
+// the font data, it returns nil if the font has none
+func parseGPOSKern(font []byte) *gposKern {
+	d := findTable(font, "GPOS")
+	if d == nil {
+		return nil
+	}
+
+	k := &gposKern{data: d}
+	features := int(k.u16(6))
+	lookupList := int(k.u16(8))
+
+	// the same lookups can be shared by the kern
+	// feature of every script, use each of them once
+	seen := make(map[int]bool)
+	var indices []int
+	for i, n := 0, int(k.u16(features)); i < n; i++ {
+		rec := features + 2 + i*6
+		if string(k.bytes(rec, 4)) != "kern" {
+			continue
+		}
+		feat := features + int(k.u16(rec+4))
+		for j, m := 0, int(k.u16(feat+2)); j < m; j++ {
+			x := int(k.u16(feat + 4 + j*2))
+			if !seen[x] {
+				seen[x] = true
+				indices = append(indices, x)
+			}
+		}
+	}
+	sort.Ints(indices)
+
+	for _, x := range indices {
+		if x >= int(k.u16(lookupList)) {
+			continue
+		}
+		lookup := lookupList + int(k.u16(lookupList+2+x*2))
+		typ := k.u16(lookup)
+		var subs []int
+		for j, m := 0, int(k.u16(lookup+4)); j < m; j++ {
+			sub := lookup + int(k.u16(lookup+6+j*2))
+			// extension subtables point to the real one with a 32 bit offset
+			if typ == 9 {
+				if k.u16(sub+2) != 2 {
+					continue
+				}
+				sub += int(k.u32(sub + 4))
+			} else if typ != 2 {
+				continue
+			}
+			subs = append(subs, sub)
+		}
+		if len(subs) > 0 {
+			k.lookups = append(k.lookups, subs)
+		}
+	}
+	if len(k.lookups) == 0 {
+		return nil
+	}
+	return k
+}
+
+// kern returns the horizontal adjustment between two glyphs in
+// font units, the first subtable of a lookup with the pair applies
+func (k *gposKern) kern(a, b sfnt.GlyphIndex) int {
+	v := 0
+	for _, subs := range k.lookups {
+		for _, sub := range subs {
+			if x, ok := k.pair(sub, uint16(a), uint16(b)); ok {
+				v += x
+				break
+			}
+		}
+	}
+	return v
+}
+
+// pair looks up the x advance of the first glyph of a pair in a pair
+// adjustment subtable, false if the subtable does not have the pair
+func (k *gposKern) pair(sub int, a, b uint16) (int, bool) {
+	ci, ok := k.coverage(sub+int(k.u16(sub+2)), a)
+	if !ok {
+		return 0, false
+	}
+
+	vf1, vf2 := k.u16(sub+4), k.u16(sub+6)
+	size := valueSize(vf1) + valueSize(vf2)
+	switch k.u16(sub) {
+	case 1:
+		if ci >= int(k.u16(sub+8)) {
+			return 0, false
+		}
+		set := sub + int(k.u16(sub+10+ci*2))
+		n := int(k.u16(set))
+		rec := 2 + size
+		i := sort.Search(n, func(i int) bool {
+			return k.u16(set+2+i*rec) >= b
+		})
+		if i == n || k.u16(set+2+i*rec) != b {
+			return 0, false
+		}
+		return k.xAdvance(set+2+i*rec+2, vf1), true
+
+	case 2:
+		c1 := k.class(sub+int(k.u16(sub+8)), a)
+		c2 := k.class(sub+int(k.u16(sub+10)), b)
+		n1, n2 := int(k.u16(sub+12)), int(k.u16(sub+14))
+		if c1 >= n1 || c2 >= n2 {
+			return 0, false
+		}
+		return k.xAdvance(sub+16+(c1*n2+c2)*size, vf1), true
+	}
+	return 0, false
+}
+
+// coverage returns the coverage index of a glyph
+func (k *gposKern) coverage(off int, g uint16) (int, bool) {
+	n := int(k.u16(off + 2))
+	switch k.u16(off) {
+	case 1:
+		i := sort.Search(n, func(i int) bool {
+			return k.u16(off+4+i*2) >= g
+		})
+		if i < n && k.u16(off+4+i*2) == g {
+			return i, true
+		}
+	case 2:
+		i := sort.Search(n, func(i int) bool {
+			return k.u16(off+4+i*6+2) >= g
+		})
+		if r := off + 4 + i*6; i < n && k.u16(r) <= g {
+			return int(k.u16(r+4)) + int(g-k.u16(r)), true
+		}
+	}
+	return 0, false
+}
+
+// class returns the class of a glyph, glyphs not listed are class 0
+func (k *gposKern) class(off int, g uint16) int {
+	switch k.u16(off) {
+	case 1:
+		start := k.u16(off + 2)
+		if g >= start && int(g-start) < int(k.u16(off+4)) {
+			return int(k.u16(off + 6 + int(g-start)*2))
+		}
+	case 2:
+		n := int(k.u16(off + 2))
+		i := sort.Search(n, func(i int) bool {
+			return k.u16(off+4+i*6+2) >= g
+		})
+		if r := off + 4 + i*6; i < n && k.u16(r) <= g {
+			return int(k.u16(r + 4))
+		}
+	}
+	return 0
+}
+
+// xAdvance reads the x advance of a value record, it follows
+// the x and y placements when the record has them
+func (k *gposKern) xAdvance(off int, format uint16) int {
+	if format&4 == 0 {
+		return 0
+	}
+	return int(int16(k.u16(off + valueSize(format&3))))
+}
+
+// valueSize is the size in bytes of a value record
+func valueSize(format uint16) int {
+	n := 0
+	for ; format != 0; format &= format - 1 {
+		n += 2
+	}
+	return n
+}
+
+func (k *gposKern) bytes(off, n int) []byte {
+	if off < 0 || off+n > len(k.data) {
+		return nil
+	}
+	return k.data[off : off+n]
+}
+
+func (k *gposKern) u16(off int) uint16 {
+	if b := k.bytes(off, 2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (k *gposKern) u32(off int) uint32 {
+	if b := k.bytes(off, 4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// findTable returns the data of a table of a font
+func findTable(font []byte, tag string) []byte {
+	if len(font) < 12 {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(font[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + i*16
+		if rec+16 > len(font) {
+			return nil
+		}
+		if string(font[rec:rec+4]) != tag {
+			continue
+		}
+		off := int(binary.BigEndian.Uint32(font[rec+8:]))
+		size := int(binary.BigEndian.Uint32(font[rec+12:]))
+		if off < 0 || size < 0 || off+size > len(font) || off+size < off {
+			return nil
+		}
+		return font[off : off+size]
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package drc
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	FILL_NONZERO = imageutil.FillNonZero
+	FILL_EVENODD = imageutil.FillEvenOdd
+)
+
+const (
+	JOIN_MITER = imageutil.JoinMiter
+	JOIN_ROUND = imageutil.JoinRound
+	JOIN_BEVEL = imageutil.JoinBevel
+)
+
+const (
+	CAP_BUTT   = imageutil.CapButt
+	CAP_ROUND  = imageutil.CapRound
+	CAP_SQUARE = imageutil.CapSquare
+)
+
+const (
+	PATH_MOVE = iota
+	PATH_LINE
+	PATH_QUAD
+	PATH_CUBIC
+	PATH_CLOSE
+)
+
+// Path is a list of subpaths made of lines and bezier curves,
+// it keeps the curves as they are given so it can be drawn
+// under any transform
+type Path struct {
+	ops []pathOp
+
+	// start of the subpath and the current point
+	start, cur f64.Vec2
+}
+
+type pathOp struct {
+	op  int
+	pts [3]f64.Vec2
+}
+
+func (p *Path) MoveTo(x, y float64) {
+	q := f64.Vec2{x, y}
+	p.ops = append(p.ops, pathOp{op: PATH_MOVE, pts: [3]f64.Vec2{q}})
+	p.start, p.cur = q, q
+}
+
+func (p *Path) LineTo(x, y float64) {
+	p.begin()
+	q := f64.Vec2{x, y}
+	p.ops = append(p.ops, pathOp{op: PATH_LINE, pts: [3]f64.Vec2{q}})
+	p.cur = q
+}
+
+func (p *Path) QuadTo(cx, cy, x, y float64) {
+	p.begin()
+	q := f64.Vec2{x, y}
+	p.ops = append(p.ops, pathOp{op: PATH_QUAD, pts: [3]f64.Vec2{{cx, cy}, q}})
+	p.cur = q
+}
+
+func (p *Path) CubicTo(c1x, c1y, c2x, c2y, x, y float64) {
+	p.begin()
+	q := f64.Vec2{x, y}
+	p.ops = append(p.ops, pathOp{op: PATH_CUBIC, pts: [3]f64.Vec2{{c1x, c1y}, {c2x, c2y}, q}})
+	p.cur = q
+}
+
+// Close connects the current point to the start of the subpath
+func (p *Path) Close() {
+	if len(p.ops) == 0 {
+		return
+	}
+	p.ops = append(p.ops, pathOp{op: PATH_CLOSE})
+	p.cur = p.start
+}
+
+// Arc adds a circular arc from angle a0 to a1 in radians going
+// the way of their difference, with y down positive angles turn
+// clockwise on the image, a line joins the current point to the
+// start of the arc
+func (p *Path) Arc(cx, cy, r, a0, a1 float64) {
+	p.EllipticArc(cx, cy, r, r, a0, a1)
+}
+
+func (p *Path) EllipticArc(cx, cy, rx, ry, a0, a1 float64) {
+	x, y := cx+rx*math.Cos(a0), cy+ry*math.Sin(a0)
+	if len(p.ops) == 0 || p.ops[len(p.ops)-1].op == PATH_CLOSE {
+		p.MoveTo(x, y)
+	} else {
+		p.LineTo(x, y)
+	}
+
+	// split into pieces of at most a quarter turn, every
+	// piece is a cubic with the tangents of the arc
+	n := int(math.Ceil(math.Abs(a1-a0) / (math.Pi / 2)))
+	d := (a1 - a0) / float64(max(n, 1))
+	k := 4.0 / 3 * math.Tan(d/4)
+	for i := 0; i < n; i++ {
+		t0 := a0 + float64(i)*d
+		t1 := t0 + d
+		s0, c0 := math.Sincos(t0)
+		s1, c1 := math.Sincos(t1)
+		p.CubicTo(
+			cx+rx*(c0-k*s0), cy+ry*(s0+k*c0),
+			cx+rx*(c1+k*s1), cy+ry*(s1-k*c1),
+			cx+rx*c1, cy+ry*s1,
+		)
+	}
+}
+
+func (p *Path) Rect(x, y, w, h float64) {
+	p.MoveTo(x, y)
+	p.LineTo(x+w, y)
+	p.LineTo(x+w, y+h)
+	p.LineTo(x, y+h)
+	p.Close()
+}
+
+// RoundedRect adds a rectangle with the corners rounded by r,
+// the radius is limited to half of the shorter side
+func (p *Path) RoundedRect(x, y, w, h, r float64) {
+	r = math.Min(r, math.Min(math.Abs(w), math.Abs(h))/2)
+	if r <= 0 {
+		p.Rect(x, y, w, h)
+		return
+	}
+	p.MoveTo(x+r, y)
+	p.Arc(x+w-r, y+r, r, -math.Pi/2, 0)
+	p.Arc(x+w-r, y+h-r, r, 0, math.Pi/2)
+	p.Arc(x+r, y+h-r, r, math.Pi/2, math.Pi)
+	p.Arc(x+r, y+r, r, math.Pi, 3*math.Pi/2)
+	p.Close()
+}
+
+func (p *Path) Ellipse(cx, cy, rx, ry float64) {
+	p.MoveTo(cx+rx, cy)
+	p.EllipticArc(cx, cy, rx, ry, 0, 2*math.Pi)
+	p.Close()
+}
+
+// begin starts a subpath at the current point if the
+// path is empty or the last subpath was closed
+func (p *Path) begin() {
+	if len(p.ops) == 0 || p.ops[len(p.ops)-1].op == PATH_CLOSE {
+		p.MoveTo(p.cur.X, p.cur.Y)
+	}
+}
+
+// transform returns a copy of the path transformed by the matrix
+// with z at 0, the curves stay curves since the transform is affine
+// in the plane
+func (p *Path) transform(m *f64.Mat4) *Path {
+	q := &Path{}
+	q.add(p, m)
+	return q
+}
+
+// add appends the subpaths of q transformed by the matrix
+func (p *Path) add(q *Path, m *f64.Mat4) {
+	for _, o := range q.ops {
+		for i := range o.pts {
+			v := m.Transform3(f64.Vec3{o.pts[i].X, o.pts[i].Y, 0})
+			o.pts[i] = f64.Vec2{v.X, v.Y}
+		}
+		p.ops = append(p.ops, o)
+	}
+	p.start, p.cur = m.Transform3(f64.Vec3{q.start.X, q.start.Y, 0}).XY(), m.Transform3(f64.Vec3{q.cur.X, q.cur.Y, 0}).XY()
+}
+
+// flatten transforms the path and converts it for rasterization
+func (p *Path) flatten(m *f64.Mat4) *imageutil.Path {
+	tf := func(q f64.Vec2) f64.Vec2 {
+		v := m.Transform3(f64.Vec3{q.X, q.Y, 0})
+		return f64.Vec2{v.X, v.Y}
+	}
+
+	var ip imageutil.Path
+	for _, o := range p.ops {
+		a, b, c := tf(o.pts[0]), tf(o.pts[1]), tf(o.pts[2])
+		switch o.op {
+		case PATH_MOVE:
+			ip.MoveTo(a.X, a.Y)
+		case PATH_LINE:
+			ip.LineTo(a.X, a.Y)
+		case PATH_QUAD:
+			ip.QuadTo(a.X, a.Y, b.X, b.Y)
+		case PATH_CUBIC:
+			ip.CubicTo(a.X, a.Y, b.X, b.Y, c.X, c.Y)
+		case PATH_CLOSE:
+			ip.Close()
+		}
+	}
+	return &ip
+}
+
+// FillPath fills the path with the fill color of the
+// style using its fill rule, it is transformed by the
+// current matrix with z at 0
+func (c *Context) FillPath(p *Path) {
+	if c.record(command{op: CMD_FILL_PATH, path: p}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	m := c.transforms[len(c.transforms)-1]
+	c.fillPath(p, &m, s.FillRule, s.Fill)
+}
+
+func (c *Context) fillPath(p *Path, m *f64.Mat4, rule int, col color.RGBA) {
+	imageutil.RasterizePath(p.flatten(m), rule, c.drawRect(), func(x, y int, a float64) {
+		c.coverPixel(x, y, 1, col, a)
+	})
+}
+
+// StrokePath draws the outline of the path with the stroke
+// color, line width, joins, caps and dashes of the style, the
+// width and dashes are scaled along with the path
+func (c *Context) StrokePath(p *Path) {
+	if c.record(command{op: CMD_STROKE_PATH, path: p}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	m := c.transforms[len(c.transforms)-1]
+	imageutil.RasterizeStroke(p.flatten(&m), c.strokeOptions(), c.drawRect(), func(x, y int, a float64) {
+		c.coverPixel(x, y, 1, s.Stroke, a)
+	})
+}
+
+// strokeOptions returns how the style strokes paths in pixels,
+// the width and dashes are scaled by the scale of the matrix
+func (c *Context) strokeOptions() *imageutil.StrokeOptions {
+	s := &c.styles[len(c.styles)-1]
+	m := &c.transforms[len(c.transforms)-1]
+
+	k := math.Sqrt(math.Abs(m[0][0]*m[1][1] - m[0][1]*m[1][0]))
+	o := &imageutil.StrokeOptions{
+		Width:      s.LineWidth * k,
+		Join:       s.LineJoin,
+		Cap:        s.LineCap,
+		MiterLimit: s.MiterLimit,
+		DashOffset: s.DashOffset * k,
+	}
+	for _, d := range s.Dash {
+		o.Dash = append(o.Dash, d*k)
+	}
+	return o
+}
+
+// DrawPath fills and strokes the path as the style says
+func (c *Context) DrawPath(p *Path) {
+	s := &c.styles[len(c.styles)-1]
+	if !s.NoFill {
+		c.FillPath(p)
+	}
+	if !s.NoStroke {
+		c.StrokePath(p)
+	}
+}
+
+func (c *Context) Rect(x, y, w, h float64) {
+	var p Path
+	p.Rect(x, y, w, h)
+	c.DrawPath(&p)
+}
+
+func (c *Context) RoundedRect(x, y, w, h, r float64) {
+	var p Path
+	p.RoundedRect(x, y, w, h, r)
+	c.DrawPath(&p)
+}
+
+func (c *Context) Ellipse(cx, cy, rx, ry float64) {
+	var p Path
+	p.Ellipse(cx, cy, rx, ry)
+	c.DrawPath(&p)
+}
+
+func (c *Context) Arc(cx, cy, r, a0, a1 float64) {
+	var p Path
+	p.Arc(cx, cy, r, a0, a1)
+	c.DrawPath(&p)
+}
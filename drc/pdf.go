@@ -0,0 +1,236 @@
+package drc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// pdfWriter builds the content of a single page, layers are form
+// xobjects drawn into the content they were begun in
+type pdfWriter struct {
+	bounds image.Rectangle
+
+	// content being written, one for the page and every open layer
+	content []*bytes.Buffer
+	layers  []pdfState
+
+	// finished layers and the graphics states in use
+	forms  [][]byte
+	states []pdfState
+}
+
+// pdfState is the alpha and blend mode of a graphics state
+type pdfState struct {
+	fill, stroke float64
+	blend        int
+}
+
+// PDF writes the recording as a pdf document with
+// a single page the size of the bounds in points
+func (r *Recording) PDF(w io.Writer) error {
+	p := &pdfWriter{
+		bounds:  r.Bounds,
+		content: []*bytes.Buffer{new(bytes.Buffer)},
+	}
+
+	// flip y so the content is drawn in pixels
+	b := r.Bounds
+	fmt.Fprintf(p.content[0], "1 0 0 -1 %d %d cm\n", -b.Min.X, b.Max.Y)
+	r.vectorize(p)
+
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(format string, args ...interface{}) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&buf, format, args...)
+		fmt.Fprintf(&buf, "\nendobj\n")
+	}
+	stream := func(dict string, data []byte) {
+		obj("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+
+	// the page, its resources and content come first,
+	// the forms of the layers follow in order
+	var res strings.Builder
+	res.WriteString("<< /ExtGState <<")
+	for i, k := range p.states {
+		fmt.Fprintf(&res, " /Gs%d << /Type /ExtGState /ca %s /CA %s", i, num(k.fill), num(k.stroke))
+		if name := blendNames[k.blend]; name != "" {
+			fmt.Fprintf(&res, " /BM /%s", pdfName(name))
+		}
+		res.WriteString(" >>")
+	}
+	res.WriteString(" >> /XObject <<")
+	for i := range p.forms {
+		fmt.Fprintf(&res, " /Fm%d %d 0 R", i, 6+i)
+	}
+	res.WriteString(" >> >>")
+
+	fmt.Fprintf(&buf, "%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	obj("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources 4 0 R /Contents 5 0 R "+
+		"/Group << /S /Transparency /CS /DeviceRGB >> >>", b.Dx(), b.Dy())
+	obj("%s", res.String())
+	stream("", p.content[0].Bytes())
+	for _, f := range p.forms {
+		stream(fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [%d %d %d %d] /Resources 4 0 R "+
+			"/Group << /S /Transparency /CS /DeviceRGB >>", b.Min.X, b.Min.Y, b.Max.X, b.Max.Y), f)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (p *pdfWriter) fill(q *Path, rule int, col color.RGBA, blend int, cl *clip) {
+	if len(q.ops) == 0 || col.A == 0 {
+		return
+	}
+	w := p.begin(cl)
+	r, g, b, a := straight(col)
+	p.state(w, pdfState{a, 1, blend})
+	fmt.Fprintf(w, "%s %s %s rg\n", num(float64(r)/255), num(float64(g)/255), num(float64(b)/255))
+	pdfPath(w, q)
+	if rule == FILL_EVENODD {
+		fmt.Fprintf(w, "f*\n")
+	} else {
+		fmt.Fprintf(w, "f\n")
+	}
+	fmt.Fprintf(w, "Q\n")
+}
+
+func (p *pdfWriter) stroke(q *Path, o *imageutil.StrokeOptions, col color.RGBA, blend int, cl *clip) {
+	if len(q.ops) == 0 || col.A == 0 || o.Width <= 0 {
+		return
+	}
+	w := p.begin(cl)
+	r, g, b, a := straight(col)
+	p.state(w, pdfState{1, a, blend})
+	fmt.Fprintf(w, "%s %s %s RG\n", num(float64(r)/255), num(float64(g)/255), num(float64(b)/255))
+
+	// the joins and caps are numbered the same way as in pdf
+	limit := o.MiterLimit
+	if limit <= 0 {
+		limit = 4
+	}
+	fmt.Fprintf(w, "%s w %d j %d J %s M\n", num(o.Width), o.Join, o.Cap, num(max(limit, 1)))
+	if d := dashed(o); d != nil {
+		var l []string
+		for _, v := range d {
+			l = append(l, num(v))
+		}
+		fmt.Fprintf(w, "[%s] %s d\n", strings.Join(l, " "), num(o.DashOffset))
+	}
+	pdfPath(w, q)
+	fmt.Fprintf(w, "S\nQ\n")
+}
+
+func (p *pdfWriter) beginLayer(opacity float64, blend int) {
+	p.content = append(p.content, new(bytes.Buffer))
+	p.layers = append(p.layers, pdfState{opacity, opacity, blend})
+}
+
+func (p *pdfWriter) endLayer() {
+	n := len(p.content) - 1
+	f := p.content[n]
+	l := p.layers[n-1]
+	p.content = p.content[:n]
+	p.layers = p.layers[:n-1]
+
+	w := p.content[n-1]
+	fmt.Fprintf(w, "q\n")
+	p.state(w, l)
+	fmt.Fprintf(w, "/Fm%d Do\nQ\n", len(p.forms))
+	p.forms = append(p.forms, f.Bytes())
+}
+
+// begin saves the graphics state and sets the clip
+// for drawing into the current content
+func (p *pdfWriter) begin(cl *clip) *bytes.Buffer {
+	w := p.content[len(p.content)-1]
+	fmt.Fprintf(w, "q\n")
+	if !cl.clipped(p.bounds) {
+		return w
+	}
+	r := cl.rect
+	fmt.Fprintf(w, "%d %d %d %d re W n\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	for _, cp := range cl.paths {
+		pdfPath(w, cp.path)
+		if cp.rule == FILL_EVENODD {
+			fmt.Fprintf(w, "W* n\n")
+		} else {
+			fmt.Fprintf(w, "W n\n")
+		}
+	}
+	return w
+}
+
+// state sets the graphics state for the alpha and blend mode
+func (p *pdfWriter) state(w *bytes.Buffer, st pdfState) {
+	if _, ok := blendNames[st.blend]; !ok {
+		st.blend = BLEND_SRC_OVER
+	}
+	if st == (pdfState{1, 1, BLEND_SRC_OVER}) {
+		return
+	}
+	i := 0
+	for i < len(p.states) && p.states[i] != st {
+		i++
+	}
+	if i == len(p.states) {
+		p.states = append(p.states, st)
+	}
+	fmt.Fprintf(w, "/Gs%d gs\n", i)
+}
+
+// pdfPath writes the path construction operators of a path
+// in pixels, quadratic curves are raised to cubics
+func pdfPath(w *bytes.Buffer, p *Path) {
+	var start, cur f64.Vec2
+	for _, o := range p.ops {
+		q := o.pts
+		switch o.op {
+		case PATH_MOVE:
+			fmt.Fprintf(w, "%s %s m\n", num(q[0].X), num(q[0].Y))
+			start, cur = q[0], q[0]
+		case PATH_LINE:
+			fmt.Fprintf(w, "%s %s l\n", num(q[0].X), num(q[0].Y))
+			cur = q[0]
+		case PATH_QUAD:
+			c1 := cur.Lerp(2.0/3, q[0])
+			c2 := q[1].Lerp(2.0/3, q[0])
+			fmt.Fprintf(w, "%s %s %s %s %s %s c\n", num(c1.X), num(c1.Y), num(c2.X), num(c2.Y), num(q[1].X), num(q[1].Y))
+			cur = q[1]
+		case PATH_CUBIC:
+			fmt.Fprintf(w, "%s %s %s %s %s %s c\n", num(q[0].X), num(q[0].Y), num(q[1].X), num(q[1].Y), num(q[2].X), num(q[2].Y))
+			cur = q[2]
+		case PATH_CLOSE:
+			fmt.Fprintf(w, "h\n")
+			cur = start
+		}
+	}
+}
+
+// pdfName turns a css blend mode name into the pdf one
+func pdfName(css string) string {
+	var b strings.Builder
+	for _, s := range strings.Split(css, "-") {
+		b.WriteString(strings.ToUpper(s[:1]) + s[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+package drc
+
+import (
+	"image"
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// the vertex pipeline takes a vertex through the model matrix
+// on top of the transforms, the view and the projection into
+// clip space, clips against the view volume and then divides
+// and maps into the viewport, the depth goes from 0 at the near
+// plane to 1 at the far plane
+
+// SetProjection sets the projection matrix and enables the pipeline
+func (c *Context) SetProjection(m f64.Mat4) {
+	c.projection = m
+	c.projected = true
+}
+
+func (c *Context) Projection() f64.Mat4 {
+	return c.projection
+}
+
+// NoProjection disables the pipeline, 3D coordinates are
+// transformed by the current matrix into pixels again
+func (c *Context) NoProjection() {
+	c.projected = false
+}
+
+// Perspective sets a perspective projection with
+// the vertical field of view in radians
+func (c *Context) Perspective(fovy, aspect, near, far float64) {
+	var m f64.Mat4
+	m.Perspective(fovy, aspect, near, far)
+	c.SetProjection(m)
+}
+
+func (c *Context) Ortho(l, r, b, t, n, f float64) {
+	var m f64.Mat4
+	m.Ortho(l, r, b, t, n, f)
+	c.SetProjection(m)
+}
+
+func (c *Context) SetView(m f64.Mat4) {
+	c.view = m
+}
+
+func (c *Context) View() f64.Mat4 {
+	return c.view
+}
+
+// LookAt sets the view to look from the eye at the center, the
+// rotation of Mat4.LookAt is used with the eye at the origin since
+// it translates after rotating while the view has to translate first
+func (c *Context) LookAt(eye, center, up f64.Vec3) {
+	var r, t f64.Mat4
+	r.LookAt(f64.Vec3{}, center.Sub(eye), up)
+	t.Translate(-eye.X, -eye.Y, -eye.Z)
+	c.view.Mul(&r, &t)
+}
+
+// SetViewport sets the rectangle of the framebuffer
+// normalized device coordinates are mapped to
+func (c *Context) SetViewport(r image.Rectangle) {
+	c.viewport = r
+}
+
+func (c *Context) Viewport() image.Rectangle {
+	return c.viewport
+}
+
+// clipPoint takes a point into clip space
+func (c *Context) clipPoint(p f64.Vec3) f64.Vec4 {
+	var m f64.Mat4
+	m.Mul(&c.projection, &c.view)
+	m.Mul(&m, &c.transforms[len(c.transforms)-1])
+	return m.Transform(f64.Vec4{p.X, p.Y, p.Z, 1})
+}
+
+// toScreen divides a point in clip space and maps it into the
+// viewport with y going down, w holds the reciprocal of the clip w
+func (c *Context) toScreen(p f64.Vec4) f64.Vec4 {
+	r := c.viewport
+	var m f64.Mat4
+	m.Viewport(float64(r.Min.X), float64(r.Max.Y), float64(r.Dx()), -float64(r.Dy()))
+	w := 1 / p.W
+	q := m.Transform3(f64.Vec3{p.X * w, p.Y * w, p.Z * w})
+	return f64.Vec4{q.X, q.Y, q.Z, w}
+}
+
+// clipDistance is the signed distance of a point in clip space
+// to one of the six planes of the view volume, it is negative
+// outside of the volume
+func clipDistance(p f64.Vec4, plane int) float64 {
+	switch plane {
+	case 0:
+		return p.W + p.X
+	case 1:
+		return p.W - p.X
+	case 2:
+		return p.W + p.Y
+	case 3:
+		return p.W - p.Y
+	case 4:
+		return p.W + p.Z
+	default:
+		return p.W - p.Z
+	}
+}
+
+func insideClip(p f64.Vec4) bool {
+	for i := 0; i < 6; i++ {
+		if clipDistance(p, i) < 0 {
+			return false
+		}
+	}
+	return p.W > 0
+}
+
+// clipLine clips a segment in clip space to the view volume
+func clipLine(p0, p1 f64.Vec4) (q0, q1 f64.Vec4, ok bool) {
+	t0, t1 := 0.0, 1.0
+	for i := 0; i < 6; i++ {
+		d0, d1 := clipDistance(p0, i), clipDistance(p1, i)
+		switch {
+		case d0 < 0 && d1 < 0:
+			return
+		case d0 < 0:
+			t0 = math.Max(t0, d0/(d0-d1))
+		case d1 < 0:
+			t1 = math.Min(t1, d0/(d0-d1))
+		}
+	}
+	if t0 > t1 {
+		return
+	}
+	return lerp4(t0, p0, p1), lerp4(t1, p0, p1), true
+}
+
+// lineDepth draws a line in pixel coordinates with the
+// depth interpolated along it, the depth in the pipeline
+// is fractional so it cannot be stepped like x and y
+func (c *Context) lineDepth(p0, p1 f64.Vec3) {
+	s := &c.styles[len(c.styles)-1]
+	n := int(math.Ceil(math.Max(math.Abs(p1.X-p0.X), math.Abs(p1.Y-p0.Y))))
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		p := p0.Lerp(t, p1)
+		c.pixelRegion(int(p.X), int(p.Y), p.Z, s.Stroke)
+	}
+}
+
+// clipTriangle runs a triangle through the vertex pipeline, the
+// parts inside the view volume are fanned into triangles that
+// keep the winding of the original
+func (c *Context) clipTriangle(v0, v1, v2 Vertex, cull int, shade func(f *Fragment) bool) {
+	poly := c.clipPolygon(v0, v1, v2)
+	for i := 1; i+1 < len(poly); i++ {
+		c.rasterTriangle([3]rasterVertex{poly[0], poly[i], poly[i+1]}, c.viewport.Intersect(c.drawRect()), cull, shade)
+	}
+}
+
+// clipPolygon returns the convex polygon in pixel coordinates
+// that is left of a triangle after clipping it to the view
+// volume, it is empty if nothing is left
+func (c *Context) clipPolygon(v0, v1, v2 Vertex) []rasterVertex {
+	var m f64.Mat4
+	m.Mul(&c.projection, &c.view)
+	m.Mul(&m, &c.transforms[len(c.transforms)-1])
+	n := normalMatrix(&c.transforms[len(c.transforms)-1])
+
+	poly := make([]rasterVertex, 0, 9)
+	for _, v := range [3]Vertex{v0, v1, v2} {
+		v.Normal = n.Transform(v.Normal)
+		poly = append(poly, rasterVertex{v, m.Transform(f64.Vec4{v.Pos.X, v.Pos.Y, v.Pos.Z, 1})})
+	}
+
+	// sutherland-hodgman against every plane, the attributes
+	// are linear in clip space so they interpolate directly
+	var next []rasterVertex
+	for plane := 0; plane < 6 && len(poly) >= 3; plane++ {
+		next = next[:0]
+		for i := range poly {
+			a, b := poly[i], poly[(i+1)%len(poly)]
+			da, db := clipDistance(a.pos, plane), clipDistance(b.pos, plane)
+			if da >= 0 {
+				next = append(next, a)
+			}
+			if (da >= 0) != (db >= 0) {
+				next = append(next, lerpVertex(da/(da-db), a, b))
+			}
+		}
+		poly, next = next, poly
+	}
+	if len(poly) < 3 {
+		return nil
+	}
+
+	for i := range poly {
+		poly[i].pos = c.toScreen(poly[i].pos)
+	}
+	return poly
+}
+
+func lerpVertex(t float64, a, b rasterVertex) rasterVertex {
+	return rasterVertex{
+		Vertex{
+			Pos:    a.Pos.Lerp(t, b.Pos),
+			Color:  lerp4(t, a.Color, b.Color),
+			UV:     a.UV.Lerp(t, b.UV),
+			Normal: a.Normal.Lerp(t, b.Normal),
+		},
+		lerp4(t, a.pos, b.pos),
+	}
+}
+
+// normalMatrix is the inverse transpose of the upper 3x3 of the
+// model matrix up to a positive scale, it takes normals into world
+// space, the fragments normalize the result
+func normalMatrix(m *f64.Mat4) f64.Mat3 {
+	r0 := f64.Vec3{m[0][0], m[0][1], m[0][2]}
+	r1 := f64.Vec3{m[1][0], m[1][1], m[1][2]}
+	r2 := f64.Vec3{m[2][0], m[2][1], m[2][2]}
+	a, b, d := r1.Cross(r2), r2.Cross(r0), r0.Cross(r1)
+	if r0.Dot(a) < 0 {
+		a, b, d = a.Scale(-1), b.Scale(-1), d.Scale(-1)
+	}
+	return f64.Mat3{
+		{a.X, a.Y, a.Z},
+		{b.X, b.Y, b.Z},
+		{d.X, d.Y, d.Z},
+	}
+}
@@ -0,0 +1,310 @@
+package drc
+
+import (
+	"image"
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// drawing commands kept while drawing is recorded or deferred
+const (
+	CMD_CLEAR = iota
+	CMD_POINT
+	CMD_LINE
+	CMD_LINE3
+	CMD_CIRCLE
+	CMD_TRIANGLE
+	CMD_TRIANGLE3
+	CMD_FILL_PATH
+	CMD_STROKE_PATH
+	CMD_TEXT
+	CMD_BEGIN_LAYER
+	CMD_END_LAYER
+)
+
+// command is a drawing call with the state it was made in,
+// the bounds hold every pixel it can touch
+type command struct {
+	op     int
+	args   [6]float64
+	verts  [3]Vertex
+	path   *Path
+	text   string
+	state  *drawState
+	bounds image.Rectangle
+}
+
+// drawState is everything a drawing call depends
+// on besides its arguments and the framebuffer
+type drawState struct {
+	style      Style
+	matrix     f64.Mat4
+	projected  bool
+	projection f64.Mat4
+	view       f64.Mat4
+	viewport   image.Rectangle
+	clip       clip
+}
+
+// Recording is the drawing commands made between Record and
+// StopRecording with the state they were made in, it can be
+// replayed into a context or written out as vector graphics
+type Recording struct {
+	// bounds of the framebuffer the commands were drawn to
+	Bounds image.Rectangle
+
+	commands []command
+}
+
+// Record starts recording the drawing commands, they are
+// still drawn as usual, a recording in progress is dropped
+func (c *Context) Record() {
+	c.recording = &Recording{Bounds: c.bounds}
+}
+
+// StopRecording ends the recording and returns it,
+// nil if nothing was being recorded
+func (c *Context) StopRecording() *Recording {
+	r := c.recording
+	c.recording = nil
+	return r
+}
+
+// Replay draws the commands into the context with the styles,
+// matrices and clips they were recorded with, the state of
+// the context is left as it was
+func (r *Recording) Replay(c *Context) {
+	styles := append([]Style(nil), c.styles...)
+	transforms := append([]f64.Mat4(nil), c.transforms...)
+	clips := append([]clip(nil), c.clips...)
+	projected, projection, view, viewport := c.projected, c.projection, c.view, c.viewport
+
+	c.replay(r.commands)
+
+	c.styles, c.transforms, c.clips = styles, transforms, clips
+	c.projected, c.projection, c.view, c.viewport = projected, projection, view, viewport
+}
+
+// record keeps the command with the current state if drawing
+// is recorded or deferred, returning false if it should be
+// drawn now
+func (c *Context) record(cmd command) bool {
+	if !c.deferred && c.recording == nil {
+		return false
+	}
+	cmd.state = &drawState{
+		style:      c.styles[len(c.styles)-1],
+		matrix:     c.transforms[len(c.transforms)-1],
+		projected:  c.projected,
+		projection: c.projection,
+		view:       c.view,
+		viewport:   c.viewport,
+		clip:       c.clips[len(c.clips)-1],
+	}
+	// the dashes are copied like the path so changing
+	// them in place does not change what was drawn
+	if d := cmd.state.style.Dash; d != nil {
+		cmd.state.style.Dash = append([]float64(nil), d...)
+	}
+	if cmd.path != nil {
+		cmd.path = &Path{ops: append([]pathOp(nil), cmd.path.ops...)}
+	}
+	if c.recording != nil {
+		c.recording.commands = append(c.recording.commands, cmd)
+	}
+	if !c.deferred {
+		return false
+	}
+	cmd.bounds = c.commandBounds(&cmd)
+
+	// a layer is binned to the rectangle it was begun with and
+	// everything drawn into it stays inside, so a tile either
+	// replays the whole layer or none of it
+	n := len(c.layerBounds) - 1
+	switch {
+	case cmd.op == CMD_END_LAYER && n >= 0:
+		cmd.bounds = c.layerBounds[n]
+		c.layerBounds = c.layerBounds[:n]
+	case n >= 0:
+		cmd.bounds = cmd.bounds.Intersect(c.layerBounds[n])
+	}
+	if cmd.op == CMD_BEGIN_LAYER {
+		c.layerBounds = append(c.layerBounds, cmd.bounds)
+	}
+
+	c.commands = append(c.commands, cmd)
+	return true
+}
+
+// setState makes the state of a command the current one
+func (c *Context) setState(st *drawState) {
+	c.styles = append(c.styles[:0], st.style)
+	c.transforms = append(c.transforms[:0], st.matrix)
+	c.clips = append(c.clips[:0], st.clip)
+	c.projected = st.projected
+	c.projection = st.projection
+	c.view = st.view
+	c.viewport = st.viewport
+}
+
+// replay draws the commands that overlap the tile if there is one
+func (c *Context) replay(cmds []command) {
+	for i := range cmds {
+		cmd := &cmds[i]
+		if c.tile != nil && !cmd.bounds.Overlaps(*c.tile) {
+			continue
+		}
+
+		c.setState(cmd.state)
+		if c.tile != nil {
+			c.clips[0].rect = c.clips[0].rect.Intersect(*c.tile)
+		}
+
+		a := &cmd.args
+		switch cmd.op {
+		case CMD_CLEAR:
+			c.Clear()
+		case CMD_POINT:
+			c.Point3(a[0], a[1], a[2])
+		case CMD_LINE:
+			c.Line(int(a[0]), int(a[1]), int(a[2]), int(a[3]))
+		case CMD_LINE3:
+			c.Line3(a[0], a[1], a[2], a[3], a[4], a[5])
+		case CMD_CIRCLE:
+			c.Circle(int(a[0]), int(a[1]), int(a[2]))
+		case CMD_TRIANGLE:
+			c.Triangle(int(a[0]), int(a[1]), int(a[2]), int(a[3]), int(a[4]), int(a[5]))
+		case CMD_TRIANGLE3:
+			c.Triangle3(cmd.verts[0], cmd.verts[1], cmd.verts[2])
+		case CMD_FILL_PATH:
+			c.FillPath(cmd.path)
+		case CMD_STROKE_PATH:
+			c.StrokePath(cmd.path)
+		case CMD_TEXT:
+			c.Text(cmd.text, a[0], a[1])
+		case CMD_BEGIN_LAYER:
+			c.BeginLayer(a[0])
+		case CMD_END_LAYER:
+			c.EndLayer()
+		}
+	}
+}
+
+// commandBounds returns a rectangle holding every pixel a command
+// can draw to, it only needs to be conservative
+func (c *Context) commandBounds(cmd *command) image.Rectangle {
+	st := cmd.state
+	s := &st.style
+	m := &st.matrix
+	a := &cmd.args
+
+	var r image.Rectangle
+	switch cmd.op {
+	case CMD_POINT:
+		p := f64.Vec2{a[0], a[1]}
+		if st.projected {
+			q := c.clipPoint(f64.Vec3{a[0], a[1], a[2]})
+			if !insideClip(q) {
+				return image.Rectangle{}
+			}
+			p = c.toScreen(q).XYZ().XY()
+		}
+		r = pointBounds(s.PointSize/2+1, p)
+
+	case CMD_LINE, CMD_TRIANGLE:
+		var ps []f64.Vec2
+		for i := 0; i < 6; i += 2 {
+			ps = append(ps, f64.Vec2{a[i], a[i+1]})
+		}
+		if cmd.op == CMD_LINE {
+			ps = ps[:2]
+		}
+		r = pointBounds(s.LineWidth+s.PointSize+2, ps...)
+
+	case CMD_LINE3:
+		p0 := f64.Vec3{a[0], a[1], a[2]}
+		p1 := f64.Vec3{a[3], a[4], a[5]}
+		if st.projected {
+			q0, q1, ok := clipLine(c.clipPoint(p0), c.clipPoint(p1))
+			if !ok {
+				return image.Rectangle{}
+			}
+			r = pointBounds(s.PointSize+2, c.toScreen(q0).XYZ().XY(), c.toScreen(q1).XYZ().XY())
+		} else {
+			p0, p1 = m.Transform3(p0), m.Transform3(p1)
+			r = pointBounds(2*s.LineWidth+s.PointSize+2, f64.Vec2{p0.X, p0.Y}, f64.Vec2{p1.X, p1.Y})
+		}
+
+	case CMD_CIRCLE:
+		r = pointBounds(math.Abs(a[2])+s.PointSize+2, f64.Vec2{a[0], a[1]})
+
+	case CMD_TRIANGLE3:
+		var ps []f64.Vec2
+		for _, v := range cmd.verts {
+			var q f64.Vec4
+			if st.projected {
+				q = c.clipPoint(v.Pos)
+			} else {
+				q = m.Transform(f64.Vec4{v.Pos.X, v.Pos.Y, v.Pos.Z, 1})
+			}
+			switch {
+			case q.W > 0 && !st.projected:
+				ps = append(ps, f64.Vec2{q.X / q.W, q.Y / q.W})
+			case q.W > 0:
+				ps = append(ps, c.toScreen(q).XYZ().XY())
+			case st.projected:
+				// clipped against the near plane, it can be anywhere
+				return c.bounds.Intersect(st.clip.rect)
+			default:
+				return image.Rectangle{}
+			}
+		}
+		r = pointBounds(2, ps...)
+
+	case CMD_FILL_PATH, CMD_STROKE_PATH:
+		// the curves are inside the hull of their control points
+		var ps []f64.Vec2
+		for _, o := range cmd.path.ops {
+			for _, p := range o.pts {
+				ps = append(ps, m.Transform3(f64.Vec3{p.X, p.Y, 0}).XY())
+			}
+		}
+		pad := 2.0
+		if cmd.op == CMD_STROKE_PATH {
+			k := math.Sqrt(math.Abs(m[0][0]*m[1][1] - m[0][1]*m[1][0]))
+			limit := s.MiterLimit
+			if limit <= 0 {
+				limit = 4
+			}
+			pad += s.LineWidth * k / 2 * math.Max(limit, 1.5)
+		}
+		r = pointBounds(pad, ps...)
+
+	case CMD_BEGIN_LAYER:
+		// the layer is the size of the clip
+		return st.clip.rect.Intersect(c.bounds)
+
+	default:
+		// clearing ignores the clip
+		return c.bounds
+	}
+	return r.Intersect(st.clip.rect).Intersect(c.bounds)
+}
+
+func pointBounds(pad float64, ps ...f64.Vec2) image.Rectangle {
+	if len(ps) == 0 {
+		return image.Rectangle{}
+	}
+	lo, hi := ps[0], ps[0]
+	for _, p := range ps[1:] {
+		lo.X, lo.Y = math.Min(lo.X, p.X), math.Min(lo.Y, p.Y)
+		hi.X, hi.Y = math.Max(hi.X, p.X), math.Max(hi.Y, p.Y)
+	}
+	if math.IsNaN(lo.X + lo.Y + hi.X + hi.Y) {
+		return image.Rectangle{}
+	}
+	lo.X, lo.Y = f64.Clamp(lo.X-pad, -1<<30, 1<<30), f64.Clamp(lo.Y-pad, -1<<30, 1<<30)
+	hi.X, hi.Y = f64.Clamp(hi.X+pad, -1<<30, 1<<30), f64.Clamp(hi.Y+pad, -1<<30, 1<<30)
+	return image.Rect(int(math.Floor(lo.X)), int(math.Floor(lo.Y)), int(math.Ceil(hi.X))+1, int(math.Ceil(hi.Y))+1)
+}
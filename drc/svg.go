@@ -0,0 +1,168 @@
+package drc
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+)
+
+type svgWriter struct {
+	w      *bufio.Writer
+	bounds image.Rectangle
+
+	// ids of the clip paths already written
+	clips map[clipKey]string
+}
+
+// clipKey picks a clip, every clip path makes a new mask
+type clipKey struct {
+	rect image.Rectangle
+	mask *image.Alpha
+}
+
+// SVG writes the recording as an svg image with
+// the bounds as the view box in pixels
+func (r *Recording) SVG(w io.Writer) error {
+	s := &svgWriter{
+		w:      bufio.NewWriter(w),
+		bounds: r.Bounds,
+		clips:  make(map[clipKey]string),
+	}
+	b := r.Bounds
+	fmt.Fprintf(s.w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"%d %d %d %d\">\n",
+		b.Dx(), b.Dy(), b.Min.X, b.Min.Y, b.Dx(), b.Dy())
+	r.vectorize(s)
+	fmt.Fprintf(s.w, "</svg>\n")
+	return s.w.Flush()
+}
+
+func (s *svgWriter) fill(p *Path, rule int, col color.RGBA, blend int, cl *clip) {
+	if len(p.ops) == 0 || col.A == 0 {
+		return
+	}
+	attr := s.clip(cl)
+	r, g, b, a := straight(col)
+	fmt.Fprintf(s.w, "<path d=\"%s\" fill=\"#%02x%02x%02x\"", svgPath(p), r, g, b)
+	if a < 1 {
+		fmt.Fprintf(s.w, " fill-opacity=\"%s\"", num(a))
+	}
+	if rule == FILL_EVENODD {
+		fmt.Fprintf(s.w, " fill-rule=\"evenodd\"")
+	}
+	fmt.Fprintf(s.w, "%s%s/>\n", svgBlend(blend), attr)
+}
+
+func (s *svgWriter) stroke(p *Path, o *imageutil.StrokeOptions, col color.RGBA, blend int, cl *clip) {
+	if len(p.ops) == 0 || col.A == 0 || o.Width <= 0 {
+		return
+	}
+	attr := s.clip(cl)
+	r, g, b, a := straight(col)
+	fmt.Fprintf(s.w, "<path d=\"%s\" fill=\"none\" stroke=\"#%02x%02x%02x\" stroke-width=\"%s\"", svgPath(p), r, g, b, num(o.Width))
+	if a < 1 {
+		fmt.Fprintf(s.w, " stroke-opacity=\"%s\"", num(a))
+	}
+	switch o.Join {
+	case JOIN_ROUND:
+		fmt.Fprintf(s.w, " stroke-linejoin=\"round\"")
+	case JOIN_BEVEL:
+		fmt.Fprintf(s.w, " stroke-linejoin=\"bevel\"")
+	default:
+		if o.MiterLimit > 0 {
+			fmt.Fprintf(s.w, " stroke-miterlimit=\"%s\"", num(max(o.MiterLimit, 1)))
+		}
+	}
+	switch o.Cap {
+	case CAP_ROUND:
+		fmt.Fprintf(s.w, " stroke-linecap=\"round\"")
+	case CAP_SQUARE:
+		fmt.Fprintf(s.w, " stroke-linecap=\"square\"")
+	}
+	if d := dashed(o); d != nil {
+		var l []string
+		for _, v := range d {
+			l = append(l, num(v))
+		}
+		fmt.Fprintf(s.w, " stroke-dasharray=\"%s\"", strings.Join(l, " "))
+		if o.DashOffset != 0 {
+			fmt.Fprintf(s.w, " stroke-dashoffset=\"%s\"", num(o.DashOffset))
+		}
+	}
+	fmt.Fprintf(s.w, "%s%s/>\n", svgBlend(blend), attr)
+}
+
+func (s *svgWriter) beginLayer(opacity float64, blend int) {
+	fmt.Fprintf(s.w, "<g opacity=\"%s\" style=\"isolation:isolate", num(opacity))
+	if name := blendNames[blend]; name != "" {
+		fmt.Fprintf(s.w, ";mix-blend-mode:%s", name)
+	}
+	fmt.Fprintf(s.w, "\">\n")
+}
+
+func (s *svgWriter) endLayer() {
+	fmt.Fprintf(s.w, "</g>\n")
+}
+
+// clip writes the clip paths of the clip the first time it
+// is used and returns the attribute that refers to them, the
+// paths are chained so the last one clips to all of them
+func (s *svgWriter) clip(cl *clip) string {
+	if !cl.clipped(s.bounds) {
+		return ""
+	}
+	k := clipKey{cl.rect, cl.mask}
+	if id, ok := s.clips[k]; ok {
+		return fmt.Sprintf(" clip-path=\"url(#%s)\"", id)
+	}
+
+	id := fmt.Sprintf("clip%d", len(s.clips))
+	r := cl.rect
+	fmt.Fprintf(s.w, "<clipPath id=\"%s-0\"><rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"/></clipPath>\n",
+		id, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	for i, cp := range cl.paths {
+		fmt.Fprintf(s.w, "<clipPath id=\"%s-%d\" clip-path=\"url(#%s-%d)\"><path d=\"%s\"", id, i+1, id, i, svgPath(cp.path))
+		if cp.rule == FILL_EVENODD {
+			fmt.Fprintf(s.w, " clip-rule=\"evenodd\"")
+		}
+		fmt.Fprintf(s.w, "/></clipPath>\n")
+	}
+	id = fmt.Sprintf("%s-%d", id, len(cl.paths))
+	s.clips[k] = id
+	return fmt.Sprintf(" clip-path=\"url(#%s)\"", id)
+}
+
+func svgBlend(mode int) string {
+	if name := blendNames[mode]; name != "" {
+		return fmt.Sprintf(" style=\"mix-blend-mode:%s\"", name)
+	}
+	return ""
+}
+
+// svgPath returns the path data of a path in pixels
+func svgPath(p *Path) string {
+	var b strings.Builder
+	for _, o := range p.ops {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		q := o.pts
+		switch o.op {
+		case PATH_MOVE:
+			fmt.Fprintf(&b, "M%s %s", num(q[0].X), num(q[0].Y))
+		case PATH_LINE:
+			fmt.Fprintf(&b, "L%s %s", num(q[0].X), num(q[0].Y))
+		case PATH_QUAD:
+			fmt.Fprintf(&b, "Q%s %s %s %s", num(q[0].X), num(q[0].Y), num(q[1].X), num(q[1].Y))
+		case PATH_CUBIC:
+			fmt.Fprintf(&b, "C%s %s %s %s %s %s", num(q[0].X), num(q[0].Y), num(q[1].X), num(q[1].Y), num(q[2].X), num(q[2].Y))
+		case PATH_CLOSE:
+			b.WriteByte('Z')
+		}
+	}
+	return b.String()
+}
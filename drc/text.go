@@ -0,0 +1,403 @@
+package drc
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/image/ttf"
+	"github.com/qeedquan/go-media/math/f64"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ALIGN_LEFT = iota
+	ALIGN_CENTER
+	ALIGN_RIGHT
+)
+
+// where the y of the text is relative to the first line
+const (
+	BASELINE_ALPHABETIC = iota
+	BASELINE_TOP
+	BASELINE_MIDDLE
+	BASELINE_BOTTOM
+)
+
+// Font is a truetype font with a cache of the outlines of the
+// glyphs and of their coverage at the sizes they were drawn at,
+// it is safe to use from multiple goroutines
+type Font struct {
+	mu     sync.Mutex
+	font   *sfnt.Font
+	buf    sfnt.Buffer
+	ppem   fixed.Int26_6
+	units  float64
+	gpos   *gposKern
+	glyphs map[rune]*glyph
+	masks  map[maskKey]*glyphMask
+
+	// metrics in units of the em
+	ascent, descent, height float64
+}
+
+// glyph is the outline of a glyph in units of the em with y down
+type glyph struct {
+	index   sfnt.GlyphIndex
+	advance float64
+	path    Path
+}
+
+// maskKey picks a glyph at a size and at a position
+// inside of a pixel in quarters of a pixel
+type maskKey struct {
+	index  sfnt.GlyphIndex
+	size   float64
+	fx, fy int
+}
+
+// glyphMask is the coverage of a glyph relative to the
+// pixel the origin of the glyph is in, nil for blanks
+type glyphMask struct {
+	mask *image.Alpha
+}
+
+var defaultFont struct {
+	sync.Once
+	font *Font
+}
+
+// DefaultFont is the regular roboto face
+func DefaultFont() *Font {
+	defaultFont.Do(func() {
+		f, err := NewFont(ttf.Roboto.Normal)
+		if err != nil {
+			panic(err)
+		}
+		defaultFont.font = f
+	})
+	return defaultFont.font
+}
+
+// NewFont parses truetype font data, the
+// families in image/ttf can be used directly
+func NewFont(data []byte) (*Font, error) {
+	sf, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("drc: failed to parse font: %v", err)
+	}
+
+	f := &Font{
+		font:   sf,
+		ppem:   fixed.I(int(sf.UnitsPerEm())),
+		units:  float64(sf.UnitsPerEm()),
+		gpos:   parseGPOSKern(data),
+		glyphs: make(map[rune]*glyph),
+		masks:  make(map[maskKey]*glyphMask),
+	}
+	m, err := sf.Metrics(&f.buf, f.ppem, font.HintingNone)
+	if err != nil {
+		return nil, fmt.Errorf("drc: failed to read font metrics: %v", err)
+	}
+	f.ascent = f.fromFixed(m.Ascent)
+	f.descent = f.fromFixed(m.Descent)
+	f.height = f.fromFixed(m.Height)
+	return f, nil
+}
+
+// Ascent, Descent and LineHeight are the metrics of the font
+// at a size in pixels, the descent is positive below the baseline
+func (f *Font) Ascent(size float64) float64     { return f.ascent * size }
+func (f *Font) Descent(size float64) float64    { return f.descent * size }
+func (f *Font) LineHeight(size float64) float64 { return f.height * size }
+
+func (f *Font) fromFixed(x fixed.Int26_6) float64 {
+	return float64(x) / 64 / f.units
+}
+
+// glyph returns the cached outline of the rune,
+// the font must be locked
+func (f *Font) glyph(r rune) *glyph {
+	if g := f.glyphs[r]; g != nil {
+		return g
+	}
+
+	g := &glyph{}
+	f.glyphs[r] = g
+	x, err := f.font.GlyphIndex(&f.buf, r)
+	if err != nil {
+		return g
+	}
+	g.index = x
+	if adv, err := f.font.GlyphAdvance(&f.buf, x, f.ppem, font.HintingNone); err == nil {
+		g.advance = f.fromFixed(adv)
+	}
+
+	segs, err := f.font.LoadGlyph(&f.buf, x, f.ppem, nil)
+	if err != nil {
+		return g
+	}
+	pt := func(p fixed.Point26_6) (float64, float64) {
+		return f.fromFixed(p.X), f.fromFixed(p.Y)
+	}
+	for _, s := range segs {
+		x0, y0 := pt(s.Args[0])
+		x1, y1 := pt(s.Args[1])
+		x2, y2 := pt(s.Args[2])
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			g.path.Close()
+			g.path.MoveTo(x0, y0)
+		case sfnt.SegmentOpLineTo:
+			g.path.LineTo(x0, y0)
+		case sfnt.SegmentOpQuadTo:
+			g.path.QuadTo(x0, y0, x1, y1)
+		case sfnt.SegmentOpCubeTo:
+			g.path.CubicTo(x0, y0, x1, y1, x2, y2)
+		}
+	}
+	g.path.Close()
+	return g
+}
+
+// kern returns the kerning between two glyphs from the gpos
+// table or the legacy kern table, the font must be locked
+func (f *Font) kern(a, b *glyph) float64 {
+	if f.gpos != nil {
+		return float64(f.gpos.kern(a.index, b.index)) / f.units
+	}
+	k, err := f.font.Kern(&f.buf, a.index, b.index, f.ppem, font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return f.fromFixed(k)
+}
+
+// mask returns the coverage of a glyph at a size placed at p, the
+// font is locked only to look up and store the mask so glyphs can
+// be rasterized by many goroutines at once
+func (f *Font) mask(g *glyph, size float64, p f64.Vec2) (*glyphMask, image.Point) {
+	ix, iy := math.Floor(p.X), math.Floor(p.Y)
+	k := maskKey{
+		index: g.index,
+		size:  size,
+		fx:    int((p.X - ix) * 4),
+		fy:    int((p.Y - iy) * 4),
+	}
+	org := image.Pt(int(ix), int(iy))
+	f.mu.Lock()
+	m := f.masks[k]
+	f.mu.Unlock()
+	if m != nil {
+		return m, org
+	}
+
+	var mat f64.Mat4
+	mat.Scale(size, size, 1)
+	mat[0][3] = float64(k.fx) / 4
+	mat[1][3] = float64(k.fy) / 4
+	ip := g.path.flatten(&mat)
+
+	// the bounds are padded for the curves leaving the hull
+	b := image.Rect(
+		int(math.Floor(-size)), int(math.Floor(-size*2)),
+		int(math.Ceil(g.advance*size+size))+1, int(math.Ceil(size*2))+1,
+	)
+	a := image.NewAlpha(b)
+	lo, hi := b.Max, b.Min
+	imageutil.RasterizePath(ip, FILL_NONZERO, b, func(x, y int, v float64) {
+		a.Pix[a.PixOffset(x, y)] = uint8(math.Min(v, 1)*255 + .5)
+		lo.X, lo.Y = min(lo.X, x), min(lo.Y, y)
+		hi.X, hi.Y = max(hi.X, x+1), max(hi.Y, y+1)
+	})
+
+	m = &glyphMask{}
+	if r := (image.Rectangle{lo, hi}); !r.Empty() {
+		m.mask = a.SubImage(r).(*image.Alpha)
+	}
+
+	// keep the mask of whoever stored it first
+	f.mu.Lock()
+	if mm := f.masks[k]; mm != nil {
+		m = mm
+	} else {
+		f.masks[k] = m
+	}
+	f.mu.Unlock()
+	return m, org
+}
+
+// SetFont sets the font and its size in pixels, a nil font is the default font
+func (c *Context) SetFont(f *Font, size float64) {
+	s := &c.styles[len(c.styles)-1]
+	s.Font = f
+	s.TextSize = size
+}
+
+func (c *Context) SetTextAlign(align, baseline int) {
+	s := &c.styles[len(c.styles)-1]
+	s.TextAlign = align
+	s.TextBaseline = baseline
+}
+
+// font returns the font and size of the style
+func (c *Context) font() (*Font, float64) {
+	s := &c.styles[len(c.styles)-1]
+	f := s.Font
+	if f == nil {
+		f = DefaultFont()
+	}
+	size := s.TextSize
+	if size <= 0 {
+		size = 12
+	}
+	return f, size
+}
+
+// lineHeight is the distance between baselines
+func (c *Context) lineHeight(f *Font, size float64) float64 {
+	s := &c.styles[len(c.styles)-1]
+	if s.Leading > 0 {
+		return s.Leading
+	}
+	return f.LineHeight(size)
+}
+
+// TextWidth returns the width of the widest line of the text
+func (c *Context) TextWidth(text string) float64 {
+	f, size := c.font()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := 0.0
+	for _, l := range strings.Split(text, "\n") {
+		w = math.Max(w, f.lineWidth(l)*size)
+	}
+	return w
+}
+
+// lineWidth is the advance of a line in units
+// of the em, the font must be locked
+func (f *Font) lineWidth(line string) float64 {
+	w := 0.0
+	var prev *glyph
+	for _, r := range line {
+		g := f.glyph(r)
+		if prev != nil {
+			w += f.kern(prev, g)
+		}
+		w += g.advance
+		prev = g
+	}
+	return w
+}
+
+// Text draws text with the fill color of the style, the lines
+// are split on newlines and placed by the alignment and baseline
+// of the style relative to x and y, the text is transformed by
+// the current matrix
+func (c *Context) Text(text string, x, y float64) {
+	if c.record(command{op: CMD_TEXT, args: [6]float64{x, y}, text: text}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	f, size := c.font()
+
+	// glyphs under a translation are drawn from the mask cache,
+	// anything else fills the outlines through the transform
+	m := c.transforms[len(c.transforms)-1]
+	translated := m[0][0] == 1 && m[0][1] == 0 && m[1][0] == 0 && m[1][1] == 1 &&
+		m[3][0] == 0 && m[3][1] == 0 && m[3][2] == 0 && m[3][3] == 1
+
+	for _, pg := range c.layoutText(f, size, text, x, y) {
+		if translated {
+			gm, org := f.mask(pg.glyph, size, f64.Vec2{pg.x + m[0][3], pg.y + m[1][3]})
+			if gm.mask != nil {
+				c.drawMask(gm.mask, org)
+			}
+		} else {
+			gt := glyphMatrix(&m, size, pg.x, pg.y)
+			c.fillPath(&pg.glyph.path, &gt, FILL_NONZERO, s.Fill)
+		}
+	}
+}
+
+// placedGlyph is a glyph and the position of its origin before the transform
+type placedGlyph struct {
+	*glyph
+	x, y float64
+}
+
+// layoutText places every glyph of the text, the font is locked
+// while the glyphs are looked up and the outlines do not change
+// after, so they can be drawn without it
+func (c *Context) layoutText(f *Font, size float64, text string, x, y float64) []placedGlyph {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := &c.styles[len(c.styles)-1]
+	lines := strings.Split(text, "\n")
+	lh := c.lineHeight(f, size)
+
+	switch s.TextBaseline {
+	case BASELINE_TOP:
+		y += f.Ascent(size)
+	case BASELINE_MIDDLE:
+		y += (f.Ascent(size) - f.Descent(size) - lh*float64(len(lines)-1)) / 2
+	case BASELINE_BOTTOM:
+		y -= f.Descent(size) + lh*float64(len(lines)-1)
+	}
+
+	var glyphs []placedGlyph
+	for i, l := range lines {
+		px, py := x, y+float64(i)*lh
+		switch s.TextAlign {
+		case ALIGN_CENTER:
+			px -= f.lineWidth(l) * size / 2
+		case ALIGN_RIGHT:
+			px -= f.lineWidth(l) * size
+		}
+
+		var prev *glyph
+		for _, r := range l {
+			g := f.glyph(r)
+			if prev != nil {
+				px += f.kern(prev, g) * size
+			}
+			prev = g
+			glyphs = append(glyphs, placedGlyph{g, px, py})
+			px += g.advance * size
+		}
+	}
+	return glyphs
+}
+
+// glyphMatrix takes the outline of a glyph in units of
+// the em to its place at px, py under the matrix
+func glyphMatrix(m *f64.Mat4, size, px, py float64) f64.Mat4 {
+	var gt, t f64.Mat4
+	t.Translate(px, py, 0)
+	t.Mul(&t, new(f64.Mat4).Scale(size, size, 1))
+	gt.Mul(m, &t)
+	return gt
+}
+
+// drawMask covers the pixels with the fill color by the
+// coverage of the mask moved by the offset
+func (c *Context) drawMask(a *image.Alpha, off image.Point) {
+	s := &c.styles[len(c.styles)-1]
+	r := a.Rect.Add(off).Intersect(c.drawRect())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if v := a.Pix[a.PixOffset(x-off.X, y-off.Y)]; v != 0 {
+				c.coverPixel(x, y, 1, s.Fill, float64(v)/255)
+			}
+		}
+	}
+}
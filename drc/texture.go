@@ -0,0 +1,113 @@
+package drc
+
+import (
+	"image"
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	FILTER_NEAREST = iota
+	FILTER_BILINEAR
+)
+
+const (
+	WRAP_REPEAT = iota
+	WRAP_CLAMP
+	WRAP_MIRROR
+)
+
+// Texture is an image sampled with texture coordinates,
+// (0, 0) is the top left of the image and (1, 1) the
+// bottom right
+type Texture struct {
+	Image  *image.RGBA
+	Filter int
+	Wrap   int
+}
+
+func NewTexture(m *image.RGBA) *Texture {
+	return &Texture{Image: m, Filter: FILTER_BILINEAR}
+}
+
+// Sample returns the premultiplied color
+// of the texture at uv in [0, 1]
+func (t *Texture) Sample(uv f64.Vec2) f64.Vec4 {
+	if t == nil || t.Image == nil {
+		return f64.Vec4{1, 1, 1, 1}
+	}
+	r := t.Image.Bounds()
+	w, h := r.Dx(), r.Dy()
+	if w == 0 || h == 0 {
+		return f64.Vec4{}
+	}
+
+	x := uv.X*float64(w) - 0.5
+	y := uv.Y*float64(h) - 0.5
+	if t.Filter == FILTER_NEAREST {
+		return t.texel(int(math.Floor(x+0.5)), int(math.Floor(y+0.5)))
+	}
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	c00 := t.texel(ix, iy)
+	c10 := t.texel(ix+1, iy)
+	c01 := t.texel(ix, iy+1)
+	c11 := t.texel(ix+1, iy+1)
+	return lerp4(fy, lerp4(fx, c00, c10), lerp4(fx, c01, c11))
+}
+
+func lerp4(t float64, a, b f64.Vec4) f64.Vec4 {
+	return addScale4(a.Scale(1-t), b, t)
+}
+
+// addScale4 is p + q*k on all four components,
+// f64.Vec4.AddScale keeps the w of p
+func addScale4(p, q f64.Vec4, k float64) f64.Vec4 {
+	return f64.Vec4{p.X + q.X*k, p.Y + q.Y*k, p.Z + q.Z*k, p.W + q.W*k}
+}
+
+// texel returns the pixel at x, y relative to the
+// top left of the image with the wrapping applied
+func (t *Texture) texel(x, y int) f64.Vec4 {
+	r := t.Image.Bounds()
+	x = wrap(x, r.Dx(), t.Wrap)
+	y = wrap(y, r.Dy(), t.Wrap)
+	i := t.Image.PixOffset(r.Min.X+x, r.Min.Y+y)
+	p := t.Image.Pix[i : i+4 : i+4]
+	return f64.Vec4{
+		float64(p[0]) / 255,
+		float64(p[1]) / 255,
+		float64(p[2]) / 255,
+		float64(p[3]) / 255,
+	}
+}
+
+func wrap(x, n, mode int) int {
+	switch mode {
+	case WRAP_CLAMP:
+		if x < 0 {
+			return 0
+		}
+		if x >= n {
+			return n - 1
+		}
+		return x
+	case WRAP_MIRROR:
+		x %= 2 * n
+		if x < 0 {
+			x += 2 * n
+		}
+		if x >= n {
+			x = 2*n - 1 - x
+		}
+		return x
+	}
+	x %= n
+	if x < 0 {
+		x += n
+	}
+	return x
+}
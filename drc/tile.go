@@ -0,0 +1,75 @@
+package drc
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// SetTiled defers drawing until Flush which draws the commands in
+// tiles of size pixels on every cpu, the image is the same as when
+// drawing right away, shaders have to be safe to call concurrently,
+// a size of zero flushes and draws right away again
+func (c *Context) SetTiled(size int) {
+	c.Flush()
+	c.tileSize = size
+	c.deferred = size > 0
+}
+
+// Flush draws the deferred commands into the framebuffer
+func (c *Context) Flush() {
+	cmds := c.commands
+	c.commands = nil
+	if len(cmds) == 0 {
+		return
+	}
+
+	// bin the commands into the tiles they overlap
+	size := c.tileSize
+	r := c.bounds
+	nx := (r.Dx() + size - 1) / size
+	ny := (r.Dy() + size - 1) / size
+	bins := make([][]command, nx*ny)
+	for _, cmd := range cmds {
+		b := cmd.bounds.Intersect(r)
+		if b.Empty() {
+			continue
+		}
+		x0, y0 := (b.Min.X-r.Min.X)/size, (b.Min.Y-r.Min.Y)/size
+		x1, y1 := (b.Max.X-r.Min.X-1)/size, (b.Max.Y-r.Min.Y-1)/size
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				bins[y*nx+x] = append(bins[y*nx+x], cmd)
+			}
+		}
+	}
+
+	tiles := make(chan int, len(bins))
+	for i := range bins {
+		if len(bins[i]) > 0 {
+			tiles <- i
+		}
+	}
+	close(tiles)
+
+	var wg sync.WaitGroup
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := &Context{
+				zbuffer: c.zbuffer,
+				bounds:  c.bounds,
+			}
+			for i := range tiles {
+				tr := image.Rect(i%nx*size, i/nx*size, (i%nx+1)*size, (i/nx+1)*size)
+				tr = tr.Add(r.Min).Intersect(r)
+				t.framebuffer = c.framebuffer
+				t.layers = t.layers[:0]
+				t.tile = &tr
+				t.replay(bins[i])
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,283 @@
+package drc
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/qeedquan/go-media/image/obj"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// faces dropped by culling, front faces wind
+// counter-clockwise as seen on the image
+const (
+	CULL_NONE = iota
+	CULL_BACK
+	CULL_FRONT
+)
+
+// Vertex is a corner of a triangle, the color is premultiplied
+// in [0, 1] and the uv coordinates index the texture
+type Vertex struct {
+	Pos    f64.Vec3
+	Color  f64.Vec4
+	UV     f64.Vec2
+	Normal f64.Vec3
+}
+
+// Fragment is a pixel covered by a triangle with the
+// vertex attributes interpolated at its center
+type Fragment struct {
+	X, Y   int
+	Depth  float64
+	Color  f64.Vec4
+	UV     f64.Vec2
+	Normal f64.Vec3
+	Front  bool
+}
+
+// rasterVertex is a vertex in pixel coordinates, w holds
+// the reciprocal of the clip w for perspective correction
+type rasterVertex struct {
+	Vertex
+	pos f64.Vec4
+}
+
+// Triangle draws a 2D triangle with the fill and stroke of the style
+func (c *Context) Triangle(x0, y0, x1, y1, x2, y2 int) {
+	if c.record(command{op: CMD_TRIANGLE, args: [6]float64{
+		float64(x0), float64(y0), float64(x1), float64(y1), float64(x2), float64(y2),
+	}}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	if !s.NoFill {
+		col := f64.Vec4{
+			float64(s.Fill.R) / 255,
+			float64(s.Fill.G) / 255,
+			float64(s.Fill.B) / 255,
+			float64(s.Fill.A) / 255,
+		}
+		var p [3]rasterVertex
+		for i, v := range [3][2]int{{x0, y0}, {x1, y1}, {x2, y2}} {
+			p[i].Color = col
+			p[i].pos = f64.Vec4{float64(v[0]) + 0.5, float64(v[1]) + 0.5, 1, 1}
+		}
+		c.rasterTriangle(p, c.drawRect(), CULL_NONE, nil)
+	}
+	if !s.NoStroke {
+		c.Line(x0, y0, x1, y1)
+		c.Line(x1, y1, x2, y2)
+		c.Line(x2, y2, x0, y0)
+	}
+}
+
+// Triangle3 draws a triangle with the vertices transformed by the
+// current matrix into pixel coordinates, the depth after the divide
+// is used for the depth test, with a projection set the vertices go
+// through the vertex pipeline and are clipped to the view volume
+func (c *Context) Triangle3(v0, v1, v2 Vertex) {
+	if c.record(command{op: CMD_TRIANGLE3, verts: [3]Vertex{v0, v1, v2}}) {
+		return
+	}
+
+	s := &c.styles[len(c.styles)-1]
+	if c.projected {
+		c.clipTriangle(v0, v1, v2, s.Cull, c.shader())
+		return
+	}
+
+	p, ok := c.divideTriangle(v0, v1, v2)
+	if !ok {
+		return
+	}
+	c.rasterTriangle(p, c.drawRect(), s.Cull, c.shader())
+}
+
+// divideTriangle transforms a triangle by the current matrix and
+// divides it into pixel coordinates, nothing is clipped so it fails
+// if a vertex is behind the eye
+func (c *Context) divideTriangle(v0, v1, v2 Vertex) (p [3]rasterVertex, ok bool) {
+	m := c.transforms[len(c.transforms)-1]
+	for i, v := range [3]Vertex{v0, v1, v2} {
+		q := m.Transform(f64.Vec4{v.Pos.X, v.Pos.Y, v.Pos.Z, 1})
+		if q.W <= 0 {
+			return p, false
+		}
+		w := 1 / q.W
+		p[i] = rasterVertex{v, f64.Vec4{q.X * w, q.Y * w, q.Z * w, w}}
+	}
+	return p, true
+}
+
+// Mesh draws the triangles of the vertices picked by the
+// indices three at a time, nil indices takes the vertices
+// in order
+func (c *Context) Mesh(vs []Vertex, indices []int) {
+	if indices == nil {
+		for i := 0; i+2 < len(vs); i += 3 {
+			c.Triangle3(vs[i], vs[i+1], vs[i+2])
+		}
+		return
+	}
+	for i := 0; i+2 < len(indices); i += 3 {
+		c.Triangle3(vs[indices[i]], vs[indices[i+1]], vs[indices[i+2]])
+	}
+}
+
+// Model draws the faces of a model, vertices without a color are
+// white and the texture coordinates are flipped to have the origin
+// at the bottom left as obj files expect
+func (c *Context) Model(m *obj.Model) {
+	for _, f := range m.Faces {
+		var t [3]Vertex
+		for i := range f {
+			v := &t[i]
+			v.Color = f64.Vec4{1, 1, 1, 1}
+			if n := modelIndex(f[i][0], len(m.Verts)); n >= 0 {
+				v.Pos = m.Verts[n].XYZ()
+				if n < len(m.Colors) {
+					v.Color = m.Colors[n]
+				}
+			}
+			if n := modelIndex(f[i][1], len(m.Coords)); n >= 0 {
+				v.UV = f64.Vec2{m.Coords[n].X, 1 - m.Coords[n].Y}
+			}
+			if n := modelIndex(f[i][2], len(m.Normals)); n >= 0 {
+				v.Normal = m.Normals[n].XYZ()
+			}
+		}
+		c.Triangle3(t[0], t[1], t[2])
+	}
+}
+
+// modelIndex converts the one based obj index with negative
+// values relative to the end to zero based, -1 if absent
+func modelIndex(i, n int) int {
+	switch {
+	case i > 0:
+		i--
+	case i < 0:
+		i += n
+	default:
+		return -1
+	}
+	if i < 0 || i >= n {
+		return -1
+	}
+	return i
+}
+
+// shader returns the shader of the style or the default
+// one that modulates the vertex color with the texture
+func (c *Context) shader() func(f *Fragment) bool {
+	s := &c.styles[len(c.styles)-1]
+	if s.Shader != nil {
+		return s.Shader
+	}
+	t := s.Texture
+	if t == nil {
+		return nil
+	}
+	return func(f *Fragment) bool {
+		f.Color = f.Color.Scale4(t.Sample(f.UV))
+		return true
+	}
+}
+
+// rasterTriangle fills the pixels inside the clip rectangle whose
+// centers are covered by the triangle, pixels on a shared edge
+// belong to the triangle that has it as a top or left edge so
+// they are drawn exactly once
+func (c *Context) rasterTriangle(p [3]rasterVertex, clip image.Rectangle, cull int, shade func(f *Fragment) bool) {
+	area := edge(p[0].pos, p[1].pos, p[2].pos)
+	if area == 0 || math.IsNaN(area) {
+		return
+	}
+
+	// y points down so a positive area winds clockwise on the image
+	front := area < 0
+	switch {
+	case cull == CULL_BACK && !front,
+		cull == CULL_FRONT && front:
+		return
+	}
+	if area < 0 {
+		p[1], p[2] = p[2], p[1]
+		area = -area
+	}
+
+	x0 := math.Min(p[0].pos.X, math.Min(p[1].pos.X, p[2].pos.X))
+	y0 := math.Min(p[0].pos.Y, math.Min(p[1].pos.Y, p[2].pos.Y))
+	x1 := math.Max(p[0].pos.X, math.Max(p[1].pos.X, p[2].pos.X))
+	y1 := math.Max(p[0].pos.Y, math.Max(p[1].pos.Y, p[2].pos.Y))
+	fr := c.bounds
+	r := image.Rect(
+		int(math.Floor(x0)), int(math.Floor(y0)),
+		int(math.Ceil(x1))+1, int(math.Ceil(y1))+1,
+	).Intersect(clip).Intersect(c.drawRect())
+
+	var topLeft [3]bool
+	for i := range p {
+		a, b := p[(i+1)%3].pos, p[(i+2)%3].pos
+		topLeft[i] = (a.Y == b.Y && b.X > a.X) || b.Y < a.Y
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			q := f64.Vec4{float64(x) + 0.5, float64(y) + 0.5, 0, 0}
+
+			var b [3]float64
+			inside := true
+			for i := range p {
+				b[i] = edge(p[(i+1)%3].pos, p[(i+2)%3].pos, q)
+				if b[i] < 0 || (b[i] == 0 && !topLeft[i]) {
+					inside = false
+					break
+				}
+			}
+			if !inside {
+				continue
+			}
+
+			// depth is linear on the screen, the attributes are
+			// linear in eye space and are interpolated over w
+			var z, iw float64
+			for i := range p {
+				b[i] /= area
+				z += b[i] * p[i].pos.Z
+				iw += b[i] * p[i].pos.W
+			}
+			if n := (y-fr.Min.Y)*fr.Dx() + x - fr.Min.X; z > c.zbuffer[n] {
+				continue
+			}
+
+			f := Fragment{X: x, Y: y, Depth: z, Front: front}
+			for i := range p {
+				k := b[i] * p[i].pos.W / iw
+				f.Color = addScale4(f.Color, p[i].Color, k)
+				f.UV = f.UV.AddScale(p[i].UV, k)
+				f.Normal = f.Normal.AddScale(p[i].Normal, k)
+			}
+			f.Normal = f.Normal.Normalize()
+
+			if shade != nil && !shade(&f) {
+				continue
+			}
+			c.pixel(x, y, z, color.RGBA{
+				f64.Clamp8(f.Color.X*255, 0, 255),
+				f64.Clamp8(f.Color.Y*255, 0, 255),
+				f64.Clamp8(f.Color.Z*255, 0, 255),
+				f64.Clamp8(f.Color.W*255, 0, 255),
+			})
+		}
+	}
+}
+
+// edge is twice the signed area of the triangle abc,
+// it is positive when c is to the right of ab
+func edge(a, b, c f64.Vec4) float64 {
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
@@ -0,0 +1,266 @@
+package drc
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// vectorWriter draws the commands of a recording as paths in pixels,
+// the clip of every path is given with it
+type vectorWriter interface {
+	fill(p *Path, rule int, col color.RGBA, blend int, cl *clip)
+	stroke(p *Path, o *imageutil.StrokeOptions, col color.RGBA, blend int, cl *clip)
+	beginLayer(opacity float64, blend int)
+	endLayer()
+}
+
+// vectorize converts the commands of the recording into paths in
+// pixels, points and pixel lines become squares and strokes as wide
+// as the pixels they cover, triangles are filled with the average of
+// their vertex colors as textures, shaders and the depth test have no
+// vector form
+func (r *Recording) vectorize(w vectorWriter) {
+	c := &Context{bounds: r.Bounds}
+	layers := 0
+	for i := range r.commands {
+		cmd := &r.commands[i]
+		c.setState(cmd.state)
+		s := &c.styles[0]
+		m := &c.transforms[0]
+		cl := &c.clips[0]
+		a := &cmd.args
+
+		switch cmd.op {
+		case CMD_CLEAR:
+			var p Path
+			b := r.Bounds
+			p.Rect(float64(b.Min.X), float64(b.Min.Y), float64(b.Dx()), float64(b.Dy()))
+			w.fill(&p, FILL_NONZERO, s.Background, BLEND_SRC_OVER, &clip{rect: b})
+
+		case CMD_POINT:
+			x, y := a[0], a[1]
+			if c.projected {
+				q := c.clipPoint(f64.Vec3{a[0], a[1], a[2]})
+				if !insideClip(q) {
+					continue
+				}
+				p := c.toScreen(q)
+				x, y = p.X, p.Y
+			}
+			h := math.Floor(s.PointSize / 2)
+			x, y = math.Floor(x+0.5), math.Floor(y+0.5)
+			var p Path
+			p.Rect(x-h, y-h, 2*h+1, 2*h+1)
+			w.fill(&p, FILL_NONZERO, s.Stroke, s.Blend, cl)
+
+		case CMD_LINE:
+			p := linePath(a[0]+0.5, a[1]+0.5, a[2]+0.5, a[3]+0.5)
+			w.stroke(p, c.pixelStroke(math.Max(s.LineWidth, 1)), s.Stroke, s.Blend, cl)
+
+		case CMD_LINE3:
+			p0 := f64.Vec3{a[0], a[1], a[2]}
+			p1 := f64.Vec3{a[3], a[4], a[5]}
+			width := 1.0
+			if c.projected {
+				q0, q1, ok := clipLine(c.clipPoint(p0), c.clipPoint(p1))
+				if !ok {
+					continue
+				}
+				p0, p1 = c.toScreen(q0).XYZ(), c.toScreen(q1).XYZ()
+			} else {
+				p0, p1 = m.Transform3(p0), m.Transform3(p1)
+				width = math.Max(s.LineWidth, 1)
+			}
+			p := linePath(p0.X+0.5, p0.Y+0.5, p1.X+0.5, p1.Y+0.5)
+			w.stroke(p, c.pixelStroke(width), s.Stroke, s.Blend, cl)
+
+		case CMD_CIRCLE:
+			x, y, rad := a[0]+0.5, a[1]+0.5, math.Abs(a[2])
+			if !s.NoFill {
+				var p Path
+				p.Ellipse(x, y, rad+0.5, rad+0.5)
+				w.fill(&p, FILL_NONZERO, s.Fill, s.Blend, cl)
+			}
+			if !s.NoStroke {
+				var p Path
+				p.Ellipse(x, y, rad, rad)
+				w.stroke(&p, c.pixelStroke(1), s.Stroke, s.Blend, cl)
+			}
+
+		case CMD_TRIANGLE:
+			var p Path
+			p.MoveTo(a[0]+0.5, a[1]+0.5)
+			p.LineTo(a[2]+0.5, a[3]+0.5)
+			p.LineTo(a[4]+0.5, a[5]+0.5)
+			p.Close()
+			if !s.NoFill {
+				w.fill(&p, FILL_NONZERO, s.Fill, s.Blend, cl)
+			}
+			if !s.NoStroke {
+				w.stroke(&p, c.pixelStroke(math.Max(s.LineWidth, 1)), s.Stroke, s.Blend, cl)
+			}
+
+		case CMD_TRIANGLE3:
+			v := cmd.verts
+			var poly []rasterVertex
+			if c.projected {
+				poly = c.clipPolygon(v[0], v[1], v[2])
+			} else if p, ok := c.divideTriangle(v[0], v[1], v[2]); ok {
+				poly = p[:]
+			}
+			if p, col, ok := trianglePath(poly, s.Cull); ok {
+				w.fill(p, FILL_NONZERO, col, s.Blend, cl)
+			}
+
+		case CMD_FILL_PATH:
+			w.fill(cmd.path.transform(m), s.FillRule, s.Fill, s.Blend, cl)
+
+		case CMD_STROKE_PATH:
+			w.stroke(cmd.path.transform(m), c.strokeOptions(), s.Stroke, s.Blend, cl)
+
+		case CMD_TEXT:
+			var p Path
+			f, size := c.font()
+			for _, pg := range c.layoutText(f, size, cmd.text, a[0], a[1]) {
+				gt := glyphMatrix(m, size, pg.x, pg.y)
+				p.add(&pg.glyph.path, &gt)
+			}
+			w.fill(&p, FILL_NONZERO, s.Fill, s.Blend, cl)
+
+		case CMD_BEGIN_LAYER:
+			w.beginLayer(a[0], s.Blend)
+			layers++
+
+		case CMD_END_LAYER:
+			if layers > 0 {
+				w.endLayer()
+				layers--
+			}
+		}
+	}
+	for ; layers > 0; layers-- {
+		w.endLayer()
+	}
+}
+
+// pixelStroke strokes lines drawn a pixel at a time, the
+// points along them widen them by the point size
+func (c *Context) pixelStroke(width float64) *imageutil.StrokeOptions {
+	s := &c.styles[len(c.styles)-1]
+	return &imageutil.StrokeOptions{
+		Width: width + 2*math.Floor(s.PointSize/2),
+		Join:  JOIN_MITER,
+		Cap:   CAP_SQUARE,
+	}
+}
+
+func linePath(x0, y0, x1, y1 float64) *Path {
+	p := &Path{}
+	p.MoveTo(x0, y0)
+	p.LineTo(x1, y1)
+	return p
+}
+
+// trianglePath returns the outline of a clipped triangle in pixels
+// and the average of its vertex colors, false if it is culled
+func trianglePath(poly []rasterVertex, cull int) (*Path, color.RGBA, bool) {
+	if len(poly) < 3 {
+		return nil, color.RGBA{}, false
+	}
+	area := edge(poly[0].pos, poly[1].pos, poly[2].pos)
+	front := area < 0
+	switch {
+	case area == 0 || math.IsNaN(area),
+		cull == CULL_BACK && !front,
+		cull == CULL_FRONT && front:
+		return nil, color.RGBA{}, false
+	}
+
+	p := &Path{}
+	var sum f64.Vec4
+	for i, v := range poly {
+		if i == 0 {
+			p.MoveTo(v.pos.X, v.pos.Y)
+		} else {
+			p.LineTo(v.pos.X, v.pos.Y)
+		}
+		sum = addScale4(sum, v.Color, 1)
+	}
+	p.Close()
+
+	k := 255 / float64(len(poly))
+	col := color.RGBA{
+		f64.Clamp8(sum.X*k, 0, 255),
+		f64.Clamp8(sum.Y*k, 0, 255),
+		f64.Clamp8(sum.Z*k, 0, 255),
+		f64.Clamp8(sum.W*k, 0, 255),
+	}
+	return p, col, true
+}
+
+// straight returns the color without the alpha
+// premultiplied and the alpha in [0, 1]
+func straight(col color.RGBA) (r, g, b uint8, a float64) {
+	if col.A == 0 {
+		return 0, 0, 0, 0
+	}
+	k := 255 / float64(col.A)
+	r = f64.Clamp8(float64(col.R)*k, 0, 255)
+	g = f64.Clamp8(float64(col.G)*k, 0, 255)
+	b = f64.Clamp8(float64(col.B)*k, 0, 255)
+	return r, g, b, float64(col.A) / 255
+}
+
+// blendNames are the css names of the separable blend modes,
+// the porter-duff operators other than source over have no
+// vector form and draw as source over
+var blendNames = map[int]string{
+	BLEND_MULTIPLY:    "multiply",
+	BLEND_SCREEN:      "screen",
+	BLEND_OVERLAY:     "overlay",
+	BLEND_DARKEN:      "darken",
+	BLEND_LIGHTEN:     "lighten",
+	BLEND_COLOR_DODGE: "color-dodge",
+	BLEND_COLOR_BURN:  "color-burn",
+	BLEND_HARD_LIGHT:  "hard-light",
+	BLEND_SOFT_LIGHT:  "soft-light",
+	BLEND_DIFFERENCE:  "difference",
+	BLEND_EXCLUSION:   "exclusion",
+}
+
+// clipped tells if the clip limits anything inside the bounds
+func (cl *clip) clipped(bounds image.Rectangle) bool {
+	return len(cl.paths) > 0 || !bounds.In(cl.rect)
+}
+
+// dashed returns the dash pattern if it draws any gaps
+func dashed(o *imageutil.StrokeOptions) []float64 {
+	total := 0.0
+	for _, d := range o.Dash {
+		if d < 0 {
+			return nil
+		}
+		total += d
+	}
+	if total <= 0 {
+		return nil
+	}
+	if len(o.Dash)%2 != 0 {
+		return append(o.Dash[:len(o.Dash):len(o.Dash)], o.Dash...)
+	}
+	return o.Dash
+}
+
+// num formats a coordinate to a thousandth of a pixel
+func num(v float64) string {
+	v = math.Round(v*1000) / 1000
+	if v == 0 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
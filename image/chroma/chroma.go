@@ -17,31 +17,58 @@ type HSV struct {
 	H, S, V float64
 }
 
+// Float4 is a premultiplied color with the
+// channels scaled so that 255 is fully on
 type Float4 [4]float64
 
+// Float4f is Float4 at single precision
+type Float4f [4]float32
+
 func (f Float4) RGBA() (r, g, b, a uint32) {
-	c := color.RGBA{uint8(f[0]), uint8(f[1]), uint8(f[2]), uint8(f[3])}
-	return c.RGBA()
+	return unorm16(f[0]), unorm16(f[1]), unorm16(f[2]), unorm16(f[3])
+}
+
+func (f Float4f) RGBA() (r, g, b, a uint32) {
+	return unorm16(float64(f[0])), unorm16(float64(f[1])), unorm16(float64(f[2])), unorm16(float64(f[3]))
+}
+
+func unorm16(x float64) uint32 {
+	return uint32(f64.Clamp(x*257+.5, 0, 0xffff))
 }
 
 var (
-	HSVModel    = color.ModelFunc(hsvModel)
-	HSLModel    = color.ModelFunc(hslModel)
-	Vec3dModel  = color.ModelFunc(vec3dModel)
-	Vec4dModel  = color.ModelFunc(vec4dModel)
-	Float4Model = color.ModelFunc(float4Model)
+	HSVModel     = color.ModelFunc(hsvModel)
+	HSLModel     = color.ModelFunc(hslModel)
+	Vec3dModel   = color.ModelFunc(vec3dModel)
+	Vec4dModel   = color.ModelFunc(vec4dModel)
+	Float4Model  = color.ModelFunc(float4Model)
+	Float4fModel = color.ModelFunc(float4fModel)
 )
 
 func float4Model(c color.Color) color.Color {
-	n := color.RGBAModel.Convert(c).(color.RGBA)
+	switch c := c.(type) {
+	case Float4:
+		return c
+	case Float4f:
+		return Float4{float64(c[0]), float64(c[1]), float64(c[2]), float64(c[3])}
+	}
+	r, g, b, a := c.RGBA()
 	return Float4{
-		float64(n.R),
-		float64(n.G),
-		float64(n.B),
-		float64(n.A),
+		float64(r) / 257,
+		float64(g) / 257,
+		float64(b) / 257,
+		float64(a) / 257,
 	}
 }
 
+func float4fModel(c color.Color) color.Color {
+	if c, ok := c.(Float4f); ok {
+		return c
+	}
+	f := float4Model(c).(Float4)
+	return Float4f{float32(f[0]), float32(f[1]), float32(f[2]), float32(f[3])}
+}
+
 func vec3dModel(c color.Color) color.Color {
 	n := color.RGBAModel.Convert(c).(color.RGBA)
 	return f64.Vec3{
@@ -155,9 +182,12 @@ func HSV2HSL(c HSV) HSL {
 	h := c.H
 	l := (2 - c.S) * c.V
 	s := c.S * c.V
-	if l <= 1 {
+	switch {
+	case l <= 0 || l >= 2:
+		s = 0
+	case l <= 1:
 		s /= l
-	} else {
+	default:
 		s /= 2 - l
 	}
 	l /= 2
@@ -174,7 +204,9 @@ func HSL2HSV(c HSL) HSV {
 		s *= 2 - l
 	}
 	v := (l + s) / 2
-	s = 2 * s / (l + s)
+	if l+s > 0 {
+		s = 2 * s / (l + s)
+	}
 	return HSV{h, s, v}
 }
 
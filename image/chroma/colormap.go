@@ -0,0 +1,69 @@
+package chroma
+
+import (
+	"image/color"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// the scientific color maps take a scalar in [0, 1] and are
+// evaluated with polynomial fits of the original tables,
+// values outside of the range are clamped
+
+// Viridis is the perceptually uniform map of matplotlib
+// going from dark blue through green to yellow
+func Viridis(t float64) color.RGBA {
+	return polyColor(t, [7]f64.Vec3{
+		{0.2777273272234177, 0.005407344544966578, 0.3340998053353061},
+		{0.1050930431085774, 1.404613529898575, 1.384590162594685},
+		{-0.3308618287255563, 0.214847559468213, 0.09509516302823659},
+		{-4.634230498983486, -5.799100973351585, -19.33244095627987},
+		{6.228269936347081, 14.17993336680509, 56.69055260068105},
+		{4.776384997670288, -13.74514537774601, -65.35303263337234},
+		{-5.435455855934631, 4.645852612178535, 26.3124352495832},
+	})
+}
+
+// Magma is the perceptually uniform map of matplotlib
+// going from black through purple and orange to white
+func Magma(t float64) color.RGBA {
+	return polyColor(t, [7]f64.Vec3{
+		{-0.002136485053939582, -0.000749655052795221, -0.005386127855323933},
+		{0.2516605407371642, 0.6775232436837668, 2.494026599312351},
+		{8.353717279216625, -3.577719514958484, 0.3144679030132573},
+		{-27.66873308576866, 14.26473078096533, -13.64921318813922},
+		{52.17613981234068, -27.94360607168351, 12.94416944238394},
+		{-50.76852536473588, 29.04658282127291, 4.23415299384598},
+		{18.65570506591883, -11.48977351997711, -5.601961508734096},
+	})
+}
+
+// Turbo is google's improved rainbow map, it is not
+// perceptually uniform but has a lot more contrast
+func Turbo(t float64) color.RGBA {
+	return polyColor(t, [7]f64.Vec3{
+		{0.13572138, 0.09140261, 0.10667330},
+		{4.61539260, 2.19418839, 12.64194608},
+		{-42.66032258, 4.84296658, -60.58204836},
+		{132.13108234, -14.18503333, 110.36276771},
+		{-152.94239396, 4.27729857, -89.90310912},
+		{59.28637943, 2.82956604, 27.34824973},
+		{},
+	})
+}
+
+// polyColor evaluates a polynomial with the coefficients in
+// increasing order of power for every channel
+func polyColor(t float64, c [7]f64.Vec3) color.RGBA {
+	t = f64.Clamp(t, 0, 1)
+	var v f64.Vec3
+	for i := len(c) - 1; i >= 0; i-- {
+		v = v.Scale(t).Add(c[i])
+	}
+	return color.RGBA{
+		f64.Clamp8(v.X*255, 0, 255),
+		f64.Clamp8(v.Y*255, 0, 255),
+		f64.Clamp8(v.Z*255, 0, 255),
+		255,
+	}
+}
@@ -0,0 +1,329 @@
+package chroma
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// NamedColors are the colors of CSS by their lowercase names
+var NamedColors = map[string]color.RGBA{
+	"aliceblue":            {240, 248, 255, 255},
+	"antiquewhite":         {250, 235, 215, 255},
+	"aqua":                 {0, 255, 255, 255},
+	"aquamarine":           {127, 255, 212, 255},
+	"azure":                {240, 255, 255, 255},
+	"beige":                {245, 245, 220, 255},
+	"bisque":               {255, 228, 196, 255},
+	"black":                {0, 0, 0, 255},
+	"blanchedalmond":       {255, 235, 205, 255},
+	"blue":                 {0, 0, 255, 255},
+	"blueviolet":           {138, 43, 226, 255},
+	"brown":                {165, 42, 42, 255},
+	"burlywood":            {222, 184, 135, 255},
+	"cadetblue":            {95, 158, 160, 255},
+	"chartreuse":           {127, 255, 0, 255},
+	"chocolate":            {210, 105, 30, 255},
+	"coral":                {255, 127, 80, 255},
+	"cornflowerblue":       {100, 149, 237, 255},
+	"cornsilk":             {255, 248, 220, 255},
+	"crimson":              {220, 20, 60, 255},
+	"cyan":                 {0, 255, 255, 255},
+	"darkblue":             {0, 0, 139, 255},
+	"darkcyan":             {0, 139, 139, 255},
+	"darkgoldenrod":        {184, 134, 11, 255},
+	"darkgray":             {169, 169, 169, 255},
+	"darkgreen":            {0, 100, 0, 255},
+	"darkgrey":             {169, 169, 169, 255},
+	"darkkhaki":            {189, 183, 107, 255},
+	"darkmagenta":          {139, 0, 139, 255},
+	"darkolivegreen":       {85, 107, 47, 255},
+	"darkorange":           {255, 140, 0, 255},
+	"darkorchid":           {153, 50, 204, 255},
+	"darkred":              {139, 0, 0, 255},
+	"darksalmon":           {233, 150, 122, 255},
+	"darkseagreen":         {143, 188, 143, 255},
+	"darkslateblue":        {72, 61, 139, 255},
+	"darkslategray":        {47, 79, 79, 255},
+	"darkslategrey":        {47, 79, 79, 255},
+	"darkturquoise":        {0, 206, 209, 255},
+	"darkviolet":           {148, 0, 211, 255},
+	"deeppink":             {255, 20, 147, 255},
+	"deepskyblue":          {0, 191, 255, 255},
+	"dimgray":              {105, 105, 105, 255},
+	"dimgrey":              {105, 105, 105, 255},
+	"dodgerblue":           {30, 144, 255, 255},
+	"firebrick":            {178, 34, 34, 255},
+	"floralwhite":          {255, 250, 240, 255},
+	"forestgreen":          {34, 139, 34, 255},
+	"fuchsia":              {255, 0, 255, 255},
+	"gainsboro":            {220, 220, 220, 255},
+	"ghostwhite":           {248, 248, 255, 255},
+	"gold":                 {255, 215, 0, 255},
+	"goldenrod":            {218, 165, 32, 255},
+	"gray":                 {128, 128, 128, 255},
+	"grey":                 {128, 128, 128, 255},
+	"green":                {0, 128, 0, 255},
+	"greenyellow":          {173, 255, 47, 255},
+	"honeydew":             {240, 255, 240, 255},
+	"hotpink":              {255, 105, 180, 255},
+	"indianred":            {205, 92, 92, 255},
+	"indigo":               {75, 0, 130, 255},
+	"ivory":                {255, 255, 240, 255},
+	"khaki":                {240, 230, 140, 255},
+	"lavender":             {230, 230, 250, 255},
+	"lavenderblush":        {255, 240, 245, 255},
+	"lawngreen":            {124, 252, 0, 255},
+	"lemonchiffon":         {255, 250, 205, 255},
+	"lightblue":            {173, 216, 230, 255},
+	"lightcoral":           {240, 128, 128, 255},
+	"lightcyan":            {224, 255, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210, 255},
+	"lightgray":            {211, 211, 211, 255},
+	"lightgreen":           {144, 238, 144, 255},
+	"lightgrey":            {211, 211, 211, 255},
+	"lightpink":            {255, 182, 193, 255},
+	"lightsalmon":          {255, 160, 122, 255},
+	"lightseagreen":        {32, 178, 170, 255},
+	"lightskyblue":         {135, 206, 250, 255},
+	"lightslategray":       {119, 136, 153, 255},
+	"lightslategrey":       {119, 136, 153, 255},
+	"lightsteelblue":       {176, 196, 222, 255},
+	"lightyellow":          {255, 255, 224, 255},
+	"lime":                 {0, 255, 0, 255},
+	"limegreen":            {50, 205, 50, 255},
+	"linen":                {250, 240, 230, 255},
+	"magenta":              {255, 0, 255, 255},
+	"maroon":               {128, 0, 0, 255},
+	"mediumaquamarine":     {102, 205, 170, 255},
+	"mediumblue":           {0, 0, 205, 255},
+	"mediumorchid":         {186, 85, 211, 255},
+	"mediumpurple":         {147, 112, 219, 255},
+	"mediumseagreen":       {60, 179, 113, 255},
+	"mediumslateblue":      {123, 104, 238, 255},
+	"mediumspringgreen":    {0, 250, 154, 255},
+	"mediumturquoise":      {72, 209, 204, 255},
+	"mediumvioletred":      {199, 21, 133, 255},
+	"midnightblue":         {25, 25, 112, 255},
+	"mintcream":            {245, 255, 250, 255},
+	"mistyrose":            {255, 228, 225, 255},
+	"moccasin":             {255, 228, 181, 255},
+	"navajowhite":          {255, 222, 173, 255},
+	"navy":                 {0, 0, 128, 255},
+	"oldlace":              {253, 245, 230, 255},
+	"olive":                {128, 128, 0, 255},
+	"olivedrab":            {107, 142, 35, 255},
+	"orange":               {255, 165, 0, 255},
+	"orangered":            {255, 69, 0, 255},
+	"orchid":               {218, 112, 214, 255},
+	"palegoldenrod":        {238, 232, 170, 255},
+	"palegreen":            {152, 251, 152, 255},
+	"paleturquoise":        {175, 238, 238, 255},
+	"palevioletred":        {219, 112, 147, 255},
+	"papayawhip":           {255, 239, 213, 255},
+	"peachpuff":            {255, 218, 185, 255},
+	"peru":                 {205, 133, 63, 255},
+	"pink":                 {255, 192, 203, 255},
+	"plum":                 {221, 160, 221, 255},
+	"powderblue":           {176, 224, 230, 255},
+	"purple":               {128, 0, 128, 255},
+	"rebeccapurple":        {102, 51, 153, 255},
+	"red":                  {255, 0, 0, 255},
+	"rosybrown":            {188, 143, 143, 255},
+	"royalblue":            {65, 105, 225, 255},
+	"saddlebrown":          {139, 69, 19, 255},
+	"salmon":               {250, 128, 114, 255},
+	"sandybrown":           {244, 164, 96, 255},
+	"seagreen":             {46, 139, 87, 255},
+	"seashell":             {255, 245, 238, 255},
+	"sienna":               {160, 82, 45, 255},
+	"silver":               {192, 192, 192, 255},
+	"skyblue":              {135, 206, 235, 255},
+	"slateblue":            {106, 90, 205, 255},
+	"slategray":            {112, 128, 144, 255},
+	"slategrey":            {112, 128, 144, 255},
+	"snow":                 {255, 250, 250, 255},
+	"springgreen":          {0, 255, 127, 255},
+	"steelblue":            {70, 130, 180, 255},
+	"tan":                  {210, 180, 140, 255},
+	"teal":                 {0, 128, 128, 255},
+	"thistle":              {216, 191, 216, 255},
+	"tomato":               {255, 99, 71, 255},
+	"transparent":          {0, 0, 0, 0},
+	"turquoise":            {64, 224, 208, 255},
+	"violet":               {238, 130, 238, 255},
+	"wheat":                {245, 222, 179, 255},
+	"white":                {255, 255, 255, 255},
+	"whitesmoke":           {245, 245, 245, 255},
+	"yellow":               {255, 255, 0, 255},
+	"yellowgreen":          {154, 205, 50, 255},
+}
+
+// parseHex parses #rgb, #rgba, #rrggbb and #rrggbbaa,
+// a single #vv is a gray level
+func parseHex(s string) (color.NRGBA, bool) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	nib := func(i uint) uint8 {
+		return uint8(v>>(4*i)&0xf) * 0x11
+	}
+	byt := func(i uint) uint8 {
+		return uint8(v >> (8 * i))
+	}
+
+	switch len(s) {
+	case 2:
+		return color.NRGBA{byt(0), byt(0), byt(0), 255}, true
+	case 3:
+		return color.NRGBA{nib(2), nib(1), nib(0), 255}, true
+	case 4:
+		return color.NRGBA{nib(3), nib(2), nib(1), nib(0)}, true
+	case 6:
+		return color.NRGBA{byt(2), byt(1), byt(0), 255}, true
+	case 8:
+		return color.NRGBA{byt(3), byt(2), byt(1), byt(0)}, true
+	}
+	return color.NRGBA{}, false
+}
+
+// parseFunc splits name(a, b, c / d) into the name and the arguments,
+// the arguments can be separated by commas or spaces
+func parseFunc(s string) (name string, args []string, ok bool) {
+	i := strings.IndexByte(s, '(')
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		return
+	}
+	name = strings.TrimSpace(s[:i])
+	body := strings.NewReplacer(",", " ", "/", " ").Replace(s[i+1 : len(s)-1])
+	return name, strings.Fields(body), true
+}
+
+// parseNumber parses a number with an optional percent
+// sign, a percentage is scaled so 100% is full
+func parseNumber(s string, full float64) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		return v / 100 * full, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseHue parses an angle to a fraction of a turn,
+// numbers without units are in degrees
+func parseHue(s string) (float64, error) {
+	units := []struct {
+		suffix string
+		turn   float64
+	}{
+		{"deg", 360},
+		{"grad", 400},
+		{"rad", 2 * math.Pi},
+		{"turn", 1},
+		{"", 360},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			v /= u.turn
+			return v - math.Floor(v), err
+		}
+	}
+	return 0, nil
+}
+
+// ParseCSS parses the color syntax of CSS, that is the color names,
+// hex colors and the rgb(), rgba(), hsl() and hsla() functions with
+// the alpha in [0, 1] or as a percentage, the color is not
+// premultiplied, it also takes hsv() and hsva() with the hue,
+// saturation and value in [0, 1] like HSV or as percentages
+func ParseCSS(s string) (color.NRGBA, error) {
+	c, err := parseCSS(s)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("failed to parse color: %v", err)
+	}
+	return c, nil
+}
+
+func parseCSS(s string) (color.NRGBA, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := NamedColors[s]; ok {
+		return color.NRGBAModel.Convert(c).(color.NRGBA), nil
+	}
+	if strings.HasPrefix(s, "#") {
+		if c, ok := parseHex(s[1:]); ok {
+			return c, nil
+		}
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+
+	name, args, ok := parseFunc(s)
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("unknown format %q", s)
+	}
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, fmt.Errorf("%s needs 3 or 4 arguments in %q", name, s)
+	}
+
+	var (
+		v   [4]float64
+		err error
+	)
+	v[3] = 1
+	if len(args) == 4 {
+		v[3], err = parseNumber(args[3], 1)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid alpha in %q", s)
+		}
+	}
+
+	switch name {
+	case "rgb", "rgba":
+		for i := 0; i < 3 && err == nil; i++ {
+			v[i], err = parseNumber(args[i], 255)
+			v[i] /= 255
+		}
+	case "hsl", "hsla":
+		var h HSL
+		h.H, err = parseHue(args[0])
+		if err == nil {
+			h.S, err = parseNumber(args[1], 1)
+		}
+		if err == nil {
+			h.L, err = parseNumber(args[2], 1)
+		}
+		h.S = f64.Clamp(h.S, 0, 1)
+		h.L = f64.Clamp(h.L, 0, 1)
+		c := HSV2VEC4(HSL2HSV(h))
+		v[0], v[1], v[2] = c.X, c.Y, c.Z
+	case "hsv", "hsva":
+		var h HSV
+		for i, p := range []*float64{&h.H, &h.S, &h.V} {
+			if err == nil {
+				*p, err = parseNumber(args[i], 1)
+			}
+		}
+		h.H -= math.Floor(h.H)
+		h.S = f64.Clamp(h.S, 0, 1)
+		h.V = f64.Clamp(h.V, 0, 1)
+		c := HSV2VEC4(h)
+		v[0], v[1], v[2] = c.X, c.Y, c.Z
+	default:
+		return color.NRGBA{}, fmt.Errorf("unknown color function %q", s)
+	}
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid arguments in %q", s)
+	}
+
+	return color.NRGBA{
+		f64.Clamp8(v[0]*255, 0, 255),
+		f64.Clamp8(v[1]*255, 0, 255),
+		f64.Clamp8(v[2]*255, 0, 255),
+		f64.Clamp8(v[3]*255, 0, 255),
+	}, nil
+}
@@ -0,0 +1,243 @@
+package chroma
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// kinds of color vision deficiency by the cone that is missing
+const (
+	PROTANOPIA = iota
+	DEUTERANOPIA
+	TRITANOPIA
+)
+
+// methods of simulating color vision deficiency
+const (
+	// Brettel, Viénot and Mollon 1997, projects onto two half planes
+	// and is the most accurate for complete dichromacy
+	CVD_BRETTEL = iota
+
+	// Viénot, Brettel and Mollon 1999, a single projection that is
+	// faster but only valid for protanopia and deuteranopia, it falls
+	// back to brettel for tritanopia
+	CVD_VIENOT
+
+	// Machado, Oliveira and Fernandes 2009, based on the shift of the
+	// cone sensitivities, the severity scales the shift
+	CVD_MACHADO
+)
+
+// CVD is a color model that simulates how a color looks
+// to someone with a color vision deficiency
+type CVD struct {
+	Type   int
+	Method int
+
+	// how strong the deficiency is in [0, 1], zero
+	// means full dichromacy like a severity of 1
+	Severity float64
+}
+
+var (
+	// linear sRGB to LMS cone responses as used by viénot
+	rgbToLMS = f64.Mat3{
+		{17.8824, 43.5161, 4.11935},
+		{3.45565, 27.1554, 3.86714},
+		{0.0299566, 0.184309, 1.46709},
+	}
+	lmsToRGB = func() f64.Mat3 {
+		m := rgbToLMS
+		return *m.Inverse()
+	}()
+
+	// machado matrices for full dichromacy in linear sRGB
+	machado = [3]f64.Mat3{
+		{
+			{0.152286, 1.052583, -0.204868},
+			{0.114503, 0.786281, 0.099216},
+			{-0.003882, -0.048116, 1.051998},
+		},
+		{
+			{0.367322, 0.860646, -0.227968},
+			{0.280085, 0.672501, 0.047413},
+			{-0.011820, 0.042940, 0.968881},
+		},
+		{
+			{1.255528, -0.076749, -0.178779},
+			{-0.078411, 0.930809, 0.147602},
+			{0.004733, 0.691367, 0.303900},
+		},
+	}
+)
+
+func (d CVD) Convert(c color.Color) color.Color {
+	_, _, _, a := c.RGBA()
+	v := SRGB2LinearVEC3(straightVec3(c))
+	s := d.simulate(v)
+	if k := d.Severity; k > 0 && k < 1 {
+		s = v.Lerp(k, s)
+	}
+	s = Linear2SRGBVEC3(f64.Vec3{
+		f64.Clamp(s.X, 0, 1),
+		f64.Clamp(s.Y, 0, 1),
+		f64.Clamp(s.Z, 0, 1),
+	})
+	alpha := float64(a) / 0xffff
+	return toRGBA([4]float64{s.X * alpha * 255, s.Y * alpha * 255, s.Z * alpha * 255, alpha * 255})
+}
+
+// Image returns the image as it looks with the deficiency
+func (d CVD) Image(m image.Image) *image.RGBA {
+	r := m.Bounds()
+	p := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p.Set(x, y, d.Convert(m.At(x, y)))
+		}
+	}
+	return p
+}
+
+// simulate maps a linear sRGB color to the color seen
+func (d CVD) simulate(v f64.Vec3) f64.Vec3 {
+	t := d.Type
+	if t < PROTANOPIA || t > TRITANOPIA {
+		return v
+	}
+
+	switch d.Method {
+	case CVD_MACHADO:
+		return machado[t].Transform(v)
+
+	case CVD_VIENOT:
+		q := rgbToLMS.Transform(v)
+		switch t {
+		case PROTANOPIA:
+			q.X = 2.02344*q.Y - 2.52581*q.Z
+			return lmsToRGB.Transform(q)
+		case DEUTERANOPIA:
+			q.Y = 0.494207*q.X + 1.24827*q.Z
+			return lmsToRGB.Transform(q)
+		}
+	}
+	return brettel(v, t)
+}
+
+// brettelNormals are the normals in LMS of the two half planes
+// of every deficiency that hold the colors a dichromat sees the
+// same as a trichromat, the planes go through the neutral axis
+// and the monochromatic lights at the anchor wavelengths
+var brettelNormals = func() (n [3][2]f64.Vec3) {
+	// CIE 1931 color matching functions of the anchors
+	anchors := [3][2]XYZ{
+		{{0.1421, 0.1126, 1.0419}, {0.8425, 0.9154, 0.0018}}, // 475nm, 575nm
+		{{0.1421, 0.1126, 1.0419}, {0.8425, 0.9154, 0.0018}}, // 475nm, 575nm
+		{{0.0580, 0.1693, 0.6162}, {0.1649, 0.0610, 0.0000}}, // 485nm, 660nm
+	}
+	e := rgbToLMS.Transform(f64.Vec3{1, 1, 1})
+	for i := range anchors {
+		for j, a := range anchors[i] {
+			n[i][j] = e.Cross(rgbToLMS.Transform(XYZ2LinearRGB(a)))
+		}
+	}
+	return
+}()
+
+func brettel(v f64.Vec3, t int) f64.Vec3 {
+	// i is the missing cone, j and k are the ones left and
+	// the ratio of k to j picks the half plane to project on
+	i, j, k := t, 1, 2
+	switch t {
+	case DEUTERANOPIA:
+		j, k = 0, 2
+	case TRITANOPIA:
+		j, k = 0, 1
+	}
+
+	lv := rgbToLMS.Transform(v)
+	le := rgbToLMS.Transform(f64.Vec3{1, 1, 1})
+	q := [3]float64{lv.X, lv.Y, lv.Z}
+	e := [3]float64{le.X, le.Y, le.Z}
+
+	nv := brettelNormals[t][0]
+	if q[k]*e[j] < e[k]*q[j] {
+		nv = brettelNormals[t][1]
+	}
+	n := [3]float64{nv.X, nv.Y, nv.Z}
+	q[i] = -(n[j]*q[j] + n[k]*q[k]) / n[i]
+	return lmsToRGB.Transform(f64.Vec3{q[0], q[1], q[2]})
+}
+
+// RelativeLuminance is the luminance of a color as defined by WCAG,
+// 0 for black and 1 for white, the alpha of the color is ignored
+func RelativeLuminance(c color.Color) float64 {
+	v := SRGB2LinearVEC3(straightVec3(c))
+	return 0.2126*v.X + 0.7152*v.Y + 0.0722*v.Z
+}
+
+// ContrastRatio is the WCAG contrast ratio of two colors in [1, 21],
+// text needs 4.5 to pass AA and 7 to pass AAA, large text 3 and 4.5
+func ContrastRatio(a, b color.Color) float64 {
+	x, y := RelativeLuminance(a), RelativeLuminance(b)
+	if x < y {
+		x, y = y, x
+	}
+	return (x + 0.05) / (y + 0.05)
+}
+
+// NudgeContrast moves the foreground color towards white or black
+// in OKLab as little as it can to have at least the contrast ratio
+// against the background, keeping its hue as much as possible,
+// if the ratio cannot be reached the color with the most contrast
+// is returned
+func NudgeContrast(fg, bg color.Color, ratio float64) color.RGBA {
+	_, _, _, alpha := fg.RGBA()
+	a := float64(alpha) / 0xffff
+	f := VEC32OKLab(straightVec3(fg))
+	mix := func(to OKLab, t float64) color.RGBA {
+		v := OKLab2VEC3(MixOKLab(f, to, t))
+		return toRGBA([4]float64{
+			f64.Clamp(v.X, 0, 1) * a * 255,
+			f64.Clamp(v.Y, 0, 1) * a * 255,
+			f64.Clamp(v.Z, 0, 1) * a * 255,
+			a * 255,
+		})
+	}
+
+	c := mix(f, 0)
+	if ContrastRatio(c, bg) >= ratio {
+		return c
+	}
+
+	// try the direction away from the background first
+	white, black := OKLab{1, 0, 0}, OKLab{}
+	dirs := []OKLab{white, black}
+	if RelativeLuminance(fg) < RelativeLuminance(bg) {
+		dirs[0], dirs[1] = black, white
+	}
+
+	best, most := c, ContrastRatio(c, bg)
+	for _, to := range dirs {
+		if r := ContrastRatio(mix(to, 1), bg); r < ratio {
+			if r > most {
+				best, most = mix(to, 1), r
+			}
+			continue
+		}
+
+		lo, hi := 0.0, 1.0
+		for n := 0; n < 32; n++ {
+			t := (lo + hi) / 2
+			if ContrastRatio(mix(to, t), bg) >= ratio {
+				hi = t
+			} else {
+				lo = t
+			}
+		}
+		return mix(to, hi)
+	}
+	return best
+}
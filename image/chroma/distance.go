@@ -19,6 +19,17 @@ func DistanceL2RGB(a, b color.Color) float64 {
 	return DistanceLPRGB(a, b, 2)
 }
 
+func DistanceL2RGBA(a, b color.Color) float64 {
+	x := color.RGBAModel.Convert(a).(color.RGBA)
+	y := color.RGBAModel.Convert(b).(color.RGBA)
+
+	d1 := float64(x.R) - float64(y.R)
+	d2 := float64(x.G) - float64(y.G)
+	d3 := float64(x.B) - float64(y.B)
+	d4 := float64(x.A) - float64(y.A)
+	return math.Sqrt(d1*d1 + d2*d2 + d3*d3 + d4*d4)
+}
+
 // https://www.compuphase.com/cmetric.htm
 func DistanceWL2RGB(a, b color.Color) float64 {
 	x := color.RGBAModel.Convert(a).(color.RGBA)
@@ -45,3 +56,112 @@ func DistanceBW(a, b color.Color) float64 {
 	}
 	return 0
 }
+
+// DistanceCIE76 is the euclidean distance of the colors in Lab
+func DistanceCIE76(a, b color.Color) float64 {
+	return DeltaE76(LabModel.Convert(a).(Lab), LabModel.Convert(b).(Lab))
+}
+
+// DistanceCIE94 is the CIE94 color difference
+// with the weights used for graphic arts
+func DistanceCIE94(a, b color.Color) float64 {
+	return DeltaE94(LabModel.Convert(a).(Lab), LabModel.Convert(b).(Lab))
+}
+
+// DistanceCIEDE2000 is the CIEDE2000 color difference
+func DistanceCIEDE2000(a, b color.Color) float64 {
+	return DeltaE2000(LabModel.Convert(a).(Lab), LabModel.Convert(b).(Lab))
+}
+
+func DeltaE76(x, y Lab) float64 {
+	dl := x.L - y.L
+	da := x.A - y.A
+	db := x.B - y.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+func DeltaE94(x, y Lab) float64 {
+	const (
+		kL = 1
+		K1 = 0.045
+		K2 = 0.015
+	)
+	c1 := math.Hypot(x.A, x.B)
+	c2 := math.Hypot(y.A, y.B)
+	dl := x.L - y.L
+	dc := c1 - c2
+	da := x.A - y.A
+	db := x.B - y.B
+	dh2 := math.Max(da*da+db*db-dc*dc, 0)
+
+	sc := 1 + K1*c1
+	sh := 1 + K2*c1
+	return math.Sqrt((dl/kL)*(dl/kL) + (dc/sc)*(dc/sc) + dh2/(sh*sh))
+}
+
+// http://www2.ece.rochester.edu/~gsharma/ciede2000/ciede2000noteCRNA.pdf
+func DeltaE2000(x, y Lab) float64 {
+	const deg = math.Pi / 180
+	pow7 := func(v float64) float64 {
+		v2 := v * v
+		return v2 * v2 * v2 * v
+	}
+
+	cm := (math.Hypot(x.A, x.B) + math.Hypot(y.A, y.B)) / 2
+	g := 0.5 * (1 - math.Sqrt(pow7(cm)/(pow7(cm)+pow7(25))))
+	a1 := x.A * (1 + g)
+	a2 := y.A * (1 + g)
+	c1 := math.Hypot(a1, x.B)
+	c2 := math.Hypot(a2, y.B)
+	hue := func(a, b float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1 := hue(a1, x.B)
+	h2 := hue(a2, y.B)
+
+	dl := y.L - x.L
+	dc := c2 - c1
+	dh := 0.0
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh/2*deg)
+
+	lm := (x.L + y.L) / 2
+	cp := (c1 + c2) / 2
+	hm := h1 + h2
+	if c1*c2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			hm /= 2
+		case h1+h2 < 360:
+			hm = (hm + 360) / 2
+		default:
+			hm = (hm - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hm-30)*deg) + 0.24*math.Cos(2*hm*deg) +
+		0.32*math.Cos((3*hm+6)*deg) - 0.20*math.Cos((4*hm-63)*deg)
+	dt := 30 * math.Exp(-((hm-275)/25)*((hm-275)/25))
+	rc := 2 * math.Sqrt(pow7(cp)/(pow7(cp)+pow7(25)))
+	l50 := (lm - 50) * (lm - 50)
+	sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sc := 1 + 0.045*cp
+	sh := 1 + 0.015*cp*t
+	rt := -math.Sin(2*dt*deg) * rc
+
+	return math.Sqrt((dl/sl)*(dl/sl) + (dc/sc)*(dc/sc) + (dH/sh)*(dH/sh) + rt*(dc/sc)*(dH/sh))
+}
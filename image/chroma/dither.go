@@ -0,0 +1,367 @@
+package chroma
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+
+	"github.com/qeedquan/go-media/math/f64"
+	"github.com/qeedquan/go-media/math/rng/pdsample"
+)
+
+// ErrorDiffusion is a draw.Drawer that spreads the difference between
+// each pixel and the color it was given to the pixels not drawn yet
+type ErrorDiffusion struct {
+	// weights of the neighbors of a pixel, the pixel is in the
+	// middle column of the first row and only the weights after
+	// it on that row are used
+	Weights [][]float64
+
+	// alternate the direction of the rows to avoid the
+	// patterns that come from always going the same way
+	Serpentine bool
+}
+
+var (
+	FloydSteinberg = &ErrorDiffusion{
+		Weights: [][]float64{
+			{0, 0, 7.0 / 16},
+			{3.0 / 16, 5.0 / 16, 1.0 / 16},
+		},
+	}
+
+	// Atkinson only spreads 3/4 of the error, it gives more
+	// contrast at the cost of losing detail in the extremes
+	Atkinson = &ErrorDiffusion{
+		Weights: [][]float64{
+			{0, 0, 0, 1.0 / 8, 1.0 / 8},
+			{0, 1.0 / 8, 1.0 / 8, 1.0 / 8, 0},
+			{0, 0, 1.0 / 8, 0, 0},
+		},
+	}
+
+	Sierra = &ErrorDiffusion{
+		Weights: [][]float64{
+			{0, 0, 0, 5.0 / 32, 3.0 / 32},
+			{2.0 / 32, 4.0 / 32, 5.0 / 32, 4.0 / 32, 2.0 / 32},
+			{0, 2.0 / 32, 3.0 / 32, 2.0 / 32, 0},
+		},
+	}
+
+	SierraLite = &ErrorDiffusion{
+		Weights: [][]float64{
+			{0, 0, 2.0 / 4},
+			{1.0 / 4, 1.0 / 4, 0},
+		},
+	}
+)
+
+// Ordered is a draw.Drawer that offsets each pixel by a threshold
+// from a matrix tiled over the image before picking the color
+type Ordered struct {
+	// thresholds in [0, 1)
+	Matrix [][]float64
+
+	// size of the offsets in [0, 255] units, zero means the mean
+	// distance between the colors of the palette when drawing to
+	// an *image.Paletted and one step of 8 bits otherwise
+	Spread float64
+}
+
+// Dither converts the image to the palette with the drawer,
+// a nil drawer picks the closest color of every pixel
+func Dither(m image.Image, p color.Palette, d draw.Drawer) *image.Paletted {
+	if d == nil {
+		d = draw.Src
+	}
+	r := m.Bounds()
+	pm := image.NewPaletted(r, p)
+	d.Draw(pm, r, m, r.Min)
+	return pm
+}
+
+// Bayer returns the ordered dither of the 2^n by 2^n bayer matrix
+func Bayer(n int) *Ordered {
+	s := 1 << max(n, 0)
+	m := make([][]float64, s)
+	for y := range m {
+		m[y] = make([]float64, s)
+		for x := range m[y] {
+			// interleave the bits of x^y and y in reverse
+			v := 0
+			for i, xy := 0, x^y; i < n; i++ {
+				v = v<<2 | (xy>>i&1)<<1 | y>>i&1
+			}
+			m[y][x] = (float64(v) + .5) / float64(s*s)
+		}
+	}
+	return &Ordered{Matrix: m}
+}
+
+// BlueNoise returns an ordered dither with a n by n blue noise matrix,
+// it has none of the regular patterns of bayer dithering
+//
+// the matrix is built with the void and cluster method, the first
+// pixels come from a tiled poisson disk sampling and the rest fill
+// the largest voids left one at a time
+func BlueNoise(n int) *Ordered {
+	n = max(n, 1)
+	const sigma = 1.5
+
+	// energy contributed by a pixel at every offset on the torus
+	kernel := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			dx := float64(min(x, n-x))
+			dy := float64(min(y, n-y))
+			kernel[y*n+x] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+		}
+	}
+
+	rank := make([]int, n*n)
+	for i := range rank {
+		rank[i] = -1
+	}
+	energy := make([]float64, n*n)
+	next := 0
+	place := func(px, py int) {
+		rank[py*n+px] = next
+		next++
+		for y := 0; y < n; y++ {
+			e := energy[y*n : (y+1)*n]
+			k := kernel[(y-py+n)%n*n:]
+			for x := range e {
+				kx := x - px
+				if kx < 0 {
+					kx += n
+				}
+				e[x] += k[kx]
+			}
+		}
+	}
+
+	// about one pixel in ten starts out as poisson disk samples,
+	// the sampler is seeded so the matrix is always the same
+	if n >= 4 {
+		s := pdsample.NewBestCandidate(math.Sqrt(0.7*10)/float64(n), true, 4)
+		s.SetRNG(rand.New(rand.NewSource(1)))
+		s.Complete()
+		for _, p := range s.Points() {
+			x := min(int((p.X+1)/2*float64(n)), n-1)
+			y := min(int((p.Y+1)/2*float64(n)), n-1)
+			if rank[y*n+x] < 0 {
+				place(x, y)
+			}
+		}
+	}
+
+	for next < n*n {
+		k := -1
+		for i, r := range rank {
+			if r < 0 && (k < 0 || energy[i] < energy[k]) {
+				k = i
+			}
+		}
+		place(k%n, k/n)
+	}
+
+	m := make([][]float64, n)
+	for y := range m {
+		m[y] = make([]float64, n)
+		for x := range m[y] {
+			m[y][x] = (float64(rank[y*n+x]) + .5) / float64(n*n)
+		}
+	}
+	return &Ordered{Matrix: m}
+}
+
+func (d *ErrorDiffusion) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	r, sp = clipDraw(dst, r, src, sp)
+	if r.Empty() || len(d.Weights) == 0 {
+		return
+	}
+	set := newColorSetter(dst)
+
+	// one row of errors for every row of weights with
+	// room on the sides for the weights past the edges
+	half := len(d.Weights[0]) / 2
+	w := r.Dx()
+	errs := make([][][4]float64, len(d.Weights))
+	for i := range errs {
+		errs[i] = make([][4]float64, w+2*half)
+	}
+
+	for y := 0; y < r.Dy(); y++ {
+		dir := 1
+		if d.Serpentine && y&1 != 0 {
+			dir = -1
+		}
+		for i := 0; i < w; i++ {
+			x := i
+			if dir < 0 {
+				x = w - 1 - i
+			}
+
+			c := float4Model(src.At(sp.X+x, sp.Y+y)).(Float4)
+			e := &errs[0][x+half]
+			for k := range c {
+				c[k] = f64.Clamp(c[k]+e[k], 0, 255)
+			}
+			q := set(r.Min.X+x, r.Min.Y+y, c)
+
+			for k := range c {
+				c[k] -= q[k]
+			}
+			for j, row := range d.Weights {
+				for l, wt := range row {
+					dx := l - half
+					if wt == 0 || (j == 0 && dx <= 0) {
+						continue
+					}
+					ex := x + dx*dir + half
+					for k := range c {
+						errs[j][ex][k] += c[k] * wt
+					}
+				}
+			}
+		}
+
+		// shift the rows of errors up
+		first := errs[0]
+		copy(errs, errs[1:])
+		for i := range first {
+			first[i] = [4]float64{}
+		}
+		errs[len(errs)-1] = first
+	}
+}
+
+func (o *Ordered) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	r, sp = clipDraw(dst, r, src, sp)
+	if r.Empty() || len(o.Matrix) == 0 {
+		return
+	}
+	set := newColorSetter(dst)
+
+	spread := o.Spread
+	if spread <= 0 {
+		spread = 1
+		if p, ok := dst.(*image.Paletted); ok {
+			spread = paletteSpacing(p.Palette)
+		}
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := o.Matrix[mod(y, len(o.Matrix))]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := float4Model(src.At(sp.X+x-r.Min.X, sp.Y+y-r.Min.Y)).(Float4)
+			t := (row[mod(x, len(row))] - .5) * spread
+			for k := 0; k < 3; k++ {
+				c[k] = f64.Clamp(c[k]+t, 0, 255)
+			}
+			set(x, y, c)
+		}
+	}
+}
+
+// clipDraw clips the rectangle to the bounds of both images
+// like draw.Draw and moves the source point to match
+func clipDraw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) (image.Rectangle, image.Point) {
+	orig := r.Min
+	r = r.Intersect(dst.Bounds())
+	r = r.Intersect(src.Bounds().Add(orig.Sub(sp)))
+	return r, sp.Add(r.Min.Sub(orig))
+}
+
+// newColorSetter returns a function that stores a color in
+// the image and returns the color that actually got stored,
+// paletted images use the closest color of the palette
+func newColorSetter(dst draw.Image) func(x, y int, c Float4) Float4 {
+	p, ok := dst.(*image.Paletted)
+	if !ok {
+		return func(x, y int, c Float4) Float4 {
+			dst.Set(x, y, c)
+			return float4Model(dst.At(x, y)).(Float4)
+		}
+	}
+
+	pal := make([]Float4, len(p.Palette))
+	for i, c := range p.Palette {
+		pal[i] = float4Model(c).(Float4)
+	}
+
+	// colors repeat a lot, remember the closest color
+	// of every color seen at 8 bits of precision
+	cache := make(map[uint32]uint8)
+	return func(x, y int, c Float4) Float4 {
+		if len(pal) == 0 {
+			return Float4{}
+		}
+		key := RGBA32(color.RGBA{uint8(c[0] + .5), uint8(c[1] + .5), uint8(c[2] + .5), uint8(c[3] + .5)})
+		i, ok := cache[key]
+		if !ok {
+			i = uint8(closestFloat4(pal, c))
+			cache[key] = i
+		}
+		p.SetColorIndex(x, y, i)
+		return pal[i]
+	}
+}
+
+func closestFloat4(pal []Float4, c Float4) int {
+	best, dist := 0, math.MaxFloat64
+	for i, p := range pal {
+		d := 0.0
+		for k := range c {
+			d += (c[k] - p[k]) * (c[k] - p[k])
+		}
+		if d < dist {
+			best, dist = i, d
+		}
+	}
+	return best
+}
+
+// paletteSpacing returns the mean over the colors of the palette of
+// the largest channel difference to the closest other color
+func paletteSpacing(p color.Palette) float64 {
+	if len(p) < 2 {
+		return 255
+	}
+	pal := make([]Float4, len(p))
+	for i, c := range p {
+		pal[i] = float4Model(c).(Float4)
+	}
+
+	s := 0.0
+	for i, a := range pal {
+		best := math.MaxFloat64
+		for j, b := range pal {
+			if i == j {
+				continue
+			}
+			d := 0.0
+			for k := 0; k < 3; k++ {
+				d = math.Max(d, math.Abs(a[k]-b[k]))
+			}
+			if d > 0 {
+				best = math.Min(best, d)
+			}
+		}
+		if best == math.MaxFloat64 {
+			best = 0
+		}
+		s += best
+	}
+	return s / float64(len(pal))
+}
+
+func mod(x, n int) int {
+	x %= n
+	if x < 0 {
+		x += n
+	}
+	return x
+}
@@ -0,0 +1,174 @@
+package chroma
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// color spaces the gradients interpolate in
+const (
+	MIX_RGB = iota
+	MIX_LINEAR
+	MIX_HSL
+	MIX_OKLAB
+)
+
+// Stop is a color at a position along a gradient
+type Stop struct {
+	Pos   float64
+	Color color.Color
+}
+
+// Gradient blends between colors at positions along a line,
+// positions before the first stop or after the last one take
+// the color of that stop
+type Gradient struct {
+	Stops []Stop
+
+	// color space the colors are blended in, alpha
+	// is always blended separately as a straight value
+	Space int
+
+	// remaps the position between two stops in [0, 1],
+	// nil blends linearly
+	Ease func(t float64) float64
+}
+
+// NewGradient returns a gradient with the colors spaced evenly in [0, 1]
+func NewGradient(space int, cs ...color.Color) *Gradient {
+	g := &Gradient{Space: space}
+	for i, c := range cs {
+		t := 0.0
+		if len(cs) > 1 {
+			t = float64(i) / float64(len(cs)-1)
+		}
+		g.Stops = append(g.Stops, Stop{t, c})
+	}
+	return g
+}
+
+// Add inserts a stop keeping the stops sorted by position
+func (g *Gradient) Add(t float64, c color.Color) {
+	i := sort.Search(len(g.Stops), func(i int) bool {
+		return g.Stops[i].Pos > t
+	})
+	g.Stops = append(g.Stops, Stop{})
+	copy(g.Stops[i+1:], g.Stops[i:])
+	g.Stops[i] = Stop{t, c}
+}
+
+// At returns the color of the gradient at t
+func (g *Gradient) At(t float64) color.RGBA {
+	s := g.Stops
+	switch {
+	case len(s) == 0:
+		return color.RGBA{}
+	case t <= s[0].Pos:
+		return color.RGBAModel.Convert(s[0].Color).(color.RGBA)
+	case t >= s[len(s)-1].Pos:
+		return color.RGBAModel.Convert(s[len(s)-1].Color).(color.RGBA)
+	}
+
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].Pos > t
+	}) - 1
+	a, b := s[i], s[i+1]
+	u := 0.0
+	if d := b.Pos - a.Pos; d > 0 {
+		u = (t - a.Pos) / d
+	}
+	if g.Ease != nil {
+		u = g.Ease(u)
+	}
+	return mixSpace(a.Color, b.Color, u, g.Space)
+}
+
+// Colors returns n colors evenly spaced along the gradient from
+// the first stop to the last, useful as a lookup table
+func (g *Gradient) Colors(n int) []color.RGBA {
+	if len(g.Stops) == 0 || n <= 0 {
+		return nil
+	}
+	lo, hi := g.Stops[0].Pos, g.Stops[len(g.Stops)-1].Pos
+	cs := make([]color.RGBA, n)
+	for i := range cs {
+		t := lo
+		if n > 1 {
+			t = f64.Lerp(float64(i)/float64(n-1), lo, hi)
+		}
+		cs[i] = g.At(t)
+	}
+	return cs
+}
+
+// Palette is Colors as a color.Palette
+func (g *Gradient) Palette(n int) color.Palette {
+	var p color.Palette
+	for _, c := range g.Colors(n) {
+		p = append(p, c)
+	}
+	return p
+}
+
+// mixSpace blends two colors in the given color space
+func mixSpace(x, y color.Color, t float64, space int) color.RGBA {
+	a, b := straightVec3(x), straightVec3(y)
+	_, _, _, xa := x.RGBA()
+	_, _, _, ya := y.RGBA()
+	alpha := f64.Lerp(t, float64(xa), float64(ya)) / 0xffff
+
+	var v f64.Vec3
+	switch space {
+	case MIX_LINEAR:
+		v = Linear2SRGBVEC3(SRGB2LinearVEC3(a).Lerp(t, SRGB2LinearVEC3(b)))
+	case MIX_HSL:
+		p := HSV2HSL(VEC42HSV(f64.Vec4{a.X, a.Y, a.Z, 1}))
+		q := HSV2HSL(VEC42HSV(f64.Vec4{b.X, b.Y, b.Z, 1}))
+		// gray has no hue, keep the hue of the other color
+		if p.S == 0 {
+			p.H = q.H
+		}
+		if q.S == 0 {
+			q.H = p.H
+		}
+		// go around the hue circle the short way
+		if q.H-p.H > 0.5 {
+			p.H++
+		} else if p.H-q.H > 0.5 {
+			q.H++
+		}
+		h := MixHSL(p, q, t)
+		h.H -= math.Floor(h.H)
+		c := HSV2VEC4(HSL2HSV(h))
+		v = f64.Vec3{c.X, c.Y, c.Z}
+	case MIX_OKLAB:
+		v = OKLab2VEC3(MixOKLab(VEC32OKLab(a), VEC32OKLab(b), t))
+	default:
+		v = a.Lerp(t, b)
+	}
+	return toRGBA([4]float64{v.X * alpha * 255, v.Y * alpha * 255, v.Z * alpha * 255, alpha * 255})
+}
+
+// easing curves for gradients, they map [0, 1] onto itself
+func Smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func EaseInQuad(t float64) float64 {
+	return t * t
+}
+
+func EaseOutQuad(t float64) float64 {
+	return t * (2 - t)
+}
+
+func EaseInOutCubic(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	u := 2*t - 2
+	return 1 + u*u*u/2
+}
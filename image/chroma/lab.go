@@ -0,0 +1,343 @@
+package chroma
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// XYZ is a CIE 1931 tristimulus value with Y in [0, 1]
+type XYZ struct {
+	X, Y, Z float64
+}
+
+// Lab is a CIE 1976 L*a*b* color with L in [0, 100]
+type Lab struct {
+	L, A, B float64
+}
+
+// LCh is Lab in cylindrical coordinates,
+// the hue is in degrees in [0, 360)
+type LCh struct {
+	L, C, H float64
+}
+
+// OKLab is Björn Ottosson's perceptual color space
+// with L in [0, 1], it is relative to a D65 white
+type OKLab struct {
+	L, A, B float64
+}
+
+// OKLCh is OKLab in cylindrical coordinates,
+// the hue is in degrees in [0, 360)
+type OKLCh struct {
+	L, C, H float64
+}
+
+// white points of the standard illuminants for the 2° observer
+var (
+	D50 = XYZ{0.96422, 1, 0.82521}
+	D55 = XYZ{0.95682, 1, 0.92149}
+	D65 = XYZ{0.95047, 1, 1.08883}
+	D75 = XYZ{0.94972, 1, 1.22638}
+)
+
+var (
+	XYZModel   = color.ModelFunc(xyzModel)
+	LabModel   = color.ModelFunc(labModel)
+	LChModel   = color.ModelFunc(lchModel)
+	OKLabModel = color.ModelFunc(oklabModel)
+	OKLChModel = color.ModelFunc(oklchModel)
+)
+
+var (
+	// linear sRGB to XYZ with a D65 white
+	srgbToXYZ = f64.Mat3{
+		{0.4124564, 0.3575761, 0.1804375},
+		{0.2126729, 0.7151522, 0.0721750},
+		{0.0193339, 0.1191920, 0.9503041},
+	}
+	xyzToSRGB = f64.Mat3{
+		{3.2404542, -1.5371385, -0.4985314},
+		{-0.9692660, 1.8760108, 0.0415560},
+		{0.0556434, -0.2040259, 1.0572252},
+	}
+
+	// bradford cone response used for chromatic adaptation
+	bradford = f64.Mat3{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	bradfordInv = f64.Mat3{
+		{0.9869929, -0.1470543, 0.1599627},
+		{0.4323053, 0.5183603, 0.0492912},
+		{-0.0085287, 0.0400428, 0.9684867},
+	}
+)
+
+// straightVec3 returns the straight alpha sRGB values of a color in [0, 1]
+func straightVec3(c color.Color) f64.Vec3 {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return f64.Vec3{
+		float64(n.R) / 0xffff,
+		float64(n.G) / 0xffff,
+		float64(n.B) / 0xffff,
+	}
+}
+
+// opaqueRGBA converts sRGB values in [0, 1] to an opaque color
+func opaqueRGBA(v f64.Vec3) (r, g, b, a uint32) {
+	return unorm16(v.X * 255), unorm16(v.Y * 255), unorm16(v.Z * 255), 0xffff
+}
+
+func xyzModel(c color.Color) color.Color {
+	if c, ok := c.(XYZ); ok {
+		return c
+	}
+	return VEC32XYZ(straightVec3(c))
+}
+
+func labModel(c color.Color) color.Color {
+	if c, ok := c.(Lab); ok {
+		return c
+	}
+	return XYZ2Lab(VEC32XYZ(straightVec3(c)), D65)
+}
+
+func lchModel(c color.Color) color.Color {
+	if c, ok := c.(LCh); ok {
+		return c
+	}
+	return Lab2LCh(labModel(c).(Lab))
+}
+
+func oklabModel(c color.Color) color.Color {
+	if c, ok := c.(OKLab); ok {
+		return c
+	}
+	return VEC32OKLab(straightVec3(c))
+}
+
+func oklchModel(c color.Color) color.Color {
+	if c, ok := c.(OKLCh); ok {
+		return c
+	}
+	return OKLab2OKLCh(oklabModel(c).(OKLab))
+}
+
+func (c XYZ) RGBA() (r, g, b, a uint32) {
+	return opaqueRGBA(XYZ2VEC3(c))
+}
+
+// RGBA converts the color assuming a D65 white
+func (c Lab) RGBA() (r, g, b, a uint32) {
+	return Lab2XYZ(c, D65).RGBA()
+}
+
+func (c LCh) RGBA() (r, g, b, a uint32) {
+	return LCh2Lab(c).RGBA()
+}
+
+func (c OKLab) RGBA() (r, g, b, a uint32) {
+	return opaqueRGBA(OKLab2VEC3(c))
+}
+
+func (c OKLCh) RGBA() (r, g, b, a uint32) {
+	return OKLCh2OKLab(c).RGBA()
+}
+
+// SRGB2Linear removes the sRGB transfer curve from a value in [0, 1]
+func SRGB2Linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Linear2SRGB applies the sRGB transfer curve to a value in [0, 1]
+func Linear2SRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func SRGB2LinearVEC3(c f64.Vec3) f64.Vec3 {
+	return f64.Vec3{SRGB2Linear(c.X), SRGB2Linear(c.Y), SRGB2Linear(c.Z)}
+}
+
+func Linear2SRGBVEC3(c f64.Vec3) f64.Vec3 {
+	return f64.Vec3{Linear2SRGB(c.X), Linear2SRGB(c.Y), Linear2SRGB(c.Z)}
+}
+
+// VEC32XYZ converts sRGB values in [0, 1] to XYZ with a D65 white
+func VEC32XYZ(c f64.Vec3) XYZ {
+	return LinearRGB2XYZ(SRGB2LinearVEC3(c))
+}
+
+// XYZ2VEC3 converts XYZ with a D65 white to sRGB values, colors
+// outside of the sRGB gamut give values outside of [0, 1]
+func XYZ2VEC3(c XYZ) f64.Vec3 {
+	return encodeSRGB(XYZ2LinearRGB(c))
+}
+
+// encodeSRGB applies the sRGB curve to linear values
+// keeping the sign of the values that are negative
+func encodeSRGB(v f64.Vec3) f64.Vec3 {
+	sgn := func(x float64) float64 {
+		if x < 0 {
+			return -Linear2SRGB(-x)
+		}
+		return Linear2SRGB(x)
+	}
+	return f64.Vec3{sgn(v.X), sgn(v.Y), sgn(v.Z)}
+}
+
+func LinearRGB2XYZ(c f64.Vec3) XYZ {
+	v := srgbToXYZ.Transform(c)
+	return XYZ{v.X, v.Y, v.Z}
+}
+
+func XYZ2LinearRGB(c XYZ) f64.Vec3 {
+	return xyzToSRGB.Transform(f64.Vec3{c.X, c.Y, c.Z})
+}
+
+func RGB2XYZ(c color.RGBA) XYZ {
+	return xyzModel(c).(XYZ)
+}
+
+func XYZ2RGB(c XYZ) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+// AdaptXYZ moves a color seen under the white point src to the color
+// that looks the same under dst using the bradford transform
+func AdaptXYZ(c, src, dst XYZ) XYZ {
+	s := bradford.Transform(f64.Vec3{src.X, src.Y, src.Z})
+	d := bradford.Transform(f64.Vec3{dst.X, dst.Y, dst.Z})
+	v := bradford.Transform(f64.Vec3{c.X, c.Y, c.Z})
+	v = f64.Vec3{v.X * d.X / s.X, v.Y * d.Y / s.Y, v.Z * d.Z / s.Z}
+	v = bradfordInv.Transform(v)
+	return XYZ{v.X, v.Y, v.Z}
+}
+
+// XYZ2Lab converts a color to Lab relative to the white point w
+func XYZ2Lab(c, w XYZ) Lab {
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(c.X/w.X), f(c.Y/w.Y), f(c.Z/w.Z)
+	return Lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// Lab2XYZ converts a color in Lab relative to the white point w to XYZ
+func Lab2XYZ(c Lab, w XYZ) XYZ {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	f := func(t float64) float64 {
+		if t3 := t * t * t; t3 > 216.0/24389 {
+			return t3
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	return XYZ{f(fx) * w.X, f(fy) * w.Y, f(fz) * w.Z}
+}
+
+// RGB2Lab converts a color to Lab with a D65 white
+func RGB2Lab(c color.RGBA) Lab {
+	return labModel(c).(Lab)
+}
+
+func Lab2RGB(c Lab) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func Lab2LCh(c Lab) LCh {
+	l, ch, h := toPolar(c.L, c.A, c.B)
+	return LCh{l, ch, h}
+}
+
+func LCh2Lab(c LCh) Lab {
+	l, a, b := fromPolar(c.L, c.C, c.H)
+	return Lab{l, a, b}
+}
+
+// VEC32OKLab converts sRGB values in [0, 1] to OKLab
+func VEC32OKLab(c f64.Vec3) OKLab {
+	v := SRGB2LinearVEC3(c)
+	l := math.Cbrt(0.4122214708*v.X + 0.5363325363*v.Y + 0.0514459929*v.Z)
+	m := math.Cbrt(0.2119034982*v.X + 0.6806995451*v.Y + 0.1073969566*v.Z)
+	s := math.Cbrt(0.0883024619*v.X + 0.2817188376*v.Y + 0.6299787005*v.Z)
+	return OKLab{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// OKLab2VEC3 converts OKLab to sRGB values, colors outside
+// of the sRGB gamut give values outside of [0, 1]
+func OKLab2VEC3(c OKLab) f64.Vec3 {
+	l := c.L + 0.3963377774*c.A + 0.2158037573*c.B
+	m := c.L - 0.1055613458*c.A - 0.0638541728*c.B
+	s := c.L - 0.0894841775*c.A - 1.2914855480*c.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return encodeSRGB(f64.Vec3{
+		4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s,
+	})
+}
+
+func RGB2OKLab(c color.RGBA) OKLab {
+	return oklabModel(c).(OKLab)
+}
+
+func OKLab2RGB(c OKLab) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func OKLab2OKLCh(c OKLab) OKLCh {
+	l, ch, h := toPolar(c.L, c.A, c.B)
+	return OKLCh{l, ch, h}
+}
+
+func OKLCh2OKLab(c OKLCh) OKLab {
+	l, a, b := fromPolar(c.L, c.C, c.H)
+	return OKLab{l, a, b}
+}
+
+func MixLab(a, b Lab, t float64) Lab {
+	return Lab{
+		a.L*(1-t) + t*b.L,
+		a.A*(1-t) + t*b.A,
+		a.B*(1-t) + t*b.B,
+	}
+}
+
+func MixOKLab(a, b OKLab, t float64) OKLab {
+	return OKLab{
+		a.L*(1-t) + t*b.L,
+		a.A*(1-t) + t*b.A,
+		a.B*(1-t) + t*b.B,
+	}
+}
+
+func toPolar(l, a, b float64) (float64, float64, float64) {
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return l, math.Hypot(a, b), h
+}
+
+func fromPolar(l, c, h float64) (float64, float64, float64) {
+	s, co := math.Sincos(h * math.Pi / 180)
+	return l, c * co, c * s
+}
@@ -0,0 +1,355 @@
+package chroma
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// MedianCut is a draw.Quantizer that splits the box of colors with
+// the largest spread at the median of its longest side until there
+// are as many boxes as colors wanted, the colors are the box means
+type MedianCut struct{}
+
+// Octree is a draw.Quantizer that builds an octree of the colors and
+// merges the least used leaves into their parents until there are
+// as many leaves as colors wanted
+type Octree struct{}
+
+// KMeans is a draw.Quantizer that starts from the median cut palette
+// and moves the colors to the center of the pixels closest to them,
+// the distances are measured in Lab so the colors end up spread
+// according to how different they look rather than their values
+type KMeans struct {
+	// number of refinement passes, zero means 8
+	Iterations int
+}
+
+// colorCount is a color in the image with how
+// many pixels have it, the channels are in [0, 255]
+type colorCount struct {
+	c [4]float64
+	n int
+}
+
+// Quantize returns a palette of up to n colors for the image
+func Quantize(m image.Image, n int, q draw.Quantizer) color.Palette {
+	return q.Quantize(make(color.Palette, 0, n), m)
+}
+
+func (MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	for _, b := range medianCut(colorHistogram(m), paletteRoom(p)) {
+		p = append(p, meanColor(b))
+	}
+	return p
+}
+
+func (Octree) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := paletteRoom(p)
+	if n == 0 {
+		return p
+	}
+	t := &octree{}
+	for _, c := range colorHistogram(m) {
+		t.insert(c)
+	}
+	t.reduce(n)
+	t.root.walk(func(o *octNode) {
+		var c [4]float64
+		for i := range c {
+			c[i] = o.sum[i] / float64(o.n)
+		}
+		p = append(p, toRGBA(c))
+	})
+	return p
+}
+
+func (k KMeans) Quantize(p color.Palette, m image.Image) color.Palette {
+	iter := k.Iterations
+	if iter <= 0 {
+		iter = 8
+	}
+
+	h := colorHistogram(m)
+	labs := make([]Lab, len(h))
+	for i, c := range h {
+		labs[i] = labModel(toRGBA(c.c)).(Lab)
+	}
+
+	type center struct {
+		lab   Lab
+		alpha float64
+	}
+	var cs []center
+	for _, b := range medianCut(h, paletteRoom(p)) {
+		c := meanColor(b)
+		cs = append(cs, center{labModel(c).(Lab), float64(c.A)})
+	}
+	if len(cs) == 0 {
+		return p
+	}
+
+	owner := make([]int, len(h))
+	for pass := 0; pass < iter; pass++ {
+		moved := pass == 0
+		for i, l := range labs {
+			best, dist := 0, math.MaxFloat64
+			for j, c := range cs {
+				dl, da, db := l.L-c.lab.L, l.A-c.lab.A, l.B-c.lab.B
+				if d := dl*dl + da*da + db*db; d < dist {
+					best, dist = j, d
+				}
+			}
+			if owner[i] != best {
+				owner[i], moved = best, true
+			}
+		}
+		if !moved {
+			break
+		}
+
+		sums := make([][5]float64, len(cs))
+		for i, l := range labs {
+			w := float64(h[i].n)
+			s := &sums[owner[i]]
+			s[0] += l.L * w
+			s[1] += l.A * w
+			s[2] += l.B * w
+			s[3] += h[i].c[3] * w
+			s[4] += w
+		}
+		for i, s := range sums {
+			if s[4] > 0 {
+				cs[i] = center{Lab{s[0] / s[4], s[1] / s[4], s[2] / s[4]}, s[3] / s[4]}
+			}
+		}
+	}
+
+	for _, c := range cs {
+		v := XYZ2VEC3(Lab2XYZ(c.lab, D65))
+		a := c.alpha / 255
+		p = append(p, toRGBA([4]float64{v.X * a * 255, v.Y * a * 255, v.Z * a * 255, c.alpha}))
+	}
+	return p
+}
+
+// paletteRoom returns how many colors can be added to the palette,
+// the spare capacity if there is any up to 256 colors in total
+func paletteRoom(p color.Palette) int {
+	n := max(256-len(p), 0)
+	if m := cap(p) - len(p); m > 0 {
+		n = min(n, m)
+	}
+	return n
+}
+
+// colorHistogram returns the distinct colors of the image
+func colorHistogram(m image.Image) []colorCount {
+	counts := make(map[uint32]int)
+	r := m.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+			counts[RGBA32(c)]++
+		}
+	}
+
+	h := make([]colorCount, 0, len(counts))
+	for k, n := range counts {
+		h = append(h, colorCount{
+			c: [4]float64{float64(k & 0xff), float64(k >> 8 & 0xff), float64(k >> 16 & 0xff), float64(k >> 24)},
+			n: n,
+		})
+	}
+	// map order is random, keep the results repeatable
+	sort.Slice(h, func(i, j int) bool {
+		a, b := h[i].c, h[j].c
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return h
+}
+
+// medianCut splits the colors into at most n boxes
+func medianCut(h []colorCount, n int) [][]colorCount {
+	if len(h) == 0 || n <= 0 {
+		return nil
+	}
+
+	type box struct {
+		cs    []colorCount
+		axis  int
+		score float64
+	}
+	measure := func(cs []colorCount) box {
+		lo := [4]float64{255, 255, 255, 255}
+		hi := [4]float64{}
+		pop := 0
+		for _, c := range cs {
+			for i := range c.c {
+				lo[i] = math.Min(lo[i], c.c[i])
+				hi[i] = math.Max(hi[i], c.c[i])
+			}
+			pop += c.n
+		}
+		b := box{cs: cs}
+		for i := range lo {
+			if d := hi[i] - lo[i]; d > hi[b.axis]-lo[b.axis] {
+				b.axis = i
+			}
+		}
+		if len(cs) > 1 {
+			b.score = (hi[b.axis] - lo[b.axis]) * float64(pop)
+		}
+		return b
+	}
+
+	bs := []box{measure(h)}
+	for len(bs) < n {
+		k := 0
+		for i := range bs {
+			if bs[i].score > bs[k].score {
+				k = i
+			}
+		}
+		b := bs[k]
+		if b.score == 0 {
+			break
+		}
+
+		sort.Slice(b.cs, func(i, j int) bool {
+			return b.cs[i].c[b.axis] < b.cs[j].c[b.axis]
+		})
+		total := 0
+		for _, c := range b.cs {
+			total += c.n
+		}
+		i, s := 0, 0
+		for ; i < len(b.cs)-1; i++ {
+			s += b.cs[i].n
+			if 2*s >= total {
+				break
+			}
+		}
+		bs[k] = measure(b.cs[:i+1])
+		bs = append(bs, measure(b.cs[i+1:]))
+	}
+
+	cs := make([][]colorCount, len(bs))
+	for i := range bs {
+		cs[i] = bs[i].cs
+	}
+	return cs
+}
+
+func meanColor(cs []colorCount) color.RGBA {
+	var s [4]float64
+	n := 0.0
+	for _, c := range cs {
+		for i := range s {
+			s[i] += c.c[i] * float64(c.n)
+		}
+		n += float64(c.n)
+	}
+	for i := range s {
+		s[i] /= n
+	}
+	return toRGBA(s)
+}
+
+func toRGBA(c [4]float64) color.RGBA {
+	a := f64.Clamp8(c[3], 0, 255)
+	return color.RGBA{
+		f64.Clamp8(c[0], 0, float64(a)),
+		f64.Clamp8(c[1], 0, float64(a)),
+		f64.Clamp8(c[2], 0, float64(a)),
+		a,
+	}
+}
+
+type octNode struct {
+	kids [8]*octNode
+	sum  [4]float64
+	n    int
+	leaf bool
+}
+
+type octree struct {
+	root   octNode
+	levels [8][]*octNode
+	leaves int
+}
+
+func (t *octree) insert(c colorCount) {
+	o := &t.root
+	if t.levels[0] == nil {
+		t.levels[0] = []*octNode{o}
+	}
+	for l := 0; l < 8; l++ {
+		o.n += c.n
+		s := 7 - l
+		r, g, b := int(c.c[0]), int(c.c[1]), int(c.c[2])
+		i := (r>>s&1)<<2 | (g>>s&1)<<1 | b>>s&1
+		if o.kids[i] == nil {
+			o.kids[i] = &octNode{leaf: l == 7}
+			if l < 7 {
+				t.levels[l+1] = append(t.levels[l+1], o.kids[i])
+			} else {
+				t.leaves++
+			}
+		}
+		o = o.kids[i]
+	}
+	o.n += c.n
+	for i := range c.c {
+		o.sum[i] += c.c[i] * float64(c.n)
+	}
+}
+
+// reduce merges the least used nodes of the deepest
+// level into leaves until there are at most n leaves
+func (t *octree) reduce(n int) {
+	for l := 7; l >= 0 && t.leaves > n; l-- {
+		ns := t.levels[l]
+		sort.SliceStable(ns, func(i, j int) bool {
+			return ns[i].n < ns[j].n
+		})
+		for _, o := range ns {
+			if t.leaves <= n {
+				break
+			}
+			for i, k := range o.kids {
+				if k == nil {
+					continue
+				}
+				for j := range o.sum {
+					o.sum[j] += k.sum[j]
+				}
+				o.kids[i] = nil
+				t.leaves--
+			}
+			o.leaf = true
+			t.leaves++
+		}
+	}
+}
+
+func (o *octNode) walk(fn func(*octNode)) {
+	if o.leaf {
+		fn(o)
+		return
+	}
+	for _, k := range o.kids {
+		if k != nil {
+			k.walk(fn)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
+	"image/color"
 	"image/png"
 	"io"
 	"io/ioutil"
@@ -52,6 +53,7 @@ func Encode(w io.Writer, f *File) error {
 		direntLen = 16
 	)
 
+	var data []*bytes.Buffer
 	off := headerLen + direntLen*uint32(h.Entries)
 	for i, m := range f.Image {
 		p := new(bytes.Buffer)
@@ -64,14 +66,16 @@ func Encode(w io.Writer, f *File) error {
 			return fmt.Errorf("ico: image %d is too big", i)
 		}
 
+		// a dimension of 256 is stored as 0
 		r := m.Bounds()
-		if r.Dx() >= math.MaxUint8 || r.Dy() >= math.MaxUint8 {
+		if r.Dx() > 256 || r.Dy() > 256 {
 			return fmt.Errorf("ico: image %d with dimension %dx%d is too big", i, r.Dx(), r.Dy())
 		}
 
 		d := dirent{
 			Width:  uint8(r.Dx()),
 			Height: uint8(r.Dy()),
+			Planes: 1,
 			Bpp:    32,
 			Size:   uint32(p.Len()),
 			Off:    off,
@@ -82,6 +86,11 @@ func Encode(w io.Writer, f *File) error {
 			return fmt.Errorf("ico: too many images")
 		}
 		off += uint32(p.Len())
+		data = append(data, p)
+	}
+
+	for _, p := range data {
+		b.Write(p.Bytes())
 	}
 
 	return b.Flush()
@@ -128,6 +137,66 @@ func Decode(r io.Reader) (*File, error) {
 	return f, nil
 }
 
+// DecodeImage decodes the largest image in the file
+func DecodeImage(r io.Reader) (image.Image, error) {
+	f, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Image) == 0 {
+		return nil, fmt.Errorf("ico: file has no images")
+	}
+
+	m := f.Image[0]
+	for _, p := range f.Image[1:] {
+		if area(p.Bounds()) > area(m.Bounds()) {
+			m = p
+		}
+	}
+	return m, nil
+}
+
+// DecodeConfig returns the dimension of the largest image in the file
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	var h header
+	err := binary.Read(r, binary.LittleEndian, &h)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	var c image.Config
+	for i := 0; i < int(h.Entries); i++ {
+		var d dirent
+		err = binary.Read(r, binary.LittleEndian, &d)
+		if err != nil {
+			return image.Config{}, err
+		}
+
+		w, h := int(d.Width), int(d.Height)
+		if w == 0 {
+			w = 256
+		}
+		if h == 0 {
+			h = 256
+		}
+		if w*h > c.Width*c.Height {
+			c = image.Config{
+				ColorModel: color.NRGBAModel,
+				Width:      w,
+				Height:     h,
+			}
+		}
+	}
+	if c.ColorModel == nil {
+		return c, fmt.Errorf("ico: file has no images")
+	}
+	return c, nil
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
+
 func decodeBMP(n int, d *dirent, b []byte) (image.Image, error) {
 	const (
 		fileHeaderLen = 14
@@ -150,10 +219,10 @@ func decodeBMP(n int, d *dirent, b []byte) (image.Image, error) {
 
 	b = append([]uint8{
 		'B', 'M',
-		uint8(sz), uint8(sz >> 8), uint8(sz >> 16), uint8(sz >> 32),
+		uint8(sz), uint8(sz >> 8), uint8(sz >> 16), uint8(sz >> 24),
 		0, 0,
 		0, 0,
-		uint8(off), uint8(off >> 8), uint8(off >> 16), uint8(off >> 32),
+		uint8(off), uint8(off >> 8), uint8(off >> 16), uint8(off >> 24),
 	}, b...)
 
 	return bmp.Decode(bytes.NewReader(b))
@@ -162,3 +231,7 @@ func decodeBMP(n int, d *dirent, b []byte) (image.Image, error) {
 func readUint16(b []byte) uint16 {
 	return uint16(b[0]) | uint16(b[1])<<8
 }
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", DecodeImage, DecodeConfig)
+}
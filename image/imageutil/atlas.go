@@ -0,0 +1,263 @@
+package imageutil
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+
+	"github.com/qeedquan/go-media/math/mathutil"
+)
+
+var (
+	ErrAtlasFull = errors.New("imageutil: images do not fit in the atlas")
+)
+
+type AtlasOptions struct {
+	// packing method, PackMaxRects or PackSkyline
+	Method int
+
+	// empty pixels between the images and
+	// between the images and the atlas edges
+	Padding int
+
+	// number of times the edge pixels of each image are
+	// repeated around it, to keep filtering from bleeding
+	// in the padding, this is added on top of the padding
+	Extrude int
+
+	// allow images to be turned 90 degrees clockwise
+	// if that makes them fit better
+	Rotate bool
+
+	// round the atlas size up to powers of two
+	PowerOfTwo bool
+
+	// largest size the atlas can grow to,
+	// zero means 4096x4096
+	MaxSize image.Point
+}
+
+// AtlasRect is where an image is stored inside of the atlas,
+// the size is the size inside the atlas so it is swapped if
+// the image was rotated, UV holds the texture coordinates
+// of the top left and bottom right corners
+type AtlasRect struct {
+	X       int        `json:"x"`
+	Y       int        `json:"y"`
+	W       int        `json:"w"`
+	H       int        `json:"h"`
+	Rotated bool       `json:"rotated,omitempty"`
+	UV      [4]float64 `json:"uv"`
+}
+
+type Atlas struct {
+	Image  *image.RGBA          `json:"-"`
+	Width  int                  `json:"width"`
+	Height int                  `json:"height"`
+	Rects  map[string]AtlasRect `json:"rects"`
+}
+
+func (r AtlasRect) Bounds() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H)
+}
+
+// BuildAtlas packs the images into one, the atlas starts as
+// small as the area of the images allows and grows until they
+// all fit, the images are placed largest first in name order
+// so the same input gives the same atlas
+func BuildAtlas(imgs map[string]image.Image, o *AtlasOptions) (*Atlas, error) {
+	if o == nil {
+		o = &AtlasOptions{}
+	}
+	maxSize := o.MaxSize
+	if maxSize.X <= 0 || maxSize.Y <= 0 {
+		maxSize = image.Pt(4096, 4096)
+	}
+
+	pad, ext := max(o.Padding, 0), max(o.Extrude, 0)
+	border := 2*ext + pad
+
+	type item struct {
+		name string
+		m    image.Image
+		size image.Point
+	}
+	var items []item
+	area := 0
+	for name, m := range imgs {
+		s := m.Bounds().Size().Add(image.Pt(border, border))
+		items = append(items, item{name, m, s})
+		area += s.X * s.Y
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i].size, items[j].size
+		if x, y := max(a.X, a.Y), max(b.X, b.Y); x != y {
+			return x > y
+		}
+		if x, y := a.X*a.Y, b.X*b.Y; x != y {
+			return x > y
+		}
+		return items[i].name < items[j].name
+	})
+
+	// start from a square that can hold all the area
+	// and grow the shorter side every time it fails
+	w, h := 1, 1
+	for w*h < area {
+		if w <= h {
+			w *= 2
+		} else {
+			h *= 2
+		}
+	}
+	for _, it := range items {
+		w = max(w, it.size.X+pad)
+		h = max(h, it.size.Y+pad)
+	}
+	if o.PowerOfTwo {
+		w, h = mathutil.NextPow2(w), mathutil.NextPow2(h)
+	}
+	w, h = min(w, maxSize.X), min(h, maxSize.Y)
+
+	var (
+		rects   []image.Rectangle
+		rotated []bool
+	)
+	for {
+		p := NewRectPacker(w-pad, h-pad, o.Method, o.Rotate)
+		rects, rotated = rects[:0], rotated[:0]
+		for _, it := range items {
+			r, rot, ok := p.Insert(it.size.X, it.size.Y)
+			if !ok {
+				break
+			}
+			rects = append(rects, r)
+			rotated = append(rotated, rot)
+		}
+		if len(rects) == len(items) {
+			break
+		}
+
+		if w >= maxSize.X && h >= maxSize.Y {
+			return nil, ErrAtlasFull
+		}
+		if (w <= h || h >= maxSize.Y) && w < maxSize.X {
+			w = min(grow(w, o.PowerOfTwo), maxSize.X)
+		} else {
+			h = min(grow(h, o.PowerOfTwo), maxSize.Y)
+		}
+	}
+
+	// shrink to what was used
+	used := image.Rectangle{}
+	for _, r := range rects {
+		used = used.Union(r)
+	}
+	w, h = used.Max.X+pad, used.Max.Y+pad
+	if o.PowerOfTwo {
+		w, h = mathutil.NextPow2(w), mathutil.NextPow2(h)
+	}
+
+	a := &Atlas{
+		Image:  image.NewRGBA(image.Rect(0, 0, w, h)),
+		Width:  w,
+		Height: h,
+		Rects:  make(map[string]AtlasRect),
+	}
+	for i, it := range items {
+		// the slot has the padding on its top left and
+		// the extruded pixels all around the image
+		r := rects[i].Add(image.Pt(pad+ext, pad+ext))
+		r.Max = r.Max.Sub(image.Pt(pad+2*ext, pad+2*ext))
+
+		m := it.m
+		if rotated[i] {
+			m = rotateCW(m)
+		}
+		draw.Draw(a.Image, r, m, m.Bounds().Min, draw.Src)
+		extrude(a.Image, r, ext)
+
+		a.Rects[it.name] = AtlasRect{
+			X:       r.Min.X,
+			Y:       r.Min.Y,
+			W:       r.Dx(),
+			H:       r.Dy(),
+			Rotated: rotated[i],
+			UV: [4]float64{
+				float64(r.Min.X) / float64(w),
+				float64(r.Min.Y) / float64(h),
+				float64(r.Max.X) / float64(w),
+				float64(r.Max.Y) / float64(h),
+			},
+		}
+	}
+	return a, nil
+}
+
+// SubImage returns the part of the atlas holding the named image
+func (a *Atlas) SubImage(name string) (*image.RGBA, bool) {
+	r, ok := a.Rects[name]
+	if !ok {
+		return nil, false
+	}
+	return a.Image.SubImage(r.Bounds()).(*image.RGBA), true
+}
+
+// WriteJSON writes the size of the atlas and
+// where each image is stored inside of it
+func (a *Atlas) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	return e.Encode(a)
+}
+
+// LoadAtlasJSON reads the rectangles of an atlas,
+// the image has to be loaded separately
+func LoadAtlasJSON(r io.Reader) (*Atlas, error) {
+	a := &Atlas{}
+	err := json.NewDecoder(r).Decode(a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func grow(n int, pot bool) int {
+	if pot {
+		return mathutil.NextPow2(n + 1)
+	}
+	return n + max(n/4, 1)
+}
+
+// rotateCW turns an image 90 degrees clockwise
+func rotateCW(m image.Image) *image.RGBA {
+	b := m.Bounds()
+	p := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p.Set(b.Max.Y-1-y, x-b.Min.X, m.At(x, y))
+		}
+	}
+	return p
+}
+
+// extrude repeats the edge pixels of r n times around it
+func extrude(m *image.RGBA, r image.Rectangle, n int) {
+	if n <= 0 || r.Empty() {
+		return
+	}
+	e := r.Inset(-n).Intersect(m.Bounds())
+	for y := e.Min.Y; y < e.Max.Y; y++ {
+		for x := e.Min.X; x < e.Max.X; x++ {
+			if image.Pt(x, y).In(r) {
+				continue
+			}
+			sx := clamp(x, r.Min.X, r.Max.X-1)
+			sy := clamp(y, r.Min.Y, r.Max.Y-1)
+			m.SetRGBA(x, y, m.RGBAAt(sx, sy))
+		}
+	}
+}
@@ -4,61 +4,322 @@ import (
 	"image"
 	"math"
 
-	"github.com/qeedquan/go-media/math/f64"
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/image/internal/parallel"
 )
 
+// sigma above which a gaussian blur is approximated with
+// three box blurs, the kernels get too wide to convolve
+// with directly and the approximation is within a few percent
+const boxBlurSigma = 4
+
+// number of columns filtered together in a vertical pass
+const bandWidth = 32
+
 func GaussianBlur(m image.Image, s float64) *image.RGBA {
-	n := gaussKernelSize(s)
-	k := gaussCoeff(n, s)
-	p := Filter(m, k, &FilterOptions{
+	f := ImageToFloat(m)
+	f.GaussianBlur(s, &FilterOptions{
 		Op:   OpConv,
 		Wrap: WrapRepeat,
 	})
-	return p.ToRGBA()
+	return f.ToRGBA()
 }
 
-func gaussKernelSize(s float64) int {
-	return 1 + int(2*math.Ceil(math.Sqrt(-2*s*s*math.Log(0.005))))
+func BoxBlur(m image.Image, r int) *image.RGBA {
+	f := ImageToFloat(m)
+	f.BoxBlur(r, &FilterOptions{
+		Op:   OpConv,
+		Wrap: WrapRepeat,
+	})
+	return f.ToRGBA()
 }
 
-func gaussCoeff(n int, s float64) [][]float64 {
-	w := genMatrix(n, n)
-	f := func(x, y float64) float64 {
-		return gauss2D(x, y, 0, 0, s)
+// GaussianBlur blurs the image in place, small sigmas are
+// convolved with a separable kernel and large sigmas use
+// three passes of box blurs
+func (f *Float) GaussianBlur(s float64, o *FilterOptions) {
+	if s <= 0 {
+		return
 	}
 
-	const N = 50
-	wn := 0.0
-	for i := 0; i < n; i++ {
-		y0 := float64(i-n/2-1) + 0.5
-		y1 := y0 + 1
-		for j := 0; j < n; j++ {
-			x0 := float64(j-n/2-1) + 0.5
-			x1 := x0 + 1
-			w[i][j] = f64.Simpson2D(f, x0, x1, y0, y1, N, N)
-			wn += w[i][j]
+	if s > boxBlurSigma {
+		for _, r := range boxRadii(s, 3) {
+			f.BoxBlur(r, o)
+		}
+		return
+	}
+
+	k := gaussCoeff(gaussKernelSize(s), s)
+	f.FilterSeparable(k, k, o)
+}
+
+// BoxBlur averages every pixel with the pixels at most r
+// away on each axis, it takes constant time per pixel
+// no matter the radius
+func (f *Float) BoxBlur(r int, o *FilterOptions) {
+	if o == nil {
+		o = &FilterOptions{Wrap: WrapRepeat}
+	}
+	if r <= 0 {
+		return
+	}
+
+	f.horizontal(o, func(dst, src []chroma.Float4) {
+		boxLine(dst, src, r, o.Wrap)
+	})
+	f.vertical(o, func(dst, src []chroma.Float4, bw int) {
+		boxBand(dst, f.Stride, src, bw, len(src)/bw, r, o.Wrap)
+	})
+}
+
+// FilterSeparable filters the image with the kernel formed by
+// the outer product of ky and kx, it is the same as Filter on
+// that kernel but takes len(kx)+len(ky) operations per pixel,
+// an empty kernel leaves that axis alone
+func (f *Float) FilterSeparable(kx, ky []float64, o *FilterOptions) {
+	if o == nil {
+		o = &FilterOptions{
+			Op:   OpConv,
+			Wrap: WrapRepeat,
 		}
 	}
-	for i := range w {
-		for j := range w[i] {
-			w[i][j] /= wn
+
+	// convolving is correlating with the flipped kernel
+	if o.Op == OpConv {
+		kx = flipKernel(kx)
+		ky = flipKernel(ky)
+	}
+
+	if len(kx) > 0 {
+		f.horizontal(o, func(dst, src []chroma.Float4) {
+			correlateLine(dst, src, kx, o.Wrap)
+		})
+	}
+	if len(ky) > 0 {
+		f.vertical(o, func(dst, src []chroma.Float4, bw int) {
+			correlateBand(dst, f.Stride, src, bw, len(src)/bw, ky, o.Wrap)
+		})
+	}
+}
+
+// horizontal calls fn on every row with a copy of the row to
+// read from, the rows are split among the workers
+func (f *Float) horizontal(o *FilterOptions, fn func(dst, src []chroma.Float4)) {
+	w, h := f.Rect.Dx(), f.Rect.Dy()
+	nw := parallel.Workers(o.Workers)
+	bufs := make([][]chroma.Float4, nw)
+	parallel.Lines(h, nw, func(n, lo, hi int) {
+		if bufs[n] == nil {
+			bufs[n] = make([]chroma.Float4, w)
+		}
+		buf := bufs[n]
+		for y := lo; y < hi; y++ {
+			row := f.Pix[y*f.Stride : y*f.Stride+w]
+			copy(buf, row)
+			fn(row, buf)
 		}
+	})
+}
+
+// vertical splits the image into bands of columns and calls
+// fn on each band with a copy of the band to read from, the
+// copy is stored row by row with a stride of bw
+func (f *Float) vertical(o *FilterOptions, fn func(dst, src []chroma.Float4, bw int)) {
+	w, h := f.Rect.Dx(), f.Rect.Dy()
+	if w <= 0 || h <= 0 {
+		return
 	}
-	return w
+
+	nb := (w + bandWidth - 1) / bandWidth
+	nw := parallel.Workers(o.Workers)
+	bufs := make([][]chroma.Float4, nw)
+	parallel.Lines(nb, nw, func(n, lo, hi int) {
+		if bufs[n] == nil {
+			bufs[n] = make([]chroma.Float4, bandWidth*h)
+		}
+		for b := lo; b < hi; b++ {
+			x0 := b * bandWidth
+			bw := min(bandWidth, w-x0)
+			buf := bufs[n][:bw*h]
+			for y := 0; y < h; y++ {
+				copy(buf[y*bw:(y+1)*bw], f.Pix[y*f.Stride+x0:])
+			}
+			fn(f.Pix[x0:], buf, bw)
+		}
+	})
 }
 
-func gauss2D(x, y, mx, my, s float64) float64 {
-	dx := x - mx
-	dy := y - my
-	n := 1 / (2 * math.Pi * s * s)
-	return n * math.Exp(-(dx*dx+dy*dy)/(2*s*s))
+// correlateLine correlates src with the kernel centered at
+// len(k)/2 and writes the result to dst
+func correlateLine(dst, src []chroma.Float4, k []float64, wrap int) {
+	n := len(src)
+	c := len(k) / 2
+	for i := range dst {
+		var s chroma.Float4
+		for j, w := range k {
+			x := i + j - c
+			if x < 0 || x >= n {
+				if wrap != WrapRepeat {
+					continue
+				}
+				x = clamp(x, 0, n-1)
+			}
+			p := &src[x]
+			s[0] += p[0] * w
+			s[1] += p[1] * w
+			s[2] += p[2] * w
+			s[3] += p[3] * w
+		}
+		dst[i] = s
+	}
 }
 
-func genMatrix(r, c int) [][]float64 {
-	p := make([][]float64, r)
-	q := make([]float64, r*c)
-	for i := range p {
-		p[i] = q[i*c : (i+1)*c]
+// correlateBand is correlateLine down the columns of a band,
+// every output row accumulates whole rows of the band
+func correlateBand(dst []chroma.Float4, stride int, src []chroma.Float4, bw, h int, k []float64, wrap int) {
+	c := len(k) / 2
+	acc := make([]chroma.Float4, bw)
+	for y := 0; y < h; y++ {
+		for x := range acc {
+			acc[x] = chroma.Float4{}
+		}
+		for j, w := range k {
+			yy := y + j - c
+			if yy < 0 || yy >= h {
+				if wrap != WrapRepeat {
+					continue
+				}
+				yy = clamp(yy, 0, h-1)
+			}
+			row := src[yy*bw : (yy+1)*bw]
+			for x, p := range row {
+				a := &acc[x]
+				a[0] += p[0] * w
+				a[1] += p[1] * w
+				a[2] += p[2] * w
+				a[3] += p[3] * w
+			}
+		}
+		copy(dst[y*stride:y*stride+bw], acc)
+	}
+}
+
+// boxLine averages a window of 2r+1 samples with a running sum
+func boxLine(dst, src []chroma.Float4, r, wrap int) {
+	n := len(src)
+	get := func(x int) chroma.Float4 {
+		if x < 0 || x >= n {
+			if wrap != WrapRepeat {
+				return chroma.Float4{}
+			}
+			x = clamp(x, 0, n-1)
+		}
+		return src[x]
+	}
+
+	var s chroma.Float4
+	for x := -r; x <= r; x++ {
+		addFloat4(&s, get(x), 1)
+	}
+
+	inv := 1 / float64(2*r+1)
+	for i := range dst {
+		dst[i] = chroma.Float4{s[0] * inv, s[1] * inv, s[2] * inv, s[3] * inv}
+		addFloat4(&s, get(i+r+1), 1)
+		addFloat4(&s, get(i-r), -1)
+	}
+}
+
+// boxBand is boxLine down the columns of a band
+func boxBand(dst []chroma.Float4, stride int, src []chroma.Float4, bw, h, r, wrap int) {
+	row := func(y int) []chroma.Float4 {
+		if y < 0 || y >= h {
+			if wrap != WrapRepeat {
+				return nil
+			}
+			y = clamp(y, 0, h-1)
+		}
+		return src[y*bw : (y+1)*bw]
+	}
+	add := func(s []chroma.Float4, p []chroma.Float4, w float64) {
+		for x := range p {
+			addFloat4(&s[x], p[x], w)
+		}
+	}
+
+	sum := make([]chroma.Float4, bw)
+	for y := -r; y <= r; y++ {
+		add(sum, row(y), 1)
+	}
+
+	inv := 1 / float64(2*r+1)
+	for y := 0; y < h; y++ {
+		out := dst[y*stride : y*stride+bw]
+		for x, s := range sum {
+			out[x] = chroma.Float4{s[0] * inv, s[1] * inv, s[2] * inv, s[3] * inv}
+		}
+		add(sum, row(y+r+1), 1)
+		add(sum, row(y-r), -1)
+	}
+}
+
+func addFloat4(s *chroma.Float4, p chroma.Float4, w float64) {
+	s[0] += p[0] * w
+	s[1] += p[1] * w
+	s[2] += p[2] * w
+	s[3] += p[3] * w
+}
+
+func flipKernel(k []float64) []float64 {
+	p := make([]float64, len(k))
+	for i := range k {
+		p[i] = k[len(k)-1-i]
 	}
 	return p
 }
+
+// boxRadii returns the radii of n box blurs that together
+// approximate a gaussian with the standard deviation s
+func boxRadii(s float64, n int) []int {
+	wi := math.Sqrt(12*s*s/float64(n) + 1)
+	wl := int(wi)
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+
+	mi := (12*s*s - float64(n*wl*wl+4*n*wl+3*n)) / float64(-4*wl-4)
+	m := int(math.Round(mi))
+
+	r := make([]int, n)
+	for i := range r {
+		w := wu
+		if i < m {
+			w = wl
+		}
+		r[i] = (w - 1) / 2
+	}
+	return r
+}
+
+func gaussKernelSize(s float64) int {
+	return 1 + int(2*math.Ceil(math.Sqrt(-2*s*s*math.Log(0.005))))
+}
+
+// gaussCoeff integrates the gaussian over the area of each
+// pixel, the outer product of the kernel with itself is the
+// 2D kernel since the gaussian is separable
+func gaussCoeff(n int, s float64) []float64 {
+	k := make([]float64, n)
+	wn := 0.0
+	d := s * math.Sqrt2
+	for i := range k {
+		x := float64(i - n/2)
+		k[i] = math.Erf((x+.5)/d) - math.Erf((x-.5)/d)
+		wn += k[i]
+	}
+	for i := range k {
+		k[i] /= wn
+	}
+	return k
+}
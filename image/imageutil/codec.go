@@ -0,0 +1,453 @@
+package imageutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/image/ico"
+	"github.com/qeedquan/go-media/image/pnm"
+	"github.com/qeedquan/go-media/image/psd"
+	"github.com/qeedquan/go-media/image/tga"
+	"golang.org/x/image/bmp"
+)
+
+var (
+	ErrFormat = errors.New("imageutil: unknown format")
+)
+
+// Codec describes a image format, Magic are the signatures
+// the data starts with where ? matches any byte, formats
+// that cannot be encoded have a nil Encode
+type Codec struct {
+	Name   string
+	Exts   []string
+	Magic  []string
+	Depths []int
+	Decode func(io.Reader) (image.Image, error)
+	Encode func(io.Writer, image.Image, *SaveOptions) error
+}
+
+// SaveOptions are the per format settings used when
+// encoding, nil settings use the defaults of the format
+type SaveOptions struct {
+	// name or extension of the format, if empty the
+	// extension of the file name is used
+	Format string
+
+	// bits per channel, zero means use the depth of the image,
+	// formats that cannot store the depth use the closest one
+	Depth int
+
+	JPEG *jpeg.Options
+	GIF  *gif.Options
+	PNG  *png.Encoder
+	PNM  *pnm.Options
+}
+
+var codecs []*Codec
+
+func init() {
+	RegisterCodec(&Codec{
+		Name:   "png",
+		Exts:   []string{".png"},
+		Magic:  []string{"\x89PNG\r\n\x1a\n"},
+		Depths: []int{8, 16},
+		Decode: png.Decode,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			e := o.PNG
+			if e == nil {
+				e = &png.Encoder{}
+			}
+			return e.Encode(w, m)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "jpeg",
+		Exts:   []string{".jpg", ".jpeg"},
+		Magic:  []string{"\xff\xd8"},
+		Depths: []int{8},
+		Decode: jpeg.Decode,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			jo := o.JPEG
+			if jo == nil {
+				jo = &jpeg.Options{Quality: 100}
+			}
+			return jpeg.Encode(w, m, jo)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "gif",
+		Exts:   []string{".gif"},
+		Magic:  []string{"GIF87a", "GIF89a"},
+		Depths: []int{8},
+		Decode: gif.Decode,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			gopt := gif.Options{NumColors: 256}
+			if o.GIF != nil {
+				gopt = *o.GIF
+			}
+			// the default of the encoder is the plan9 palette
+			if gopt.Quantizer == nil {
+				gopt.Quantizer = chroma.MedianCut{}
+			}
+			if gopt.Drawer == nil {
+				gopt.Drawer = chroma.FloydSteinberg
+			}
+			return gif.Encode(w, m, &gopt)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "bmp",
+		Exts:   []string{".bmp"},
+		Magic:  []string{"BM"},
+		Depths: []int{8},
+		Decode: bmp.Decode,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			return bmp.Encode(w, m)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "tga",
+		Exts:   []string{".tga"},
+		Magic:  []string{"?\x00\x02", "?\x00\x03", "?\x00\x0a", "?\x00\x0b"},
+		Depths: []int{8},
+		Decode: tga.Decode,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			return tga.Encode(w, m)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "pnm",
+		Exts:   []string{".pbm", ".pgm", ".ppm", ".pnm"},
+		Magic:  []string{"P1", "P2", "P3", "P4", "P5", "P6"},
+		Depths: []int{8, 16},
+		Decode: pnm.Decode,
+		Encode: encodePNM,
+	})
+	RegisterCodec(&Codec{
+		Name:   "pfm",
+		Exts:   []string{".pfm"},
+		Magic:  []string{"PF", "Pf"},
+		Depths: []int{32},
+		Decode: pnm.DecodePFM,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			return pnm.EncodePFM(w, pfmImage(m))
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:   "psd",
+		Exts:   []string{".psd"},
+		Magic:  []string{"8BPS"},
+		Depths: []int{8},
+		Decode: psd.Decode,
+	})
+	RegisterCodec(&Codec{
+		Name:   "ico",
+		Exts:   []string{".ico"},
+		Magic:  []string{"\x00\x00\x01\x00"},
+		Depths: []int{8},
+		Decode: ico.DecodeImage,
+		Encode: func(w io.Writer, m image.Image, o *SaveOptions) error {
+			return ico.Encode(w, &ico.File{Image: []image.Image{m}})
+		},
+	})
+}
+
+// RegisterCodec adds a codec to the registry, codecs
+// registered later take priority when sniffing or
+// looking up by name
+func RegisterCodec(c *Codec) {
+	codecs = append([]*Codec{c}, codecs...)
+}
+
+// LookupCodec finds a codec by name or by file extension
+func LookupCodec(name string) *Codec {
+	name = strings.ToLower(name)
+	for _, c := range codecs {
+		if c.Name == name {
+			return c
+		}
+		for _, ext := range c.Exts {
+			if ext == name || ext[1:] == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// SniffCodec finds the codec for the data from its signature
+func SniffCodec(b []byte) *Codec {
+	for _, c := range codecs {
+		for _, m := range c.Magic {
+			if match(m, b) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func match(magic string, b []byte) bool {
+	if len(magic) > len(b) {
+		return false
+	}
+	for i := range magic {
+		if magic[i] != b[i] && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeImage decodes a image in any format the repo knows
+// about, returning the name of the format, formats registered
+// with the image package are tried if the signature is unknown
+func DecodeImage(r io.Reader) (image.Image, string, error) {
+	br := bufio.NewReader(r)
+	b, _ := br.Peek(16)
+	if c := SniffCodec(b); c != nil && c.Decode != nil {
+		m, err := c.Decode(br)
+		return m, c.Name, err
+	}
+	return image.Decode(br)
+}
+
+// LoadImageFile decodes a image file, if the signature does
+// not match any format the extension is used to pick one
+func LoadImageFile(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, _, err := DecodeImage(f)
+	if err != nil {
+		c := LookupCodec(filepath.Ext(name))
+		if c != nil && c.Decode != nil {
+			f.Seek(0, io.SeekStart)
+			var xerr error
+			m, xerr = c.Decode(f)
+			if xerr == nil {
+				return m, nil
+			}
+		}
+		return nil, &os.PathError{Op: "decode", Path: name, Err: err}
+	}
+	return m, nil
+}
+
+// EncodeImage encodes the image in the named format, the image
+// is converted to the depth requested if the format supports it
+func EncodeImage(w io.Writer, format string, m image.Image, o *SaveOptions) error {
+	if o == nil {
+		o = &SaveOptions{}
+	}
+
+	c := LookupCodec(format)
+	if c == nil {
+		return ErrFormat
+	}
+	if c.Encode == nil {
+		return fmt.Errorf("imageutil: encoding %s is not supported", c.Name)
+	}
+
+	xo := *o
+	xo.Format = format
+	return c.Encode(w, convertDepth(m, c.depth(imageDepth(m, o.Depth))), &xo)
+}
+
+// SaveImageFile writes the image to a file, the format is
+// picked from the options or the extension, defaulting to png
+func SaveImageFile(name string, m image.Image, o *SaveOptions) error {
+	format := filepath.Ext(name)
+	if o != nil && o.Format != "" {
+		format = o.Format
+	}
+	c := LookupCodec(format)
+	if c == nil {
+		format = "png"
+	} else if c.Encode == nil {
+		return fmt.Errorf("imageutil: encoding %s is not supported", c.Name)
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = EncodeImage(f, format, m, o)
+	xerr := f.Close()
+	if err == nil {
+		err = xerr
+	}
+	return err
+}
+
+// SaveFloatFile writes a float image to a file without going
+// through 8 bits, formats that store floats get the values
+// scaled to [0, 1], the rest are written at 16 bits if supported
+func SaveFloatFile(name string, f *Float, o *SaveOptions) error {
+	xo := SaveOptions{}
+	if o != nil {
+		xo = *o
+	}
+	if xo.Depth == 0 {
+		xo.Depth = 32
+	}
+
+	format := filepath.Ext(name)
+	if xo.Format != "" {
+		format = xo.Format
+	}
+	c := LookupCodec(format)
+	if c != nil && c.depth(xo.Depth) == 32 {
+		w, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		err = pnm.EncodePFM(w, pfmImage(f))
+		xerr := w.Close()
+		if err == nil {
+			err = xerr
+		}
+		return err
+	}
+
+	return SaveImageFile(name, f.ToRGBA64(), &xo)
+}
+
+// depth picks the closest depth the codec supports
+func (c *Codec) depth(d int) int {
+	if len(c.Depths) == 0 {
+		return 8
+	}
+	best := c.Depths[0]
+	for _, n := range c.Depths {
+		if n == d {
+			return n
+		}
+		if n < d && n > best {
+			best = n
+		}
+	}
+	return best
+}
+
+// imageDepth returns the depth that was asked for, or the
+// depth of the image if none was
+func imageDepth(m image.Image, d int) int {
+	if d > 0 {
+		return d
+	}
+	switch m.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return 16
+	}
+	return 8
+}
+
+func convertDepth(m image.Image, d int) image.Image {
+	switch d {
+	case 8:
+		switch m.(type) {
+		case *image.RGBA64, *image.NRGBA64:
+			p := image.NewNRGBA(m.Bounds())
+			draw.Draw(p, p.Bounds(), m, m.Bounds().Min, draw.Src)
+			return p
+		case *image.Gray16:
+			p := image.NewGray(m.Bounds())
+			draw.Draw(p, p.Bounds(), m, m.Bounds().Min, draw.Src)
+			return p
+		}
+	case 16:
+		switch m.(type) {
+		case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		case *image.Gray:
+			p := image.NewGray16(m.Bounds())
+			draw.Draw(p, p.Bounds(), m, m.Bounds().Min, draw.Src)
+			return p
+		default:
+			p := image.NewNRGBA64(m.Bounds())
+			draw.Draw(p, p.Bounds(), m, m.Bounds().Min, draw.Src)
+			return p
+		}
+	}
+	return m
+}
+
+func encodePNM(w io.Writer, m image.Image, o *SaveOptions) error {
+	po := pnm.Options{Format: 3}
+	if o.PNM != nil {
+		po = *o.PNM
+	} else {
+		switch strings.ToLower(o.Format) {
+		case ".pbm", "pbm":
+			po.Format = 1
+		case ".pgm", "pgm":
+			po.Format = 2
+		}
+	}
+	if po.MaxVal == 0 && imageDepth(m, 0) == 16 {
+		po.MaxVal = 0xffff
+	}
+	return pnm.Encode(w, m, &po)
+}
+
+// pfmImage gives the colors of an image in the units of a float map,
+// the float images of this package are scaled so 255 is 1 and have to
+// be scaled down while other float images are written as they are
+func pfmImage(m image.Image) pnm.FloatImage {
+	if _, ok := m.(FloatImage); !ok {
+		if f, ok := m.(pnm.FloatImage); ok {
+			return f
+		}
+	}
+	return unitFloat{m}
+}
+
+// unitFloat gives the colors of a image as floats in [0, 1] without
+// the alpha premultiplied, float maps have no alpha so the colors are
+// written as they are instead of over black
+type unitFloat struct {
+	m interface {
+		Bounds() image.Rectangle
+	}
+}
+
+func (u unitFloat) Bounds() image.Rectangle {
+	return u.m.Bounds()
+}
+
+func (u unitFloat) FloatAt(x, y int) [4]float64 {
+	switch m := u.m.(type) {
+	case FloatImage:
+		c := m.FloatAt(x, y)
+		if c[3] == 0 {
+			return [4]float64{}
+		}
+		return [4]float64{c[0] / c[3], c[1] / c[3], c[2] / c[3], c[3] / 255}
+	case image.Image:
+		c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+		return [4]float64{
+			float64(c.R) / 0xffff,
+			float64(c.G) / 0xffff,
+			float64(c.B) / 0xffff,
+			float64(c.A) / 0xffff,
+		}
+	}
+	return [4]float64{}
+}
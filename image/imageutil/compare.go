@@ -0,0 +1,339 @@
+package imageutil
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+var (
+	ErrSize = errors.New("imageutil: images are different sizes")
+)
+
+// Metrics are the differences between two images, colors are
+// compared premultiplied in [0, 1], or composited over black
+// when converted to Lab for the ΔE values
+type Metrics struct {
+	// mean squared error over all the channels
+	MSE float64
+
+	// peak signal to noise ratio in decibels,
+	// infinite when the images are the same
+	PSNR float64
+
+	// mean structural similarity of the luma,
+	// one when the images are the same
+	SSIM float64
+
+	// mean and maximum CIE76 color difference
+	DeltaE    float64
+	MaxDeltaE float64
+
+	// fraction of the pixels with a ΔE above the threshold
+	Changed float64
+}
+
+type RegionMetrics struct {
+	Rect image.Rectangle
+	Metrics
+}
+
+type DiffOptions struct {
+	// ΔE above which a pixel counts as changed,
+	// zero means 2.3, the just noticeable difference
+	Threshold float64
+
+	// size of the cells of the region report,
+	// zero means 64x64
+	Region image.Point
+
+	// color the changed pixels are drawn with in
+	// the diff image, nil means red
+	Highlight color.Color
+}
+
+type DiffReport struct {
+	Metrics
+
+	// metrics of each cell of the images in row order,
+	// relative to the bounds of the first image
+	Regions []RegionMetrics
+
+	// the first image faded to gray with
+	// the changed pixels highlighted
+	Image *image.RGBA
+}
+
+// Compare computes all the metrics between two images of the
+// same size, along with a report for every region and a diff image
+func Compare(a, b image.Image, o *DiffOptions) (*DiffReport, error) {
+	if o == nil {
+		o = &DiffOptions{}
+	}
+	th := o.Threshold
+	if th <= 0 {
+		th = 2.3
+	}
+	cs := o.Region
+	if cs.X <= 0 || cs.Y <= 0 {
+		cs = image.Pt(64, 64)
+	}
+	hl := o.Highlight
+	if hl == nil {
+		hl = color.RGBA{255, 0, 0, 255}
+	}
+
+	d, err := newDiff(a, b)
+	if err != nil {
+		return nil, err
+	}
+	d.ssim()
+	d.deltaE()
+
+	rp := &DiffReport{
+		Metrics: d.metrics(image.Rect(0, 0, d.w, d.h), th),
+		Image:   d.image(a.Bounds(), th, hl),
+	}
+	off := a.Bounds().Min
+	for y := 0; y < d.h; y += cs.Y {
+		for x := 0; x < d.w; x += cs.X {
+			r := image.Rect(x, y, x+cs.X, y+cs.Y).Intersect(image.Rect(0, 0, d.w, d.h))
+			rp.Regions = append(rp.Regions, RegionMetrics{
+				Rect:    r.Add(off),
+				Metrics: d.metrics(r, th),
+			})
+		}
+	}
+	return rp, nil
+}
+
+// String summarizes the report, listing only the regions
+// that have changed pixels
+func (d *DiffReport) String() string {
+	w := new(strings.Builder)
+	fmt.Fprintf(w, "%v\n", d.Metrics)
+	for _, r := range d.Regions {
+		if r.Changed > 0 {
+			fmt.Fprintf(w, "%v: %v\n", r.Rect, r.Metrics)
+		}
+	}
+	return w.String()
+}
+
+func (m Metrics) String() string {
+	return fmt.Sprintf("mse %.6g psnr %.2fdB ssim %.4f ΔE %.3g max ΔE %.3g changed %.2f%%",
+		m.MSE, m.PSNR, m.SSIM, m.DeltaE, m.MaxDeltaE, m.Changed*100)
+}
+
+func MSE(a, b image.Image) (float64, error) {
+	d, err := newDiff(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return d.metrics(image.Rect(0, 0, d.w, d.h), math.Inf(1)).MSE, nil
+}
+
+func PSNR(a, b image.Image) (float64, error) {
+	e, err := MSE(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return psnr(e), nil
+}
+
+// SSIM computes the mean structural similarity of the luma of
+// the images over a gaussian window with a standard deviation
+// of 1.5 pixels
+func SSIM(a, b image.Image) (float64, error) {
+	d, err := newDiff(a, b)
+	if err != nil {
+		return 0, err
+	}
+	d.ssim()
+	return d.metrics(image.Rect(0, 0, d.w, d.h), math.Inf(1)).SSIM, nil
+}
+
+// DeltaE returns the mean and the maximum CIE76 color
+// difference between the pixels of the images
+func DeltaE(a, b image.Image) (mean, peak float64, err error) {
+	d, err := newDiff(a, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	d.deltaE()
+	m := d.metrics(image.Rect(0, 0, d.w, d.h), math.Inf(1))
+	return m.DeltaE, m.MaxDeltaE, nil
+}
+
+// diff holds the per pixel errors of two images,
+// the slices are stored row by row
+type diff struct {
+	w, h int
+	a, b []chroma.Float4
+	se   []float64
+	ss   []float64
+	de   []float64
+}
+
+func newDiff(a, b image.Image) (*diff, error) {
+	r, s := a.Bounds(), b.Bounds()
+	if r.Size() != s.Size() {
+		return nil, ErrSize
+	}
+
+	d := &diff{
+		w: r.Dx(),
+		h: r.Dy(),
+	}
+	d.a = unitPixels(a)
+	d.b = unitPixels(b)
+	d.se = make([]float64, len(d.a))
+	for i := range d.a {
+		for c := range d.a[i] {
+			e := d.a[i][c] - d.b[i][c]
+			d.se[i] += e * e
+		}
+		d.se[i] /= 4
+	}
+	return d, nil
+}
+
+// ssim computes the structural similarity map, the local
+// means, variances and covariance are gaussian weighted
+func (d *diff) ssim() {
+	const (
+		c1 = 0.01 * 0.01
+		c2 = 0.03 * 0.03
+	)
+
+	r := image.Rect(0, 0, d.w, d.h)
+	p := NewFloat(r)
+	q := NewFloat(r)
+	for i := range d.a {
+		x, y := luma(d.a[i]), luma(d.b[i])
+		p.Pix[i] = chroma.Float4{x, y, x * x, y * y}
+		q.Pix[i] = chroma.Float4{x * y}
+	}
+
+	k := gaussCoeff(11, 1.5)
+	o := &FilterOptions{Op: OpCorr, Wrap: WrapRepeat}
+	p.FilterSeparable(k, k, o)
+	q.FilterSeparable(k, k, o)
+
+	d.ss = make([]float64, len(d.a))
+	for i := range d.ss {
+		mx, my := p.Pix[i][0], p.Pix[i][1]
+		vx := p.Pix[i][2] - mx*mx
+		vy := p.Pix[i][3] - my*my
+		cv := q.Pix[i][0] - mx*my
+		d.ss[i] = ((2*mx*my + c1) * (2*cv + c2)) / ((mx*mx + my*my + c1) * (vx + vy + c2))
+	}
+}
+
+func (d *diff) deltaE() {
+	d.de = make([]float64, len(d.a))
+	for i := range d.de {
+		d.de[i] = chroma.DeltaE76(unitLab(d.a[i]), unitLab(d.b[i]))
+	}
+}
+
+// metrics aggregates the per pixel errors inside r, the
+// metrics that were not computed are left as zero
+func (d *diff) metrics(r image.Rectangle, th float64) Metrics {
+	var m Metrics
+	n := float64(r.Dx() * r.Dy())
+	if n == 0 {
+		return m
+	}
+
+	changed := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := y*d.w + x
+			m.MSE += d.se[i]
+			if d.ss != nil {
+				m.SSIM += d.ss[i]
+			}
+			if d.de != nil {
+				m.DeltaE += d.de[i]
+				m.MaxDeltaE = math.Max(m.MaxDeltaE, d.de[i])
+				if d.de[i] > th {
+					changed++
+				}
+			}
+		}
+	}
+	m.MSE /= n
+	m.PSNR = psnr(m.MSE)
+	m.SSIM /= n
+	m.DeltaE /= n
+	m.Changed = float64(changed) / n
+	return m
+}
+
+// image draws the first image as dimmed gray with the pixels
+// that changed blended towards the highlight color, the more
+// they changed the stronger the highlight
+func (d *diff) image(r image.Rectangle, th float64, hl color.Color) *image.RGBA {
+	hr, hg, hb, _ := hl.RGBA()
+	h := f64.Vec3{float64(hr) / 0xffff, float64(hg) / 0xffff, float64(hb) / 0xffff}
+
+	m := image.NewRGBA(r)
+	for i := range d.a {
+		g := 0.25 + 0.5*luma(d.a[i])
+		c := f64.Vec3{g, g, g}
+		if d.de[i] > th {
+			t := f64.Clamp(d.de[i]/(4*th), 0.5, 1)
+			c = c.Lerp(t, h)
+		}
+
+		x, y := i%d.w, i/d.w
+		j := m.PixOffset(r.Min.X+x, r.Min.Y+y)
+		m.Pix[j] = f64.Clamp8(c.X*255, 0, 255)
+		m.Pix[j+1] = f64.Clamp8(c.Y*255, 0, 255)
+		m.Pix[j+2] = f64.Clamp8(c.Z*255, 0, 255)
+		m.Pix[j+3] = 255
+	}
+	return m
+}
+
+// unitPixels returns the premultiplied
+// colors of the image in [0, 1]
+func unitPixels(m image.Image) []chroma.Float4 {
+	r := m.Bounds()
+	p := make([]chroma.Float4, 0, r.Dx()*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, ca := m.At(x, y).RGBA()
+			p = append(p, chroma.Float4{
+				float64(cr) / 0xffff,
+				float64(cg) / 0xffff,
+				float64(cb) / 0xffff,
+				float64(ca) / 0xffff,
+			})
+		}
+	}
+	return p
+}
+
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return -10 * math.Log10(mse)
+}
+
+func luma(c chroma.Float4) float64 {
+	return 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+}
+
+// unitLab converts a color in [0, 1] to Lab with a D65 white
+func unitLab(c chroma.Float4) chroma.Lab {
+	return chroma.XYZ2Lab(chroma.VEC32XYZ(f64.Vec3{c[0], c[1], c[2]}), chroma.D65)
+}
@@ -5,11 +5,16 @@ import (
 	"image/color"
 
 	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/image/internal/parallel"
+	"github.com/qeedquan/go-media/image/pnm"
 	"github.com/qeedquan/go-media/math/f64"
 )
 
 const (
+	// samples outside of the image are zero
 	WrapClamp = iota
+
+	// samples outside of the image repeat the edge
 	WrapRepeat
 )
 
@@ -21,6 +26,10 @@ const (
 type FilterOptions struct {
 	Op   int
 	Wrap int
+
+	// number of goroutines to filter with,
+	// zero means use all the processors
+	Workers int
 }
 
 type Float struct {
@@ -72,6 +81,36 @@ func (f *Float) SetFloat(x, y int, c [4]float64) {
 	}
 }
 
+func (f *Float) ColorModel() color.Model {
+	return chroma.Float4Model
+}
+
+func (f *Float) At(x, y int) color.Color {
+	return chroma.Float4(f.FloatAt(x, y))
+}
+
+func (f *Float) Set(x, y int, c color.Color) {
+	f.SetFloat(x, y, chroma.Float4Model.Convert(c).(chroma.Float4))
+}
+
+func (f *Float) PixOffset(x, y int) int {
+	return (y-f.Rect.Min.Y)*f.Stride + (x - f.Rect.Min.X)
+}
+
+// SubImage returns the part of the image inside r,
+// the pixels are shared with the original image
+func (f *Float) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(f.Rect)
+	if r.Empty() {
+		return &Float{}
+	}
+	return &Float{
+		Pix:    f.Pix[f.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: f.Stride,
+		Rect:   r,
+	}
+}
+
 func (f *Float) ToRGB() *image.RGBA {
 	r := f.Rect
 	m := image.NewRGBA(r)
@@ -91,11 +130,12 @@ func (f *Float) ToRGB() *image.RGBA {
 }
 
 func (f *Float) ToFloat() *Float {
-	return &Float{
-		Pix:    append([]chroma.Float4{}, f.Pix...),
-		Stride: f.Stride,
-		Rect:   f.Rect,
+	r := f.Rect
+	p := NewFloat(r)
+	for y := 0; y < r.Dy(); y++ {
+		copy(p.Pix[y*p.Stride:(y+1)*p.Stride], f.Pix[y*f.Stride:])
 	}
+	return p
 }
 
 func (f *Float) ToRGBA() *image.RGBA {
@@ -127,45 +167,68 @@ func (f *Float) Filter(kr [][]float64, o *FilterOptions) {
 	if len(kr) == 0 || len(kr[0]) == 0 {
 		return
 	}
+
+	// read from a copy so the filtered pixels
+	// do not feed into their neighbors
+	src := f.ToFloat()
 	a := len(kr)
 	b := len(kr[0])
 	r := f.Bounds()
-	for i := r.Min.Y; i < r.Max.Y; i++ {
-		for j := r.Min.X; j < r.Max.X; j++ {
-			var s [4]float64
-			for k := -a / 2; k <= a/2; k++ {
-				for l := -b / 2; l <= b/2; l++ {
-					y := i - k
-					x := j - l
-					if o.Op == OpCorr {
-						y = i + k
-						x = j + l
-					}
+	parallel.Lines(r.Dy(), parallel.Workers(o.Workers), func(_, lo, hi int) {
+		for i := r.Min.Y + lo; i < r.Min.Y+hi; i++ {
+			for j := r.Min.X; j < r.Max.X; j++ {
+				var s [4]float64
+				for k := -a / 2; k <= a/2; k++ {
+					for l := -b / 2; l <= b/2; l++ {
+						y := i - k
+						x := j - l
+						if o.Op == OpCorr {
+							y = i + k
+							x = j + l
+						}
 
-					if o.Wrap == WrapRepeat {
-						x = clamp(x, r.Min.X, r.Max.X-1)
-						y = clamp(y, r.Min.Y, r.Max.Y-1)
-					}
+						if o.Wrap == WrapRepeat {
+							x = clamp(x, r.Min.X, r.Max.X-1)
+							y = clamp(y, r.Min.Y, r.Max.Y-1)
+						}
 
-					c := f.FloatAt(x, y)
-					for n := range s {
-						s[n] += c[n] * kr[a/2+k][b/2+l]
+						c := src.FloatAt(x, y)
+						for n := range s {
+							s[n] += c[n] * kr[a/2+k][b/2+l]
+						}
 					}
 				}
+				f.SetFloat(j, i, s)
 			}
-			f.SetFloat(j, i, s)
 		}
-	}
+	})
 }
 
+// ImageToFloat converts an image to a float image, images that
+// have their colors at full precision such as float maps are
+// copied without rounding or clamping
 func ImageToFloat(m image.Image) *Float {
 	r := m.Bounds()
+	switch p := m.(type) {
+	case *Float:
+		return p.ToFloat()
+	case *Float32:
+		return p.ToFloat()
+	case pnm.FloatImage:
+		f := NewFloat(r)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := p.FloatAt(x, y)
+				f.SetFloat(x, y, [4]float64{c[0] * c[3] * 255, c[1] * c[3] * 255, c[2] * c[3] * 255, c[3] * 255})
+			}
+		}
+		return f
+	}
+
 	f := NewFloat(r)
 	for y := r.Min.Y; y < r.Max.Y; y++ {
 		for x := r.Min.X; x < r.Max.X; x++ {
-			cr := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
-			cf := [4]float64{float64(cr.R), float64(cr.G), float64(cr.B), float64(cr.A)}
-			f.SetFloat(x, y, cf)
+			f.SetFloat(x, y, chroma.Float4Model.Convert(m.At(x, y)).(chroma.Float4))
 		}
 	}
 	return f
@@ -176,3 +239,21 @@ func Filter(m image.Image, kr [][]float64, o *FilterOptions) *Float {
 	f.Filter(kr, o)
 	return f
 }
+
+func (f *Float) ToRGBA64() *image.RGBA64 {
+	r := f.Rect
+	m := image.NewRGBA64(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cf := f.FloatAt(x, y)
+			cr := color.RGBA64{
+				uint16(f64.Clamp(cf[0]*257+.5, 0, 0xffff)),
+				uint16(f64.Clamp(cf[1]*257+.5, 0, 0xffff)),
+				uint16(f64.Clamp(cf[2]*257+.5, 0, 0xffff)),
+				uint16(f64.Clamp(cf[3]*257+.5, 0, 0xffff)),
+			}
+			m.SetRGBA64(x, y, cr)
+		}
+	}
+	return m
+}
@@ -0,0 +1,133 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// Float32 is Float at single precision, it takes half the
+// memory and is meant for large buffers where the extra
+// precision is not needed
+type Float32 struct {
+	Pix    []chroma.Float4f
+	Stride int
+	Rect   image.Rectangle
+}
+
+func NewFloat32(r image.Rectangle) *Float32 {
+	return &Float32{
+		Pix:    make([]chroma.Float4f, r.Dx()*r.Dy()),
+		Stride: r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (f *Float32) Bounds() image.Rectangle {
+	return f.Rect
+}
+
+func (f *Float32) ColorModel() color.Model {
+	return chroma.Float4fModel
+}
+
+func (f *Float32) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(f.Rect) {
+		return chroma.Float4f{}
+	}
+	return f.Pix[f.PixOffset(x, y)]
+}
+
+func (f *Float32) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(f.Rect) {
+		return
+	}
+	f.Pix[f.PixOffset(x, y)] = chroma.Float4fModel.Convert(c).(chroma.Float4f)
+}
+
+func (f *Float32) FloatAt(x, y int) [4]float64 {
+	if !image.Pt(x, y).In(f.Rect) {
+		return [4]float64{}
+	}
+	c := f.Pix[f.PixOffset(x, y)]
+	return [4]float64{float64(c[0]), float64(c[1]), float64(c[2]), float64(c[3])}
+}
+
+func (f *Float32) SetFloat(x, y int, c [4]float64) {
+	if !image.Pt(x, y).In(f.Rect) {
+		return
+	}
+	f.Pix[f.PixOffset(x, y)] = chroma.Float4f{float32(c[0]), float32(c[1]), float32(c[2]), float32(c[3])}
+}
+
+func (f *Float32) PixOffset(x, y int) int {
+	return (y-f.Rect.Min.Y)*f.Stride + (x - f.Rect.Min.X)
+}
+
+func (f *Float32) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(f.Rect)
+	if r.Empty() {
+		return &Float32{}
+	}
+	return &Float32{
+		Pix:    f.Pix[f.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: f.Stride,
+		Rect:   r,
+	}
+}
+
+func (f *Float32) ToFloat() *Float {
+	r := f.Rect
+	p := NewFloat(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p.SetFloat(x, y, f.FloatAt(x, y))
+		}
+	}
+	return p
+}
+
+func (f *Float) ToFloat32() *Float32 {
+	r := f.Rect
+	p := NewFloat32(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p.SetFloat(x, y, f.FloatAt(x, y))
+		}
+	}
+	return p
+}
+
+func (f *Float32) ToRGBA() *image.RGBA {
+	return f.ToFloat().ToRGBA()
+}
+
+func (f *Float32) Add(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a + b })
+}
+
+func (f *Float32) Sub(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a - b })
+}
+
+func (f *Float32) Mul(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a * b / 255 })
+}
+
+func (f *Float32) Lerp(g FloatImage, t float64) {
+	combineFloat(f, g, func(a, b float64) float64 { return a + (b-a)*t })
+}
+
+func (f *Float32) Scale(k float64) {
+	mapFloat(f, func(a float64) float64 { return a * k })
+}
+
+func (f *Float32) Clamp(lo, hi float64) {
+	mapFloat(f, func(a float64) float64 { return f64.Clamp(a, lo, hi) })
+}
+
+func (f *Float32) Split() [4]*Float {
+	return splitFloat(f)
+}
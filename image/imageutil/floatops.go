@@ -0,0 +1,119 @@
+package imageutil
+
+import (
+	"image"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// FloatImage is an image that can be read and
+// written at full precision, like Float and Float32
+type FloatImage interface {
+	image.Image
+	FloatAt(x, y int) [4]float64
+	SetFloat(x, y int, c [4]float64)
+}
+
+// Add adds the pixels of g to the pixels of f at the same
+// coordinates, only the part where they overlap is changed
+func (f *Float) Add(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a + b })
+}
+
+func (f *Float) Sub(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a - b })
+}
+
+// Mul multiplies the pixels with 255 as one
+func (f *Float) Mul(g FloatImage) {
+	combineFloat(f, g, func(a, b float64) float64 { return a * b / 255 })
+}
+
+// Lerp moves the pixels towards the pixels of g by t
+func (f *Float) Lerp(g FloatImage, t float64) {
+	combineFloat(f, g, func(a, b float64) float64 { return a + (b-a)*t })
+}
+
+func (f *Float) Scale(k float64) {
+	mapFloat(f, func(a float64) float64 { return a * k })
+}
+
+func (f *Float) Clamp(lo, hi float64) {
+	mapFloat(f, func(a float64) float64 { return f64.Clamp(a, lo, hi) })
+}
+
+// Split returns an image for every channel with the
+// value of the channel in red, green and blue
+func (f *Float) Split() [4]*Float {
+	return splitFloat(f)
+}
+
+// MergeFloat builds an image taking each channel from the red
+// channel of an image, a nil image gives zeros except for the
+// alpha which is opaque, the result covers the first image
+func MergeFloat(r, g, b, a FloatImage) *Float {
+	var bounds image.Rectangle
+	for _, m := range []FloatImage{r, g, b, a} {
+		if m != nil {
+			bounds = m.Bounds()
+			break
+		}
+	}
+
+	p := NewFloat(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := [4]float64{0, 0, 0, 255}
+			for i, m := range []FloatImage{r, g, b, a} {
+				if m != nil {
+					c[i] = m.FloatAt(x, y)[0]
+				}
+			}
+			p.SetFloat(x, y, c)
+		}
+	}
+	return p
+}
+
+func combineFloat(f, g FloatImage, fn func(a, b float64) float64) {
+	r := f.Bounds().Intersect(g.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a, b := f.FloatAt(x, y), g.FloatAt(x, y)
+			for i := range a {
+				a[i] = fn(a[i], b[i])
+			}
+			f.SetFloat(x, y, a)
+		}
+	}
+}
+
+func mapFloat(f FloatImage, fn func(a float64) float64) {
+	r := f.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a := f.FloatAt(x, y)
+			for i := range a {
+				a[i] = fn(a[i])
+			}
+			f.SetFloat(x, y, a)
+		}
+	}
+}
+
+func splitFloat(f FloatImage) [4]*Float {
+	var p [4]*Float
+	r := f.Bounds()
+	for i := range p {
+		p[i] = NewFloat(r)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := f.FloatAt(x, y)
+			for i := range p {
+				p[i].SetFloat(x, y, [4]float64{c[i], c[i], c[i], 255})
+			}
+		}
+	}
+	return p
+}
@@ -0,0 +1,264 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/qeedquan/go-media/image/chroma"
+)
+
+type FloodOptions struct {
+	// how far a color can be from the color under the seed
+	// point and still be filled
+	Tolerance float64
+
+	// distance between colors, nil means chroma.DistanceL2RGBA
+	Distance func(a, b color.Color) float64
+
+	// fill across diagonal neighbors as well
+	Diagonal bool
+}
+
+// FloodFill fills the area connected to pt that has a color
+// close to the color at pt, colors are compared against the
+// image before the fill so a fill color inside the tolerance
+// does not spread further, it returns the bounds of the area
+func FloodFill(m draw.Image, pt image.Point, c color.Color, o *FloodOptions) image.Rectangle {
+	if o == nil {
+		o = &FloodOptions{}
+	}
+	dist := o.Distance
+	if dist == nil {
+		dist = chroma.DistanceL2RGBA
+	}
+
+	r := m.Bounds()
+	if !pt.In(r) {
+		return image.Rectangle{}
+	}
+
+	seed := m.At(pt.X, pt.Y)
+	w := r.Dx()
+	seen := make([]bool, w*r.Dy())
+	match := func(x, y int) bool {
+		i := (y-r.Min.Y)*w + x - r.Min.X
+		return !seen[i] && dist(seed, m.At(x, y)) <= o.Tolerance
+	}
+
+	d := 0
+	if o.Diagonal {
+		d = 1
+	}
+
+	var bb image.Rectangle
+	stack := []image.Point{pt}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !match(p.X, p.Y) {
+			continue
+		}
+
+		// fill the whole span the point is on
+		x0, x1 := p.X, p.X+1
+		for x0 > r.Min.X && match(x0-1, p.Y) {
+			x0--
+		}
+		for x1 < r.Max.X && match(x1, p.Y) {
+			x1++
+		}
+		for x := x0; x < x1; x++ {
+			seen[(p.Y-r.Min.Y)*w+x-r.Min.X] = true
+			m.Set(x, p.Y, c)
+		}
+		bb = bb.Union(image.Rect(x0, p.Y, x1, p.Y+1))
+
+		// push the start of every span touching it above and below
+		for _, y := range []int{p.Y - 1, p.Y + 1} {
+			if y < r.Min.Y || y >= r.Max.Y {
+				continue
+			}
+			in := false
+			for x := max(x0-d, r.Min.X); x < min(x1+d, r.Max.X); x++ {
+				ok := match(x, y)
+				if ok && !in {
+					stack = append(stack, image.Pt(x, y))
+				}
+				in = ok
+			}
+		}
+	}
+	return bb
+}
+
+type LabelOptions struct {
+	// pixels that are part of the components,
+	// nil means the pixels that are not fully transparent
+	Foreground func(c color.Color) bool
+
+	// connect diagonal neighbors as well
+	Diagonal bool
+
+	// components with a smaller area are
+	// put back into the background
+	MinArea int
+}
+
+// Labels is the component of each pixel,
+// zero is the background
+type Labels struct {
+	Pix    []int
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (l *Labels) Bounds() image.Rectangle {
+	return l.Rect
+}
+
+func (l *Labels) LabelAt(x, y int) int {
+	if !image.Pt(x, y).In(l.Rect) {
+		return 0
+	}
+	return l.Pix[(y-l.Rect.Min.Y)*l.Stride+x-l.Rect.Min.X]
+}
+
+type Component struct {
+	Label  int
+	Bounds image.Rectangle
+	Area   int
+}
+
+// LabelComponents finds the connected components of the
+// foreground, the components are numbered from 1 in the
+// order they are first seen scanning from the top left,
+// the component with label n is at index n-1
+func LabelComponents(m image.Image, o *LabelOptions) (*Labels, []Component) {
+	if o == nil {
+		o = &LabelOptions{}
+	}
+	fg := o.Foreground
+	if fg == nil {
+		fg = func(c color.Color) bool {
+			_, _, _, a := c.RGBA()
+			return a != 0
+		}
+	}
+
+	r := m.Bounds()
+	w, h := r.Dx(), r.Dy()
+	l := &Labels{
+		Pix:    make([]int, w*h),
+		Stride: w,
+		Rect:   r,
+	}
+
+	// first pass gives provisional labels and
+	// records which ones touch in a union find
+	parent := []int{0}
+	find := func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	union := func(a, b int) int {
+		a, b = find(a), find(b)
+		if a > b {
+			a, b = b, a
+		}
+		parent[b] = a
+		return a
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !fg(m.At(r.Min.X+x, r.Min.Y+y)) {
+				continue
+			}
+
+			n := 0
+			link := func(x, y int) {
+				if x < 0 || x >= w || y < 0 {
+					return
+				}
+				v := l.Pix[y*w+x]
+				if v == 0 {
+					return
+				}
+				if n == 0 {
+					n = find(v)
+				} else {
+					n = union(n, v)
+				}
+			}
+			link(x-1, y)
+			link(x, y-1)
+			if o.Diagonal {
+				link(x-1, y-1)
+				link(x+1, y-1)
+			}
+
+			if n == 0 {
+				n = len(parent)
+				parent = append(parent, n)
+			}
+			l.Pix[y*w+x] = n
+		}
+	}
+
+	// second pass resolves the labels and measures the components
+	label := make([]int, len(parent))
+	var cs []Component
+	for i, v := range l.Pix {
+		if v == 0 {
+			continue
+		}
+		v = find(v)
+		if label[v] == 0 {
+			cs = append(cs, Component{Label: len(cs) + 1})
+			label[v] = len(cs)
+		}
+
+		c := &cs[label[v]-1]
+		p := image.Pt(r.Min.X+i%w, r.Min.Y+i/w)
+		c.Bounds = c.Bounds.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+		c.Area++
+		l.Pix[i] = c.Label
+	}
+
+	if o.MinArea <= 0 {
+		return l, cs
+	}
+
+	// drop the small components and renumber the rest
+	remap := make([]int, len(cs)+1)
+	var ks []Component
+	for _, c := range cs {
+		if c.Area < o.MinArea {
+			continue
+		}
+		remap[c.Label] = len(ks) + 1
+		c.Label = len(ks) + 1
+		ks = append(ks, c)
+	}
+	for i, v := range l.Pix {
+		l.Pix[i] = remap[v]
+	}
+	return l, ks
+}
+
+// ExtractComponents copies the pixels inside the bounds
+// of each component to its own image, like SplitRGBA
+// but for sprite sheets without a fixed grid
+func ExtractComponents(m image.Image, cs []Component) []*image.RGBA {
+	var imgs []*image.RGBA
+	for _, c := range cs {
+		p := image.NewRGBA(image.Rectangle{Max: c.Bounds.Size()})
+		draw.Draw(p, p.Bounds(), m, c.Bounds.Min, draw.Src)
+		imgs = append(imgs, p)
+	}
+	return imgs
+}
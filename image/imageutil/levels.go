@@ -0,0 +1,361 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// Histogram counts the straight alpha values of every channel,
+// Y is the luma as defined by YCbCr
+type Histogram struct {
+	R, G, B, A [256]int
+	Y          [256]int
+
+	// number of pixels counted
+	N int
+}
+
+func NewHistogram(m image.Image) *Histogram {
+	h := &Histogram{}
+	r := m.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			l, _, _ := color.RGBToYCbCr(c.R, c.G, c.B)
+			h.R[c.R]++
+			h.G[c.G]++
+			h.B[c.B]++
+			h.A[c.A]++
+			h.Y[l]++
+			h.N++
+		}
+	}
+	return h
+}
+
+// Percentile returns the smallest value that has at least
+// the fraction p of the counts at or below it
+func Percentile(bins *[256]int, p float64) uint8 {
+	n := 0
+	for _, v := range bins {
+		n += v
+	}
+
+	t := p * float64(n)
+	s := 0
+	for i, v := range bins {
+		s += v
+		if float64(s) >= t && s > 0 {
+			return uint8(i)
+		}
+	}
+	return 255
+}
+
+// LUT maps every 8 bit value to another
+type LUT [256]uint8
+
+func IdentityLUT() *LUT {
+	l := &LUT{}
+	for i := range l {
+		l[i] = uint8(i)
+	}
+	return l
+}
+
+// GammaLUT raises the values in [0, 1] to the power of 1/g
+func GammaLUT(g float64) *LUT {
+	return LevelsLUT(0, 255, g)
+}
+
+// LevelsLUT maps black to 0 and white to 255 with
+// the values in between raised to the power of 1/g
+func LevelsLUT(black, white uint8, g float64) *LUT {
+	if g <= 0 {
+		g = 1
+	}
+
+	l := &LUT{}
+	lo, hi := float64(black), float64(white)
+	for i := range l {
+		t := 0.0
+		if hi > lo {
+			t = f64.Clamp((float64(i)-lo)/(hi-lo), 0, 1)
+		} else if float64(i) >= hi {
+			t = 1
+		}
+		l[i] = f64.Clamp8(math.Pow(t, 1/g)*255, 0, 255)
+	}
+	return l
+}
+
+// CurveLUT maps the values through a monotone cubic curve going
+// through the points, the points are in [0, 1] on both axes and
+// the curve is flat past the first and last points
+func CurveLUT(pts ...f64.Vec2) *LUT {
+	if len(pts) == 0 {
+		return IdentityLUT()
+	}
+
+	p := append([]f64.Vec2{}, pts...)
+	sort.Slice(p, func(i, j int) bool {
+		return p[i].X < p[j].X
+	})
+
+	// fritsch-carlson tangents keep the curve monotone
+	// between the points when the points are monotone
+	n := len(p)
+	d := make([]float64, n)
+	m := make([]float64, n)
+	for i := 0; i < n-1; i++ {
+		if dx := p[i+1].X - p[i].X; dx > 0 {
+			d[i] = (p[i+1].Y - p[i].Y) / dx
+		}
+	}
+	if n > 1 {
+		m[0] = d[0]
+		m[n-1] = d[n-2]
+	}
+	for i := 1; i < n-1; i++ {
+		if d[i-1]*d[i] > 0 {
+			m[i] = (d[i-1] + d[i]) / 2
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		if d[i] == 0 {
+			m[i], m[i+1] = 0, 0
+			continue
+		}
+		a, b := m[i]/d[i], m[i+1]/d[i]
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			m[i] = t * a * d[i]
+			m[i+1] = t * b * d[i]
+		}
+	}
+
+	eval := func(x float64) float64 {
+		if x <= p[0].X {
+			return p[0].Y
+		}
+		if x >= p[n-1].X {
+			return p[n-1].Y
+		}
+		i := sort.Search(n, func(i int) bool { return p[i].X > x }) - 1
+		h := p[i+1].X - p[i].X
+		t := (x - p[i].X) / h
+		t2, t3 := t*t, t*t*t
+		return (2*t3-3*t2+1)*p[i].Y + (t3-2*t2+t)*h*m[i] +
+			(-2*t3+3*t2)*p[i+1].Y + (t3-t2)*h*m[i+1]
+	}
+
+	l := &LUT{}
+	for i := range l {
+		l[i] = f64.Clamp8(eval(float64(i)/255)*255, 0, 255)
+	}
+	return l
+}
+
+// Apply maps the color channels of the image through the
+// table, the mapping is done on the straight alpha values
+func (l *LUT) Apply(m image.Image) *image.RGBA {
+	return ApplyLUTs(m, l, l, l)
+}
+
+// ApplyLUTs maps each color channel through its own
+// table, a nil table leaves the channel alone
+func ApplyLUTs(m image.Image, lr, lg, lb *LUT) *image.RGBA {
+	id := IdentityLUT()
+	if lr == nil {
+		lr = id
+	}
+	if lg == nil {
+		lg = id
+	}
+	if lb == nil {
+		lb = id
+	}
+	return mapStraight(m, func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{lr[c.R], lg[c.G], lb[c.B], c.A}
+	})
+}
+
+// AutoLevels stretches every channel on its own so the values
+// between the clip and 1-clip percentiles fill the full range,
+// it removes color casts as well as low contrast
+func AutoLevels(m image.Image, clip float64) *image.RGBA {
+	h := NewHistogram(m)
+	levels := func(b *[256]int) *LUT {
+		return LevelsLUT(Percentile(b, clip), Percentile(b, 1-clip), 1)
+	}
+	return ApplyLUTs(m, levels(&h.R), levels(&h.G), levels(&h.B))
+}
+
+// ContrastStretch is like AutoLevels but stretches all the
+// channels the same way based on the luma, keeping the hues
+func ContrastStretch(m image.Image, clip float64) *image.RGBA {
+	h := NewHistogram(m)
+	return LevelsLUT(Percentile(&h.Y, clip), Percentile(&h.Y, 1-clip), 1).Apply(m)
+}
+
+// Equalize spreads the luma of the image so its
+// histogram is as flat as possible
+func Equalize(m image.Image) *image.RGBA {
+	h := NewHistogram(m)
+	l := equalizeLUT(&h.Y, h.N)
+	return mapLuma(m, func(x, y int, v uint8) uint8 {
+		return l[v]
+	})
+}
+
+type CLAHEOptions struct {
+	// number of tiles across and down,
+	// zero means 8x8
+	Tiles image.Point
+
+	// highest a bin of a tile histogram can be relative to
+	// the mean bin height, the rest is spread among all the
+	// bins to limit the contrast, zero means 2
+	ClipLimit float64
+}
+
+// CLAHE equalizes the luma of each tile of the image on its own,
+// with the histograms clipped to limit how much noise is amplified,
+// the mappings of the nearest tiles are blended to hide the seams
+func CLAHE(m image.Image, o *CLAHEOptions) *image.RGBA {
+	if o == nil {
+		o = &CLAHEOptions{}
+	}
+	r := m.Bounds()
+	nt := o.Tiles
+	if nt.X <= 0 || nt.Y <= 0 {
+		nt = image.Pt(8, 8)
+	}
+	nt.X = max(min(nt.X, r.Dx()), 1)
+	nt.Y = max(min(nt.Y, r.Dy()), 1)
+	limit := o.ClipLimit
+	if limit <= 0 {
+		limit = 2
+	}
+
+	tile := func(i, j int) image.Rectangle {
+		return image.Rect(
+			r.Min.X+r.Dx()*i/nt.X, r.Min.Y+r.Dy()*j/nt.Y,
+			r.Min.X+r.Dx()*(i+1)/nt.X, r.Min.Y+r.Dy()*(j+1)/nt.Y,
+		)
+	}
+
+	luma := func(x, y int) uint8 {
+		c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+		l, _, _ := color.RGBToYCbCr(c.R, c.G, c.B)
+		return l
+	}
+
+	luts := make([]*LUT, nt.X*nt.Y)
+	for j := 0; j < nt.Y; j++ {
+		for i := 0; i < nt.X; i++ {
+			t := tile(i, j)
+			var b [256]int
+			for y := t.Min.Y; y < t.Max.Y; y++ {
+				for x := t.Min.X; x < t.Max.X; x++ {
+					b[luma(x, y)]++
+				}
+			}
+			n := t.Dx() * t.Dy()
+			clipHistogram(&b, max(int(limit*float64(n)/256), 1))
+			luts[j*nt.X+i] = equalizeLUT(&b, n)
+		}
+	}
+
+	// tile centers in units of tiles
+	center := func(x, n, size int) float64 {
+		return (float64(x)+.5)*float64(n)/float64(size) - .5
+	}
+	return mapLuma(m, func(x, y int, v uint8) uint8 {
+		fx := center(x-r.Min.X, nt.X, r.Dx())
+		fy := center(y-r.Min.Y, nt.Y, r.Dy())
+		i0, j0 := int(math.Floor(fx)), int(math.Floor(fy))
+		tx, ty := fx-float64(i0), fy-float64(j0)
+		i1 := clamp(i0+1, 0, nt.X-1)
+		j1 := clamp(j0+1, 0, nt.Y-1)
+		i0 = clamp(i0, 0, nt.X-1)
+		j0 = clamp(j0, 0, nt.Y-1)
+
+		a := f64.Lerp(tx, float64(luts[j0*nt.X+i0][v]), float64(luts[j0*nt.X+i1][v]))
+		b := f64.Lerp(tx, float64(luts[j1*nt.X+i0][v]), float64(luts[j1*nt.X+i1][v]))
+		return f64.Clamp8(f64.Lerp(ty, a, b), 0, 255)
+	})
+}
+
+// clipHistogram cuts the bins at limit and
+// spreads the excess evenly over all the bins
+func clipHistogram(b *[256]int, limit int) {
+	excess := 0
+	for i := range b {
+		if b[i] > limit {
+			excess += b[i] - limit
+			b[i] = limit
+		}
+	}
+	for i := range b {
+		b[i] += excess / 256
+		if i < excess%256 {
+			b[i]++
+		}
+	}
+}
+
+// equalizeLUT maps values through the cumulative histogram
+func equalizeLUT(b *[256]int, n int) *LUT {
+	l := &LUT{}
+	lo := 0
+	for _, v := range b {
+		if v != 0 {
+			lo = v
+			break
+		}
+	}
+	if n <= lo {
+		return IdentityLUT()
+	}
+
+	s := 0
+	for i, v := range b {
+		s += v
+		l[i] = f64.Clamp8(float64(s-lo)/float64(n-lo)*255, 0, 255)
+	}
+	return l
+}
+
+// mapLuma replaces the luma of every pixel keeping the chroma
+func mapLuma(m image.Image, fn func(x, y int, v uint8) uint8) *image.RGBA {
+	return mapStraightAt(m, func(x, y int, c color.NRGBA) color.NRGBA {
+		l, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+		r, g, b := color.YCbCrToRGB(fn(x, y, l), cb, cr)
+		return color.NRGBA{r, g, b, c.A}
+	})
+}
+
+func mapStraight(m image.Image, fn func(c color.NRGBA) color.NRGBA) *image.RGBA {
+	return mapStraightAt(m, func(_, _ int, c color.NRGBA) color.NRGBA {
+		return fn(c)
+	})
+}
+
+// mapStraightAt calls fn with the straight alpha color of
+// every pixel and stores the result premultiplied
+func mapStraightAt(m image.Image, fn func(x, y int, c color.NRGBA) color.NRGBA) *image.RGBA {
+	r := m.Bounds()
+	p := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			p.Set(x, y, fn(x, y, c))
+		}
+	}
+	return p
+}
@@ -0,0 +1,140 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/qeedquan/go-media/image/internal/parallel"
+)
+
+// StructElem is a flat structuring element, the points set in
+// Mask are part of the element and Origin is the point of the
+// mask that lies on the pixel being computed
+type StructElem struct {
+	Mask   [][]bool
+	Origin image.Point
+}
+
+func RectElem(w, h int) *StructElem {
+	s := newStructElem(w, h)
+	for i := range s.Mask {
+		for j := range s.Mask[i] {
+			s.Mask[i][j] = true
+		}
+	}
+	return s
+}
+
+func DiskElem(r int) *StructElem {
+	s := newStructElem(2*r+1, 2*r+1)
+	for i := range s.Mask {
+		for j := range s.Mask[i] {
+			x, y := j-r, i-r
+			s.Mask[i][j] = x*x+y*y <= r*r
+		}
+	}
+	return s
+}
+
+func CrossElem(r int) *StructElem {
+	s := newStructElem(2*r+1, 2*r+1)
+	for i := range s.Mask {
+		s.Mask[i][r] = true
+		s.Mask[r][i] = true
+	}
+	return s
+}
+
+func newStructElem(w, h int) *StructElem {
+	p := make([][]bool, h)
+	q := make([]bool, w*h)
+	for i := range p {
+		p[i] = q[i*w : (i+1)*w]
+	}
+	return &StructElem{
+		Mask:   p,
+		Origin: image.Pt(w/2, h/2),
+	}
+}
+
+// offsets returns the points of the element relative
+// to the origin, reflected if asked to
+func (s *StructElem) offsets(reflect bool) []image.Point {
+	var p []image.Point
+	for i := range s.Mask {
+		for j, v := range s.Mask[i] {
+			if !v {
+				continue
+			}
+			d := image.Pt(j, i).Sub(s.Origin)
+			if reflect {
+				d = d.Mul(-1)
+			}
+			p = append(p, d)
+		}
+	}
+	return p
+}
+
+// Binarize makes a mask of the image, the pixels where
+// fn is true are 255 and the rest are 0
+func Binarize(m image.Image, fn func(c color.Color) bool) *image.Gray {
+	r := m.Bounds()
+	p := image.NewGray(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if fn(m.At(x, y)) {
+				p.Pix[p.PixOffset(x, y)] = 255
+			}
+		}
+	}
+	return p
+}
+
+// Erode sets every pixel to the minimum of the pixels under
+// the element, binary images are masks of 0 and 255, pixels
+// outside of the image do not take part
+func Erode(m *image.Gray, s *StructElem) *image.Gray {
+	return morph(m, s.offsets(false), 255, func(a, b uint8) bool { return b < a })
+}
+
+// Dilate sets every pixel to the maximum of the pixels
+// under the reflected element
+func Dilate(m *image.Gray, s *StructElem) *image.Gray {
+	return morph(m, s.offsets(true), 0, func(a, b uint8) bool { return b > a })
+}
+
+// Open is an erosion followed by a dilation, it removes
+// bright details smaller than the element
+func Open(m *image.Gray, s *StructElem) *image.Gray {
+	return Dilate(Erode(m, s), s)
+}
+
+// Close is a dilation followed by an erosion, it fills
+// dark holes and gaps smaller than the element
+func Close(m *image.Gray, s *StructElem) *image.Gray {
+	return Erode(Dilate(m, s), s)
+}
+
+func morph(m *image.Gray, offsets []image.Point, init uint8, better func(a, b uint8) bool) *image.Gray {
+	r := m.Bounds()
+	p := image.NewGray(r)
+	parallel.Lines(r.Dy(), parallel.Workers(0), func(_, lo, hi int) {
+		for y := r.Min.Y + lo; y < r.Min.Y+hi; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				v := init
+				for _, d := range offsets {
+					q := image.Pt(x+d.X, y+d.Y)
+					if !q.In(r) {
+						continue
+					}
+					if c := m.Pix[m.PixOffset(q.X, q.Y)]; better(v, c) {
+						v = c
+					}
+				}
+				p.Pix[p.PixOffset(x, y)] = v
+			}
+		}
+	})
+	return p
+}
@@ -0,0 +1,213 @@
+package imageutil
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	PackMaxRects = iota
+	PackSkyline
+)
+
+// RectPacker places rectangles inside a bin without overlap,
+// max rects keeps a list of the free areas and places each
+// rectangle where the shorter leftover side is the smallest,
+// skyline keeps the top edge of the placed rectangles and puts
+// each rectangle as low as it can, it is faster but wastes more
+type RectPacker struct {
+	Width, Height int
+	Method        int
+
+	// allow rectangles to be turned 90 degrees
+	Rotate bool
+
+	free []image.Rectangle
+	sky  []skyNode
+}
+
+type skyNode struct {
+	x, y, w int
+}
+
+func NewRectPacker(w, h, method int, rotate bool) *RectPacker {
+	p := &RectPacker{
+		Width:  w,
+		Height: h,
+		Method: method,
+		Rotate: rotate,
+	}
+	p.Reset()
+	return p
+}
+
+// Reset empties the bin
+func (p *RectPacker) Reset() {
+	p.free = []image.Rectangle{image.Rect(0, 0, p.Width, p.Height)}
+	p.sky = []skyNode{{0, 0, p.Width}}
+}
+
+// Insert places a rectangle of size w by h, if it was rotated
+// the returned rectangle is h by w, ok is false if it does not fit
+func (p *RectPacker) Insert(w, h int) (r image.Rectangle, rotated, ok bool) {
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}, false, w >= 0 && h >= 0
+	}
+
+	switch p.Method {
+	case PackSkyline:
+		return p.insertSkyline(w, h)
+	default:
+		return p.insertMaxRects(w, h)
+	}
+}
+
+func (p *RectPacker) insertMaxRects(w, h int) (image.Rectangle, bool, bool) {
+	var (
+		best      image.Rectangle
+		rotated   bool
+		found     bool
+		bestShort = math.MaxInt
+		bestLong  = math.MaxInt
+	)
+	try := func(f image.Rectangle, w, h int, rot bool) {
+		if w > f.Dx() || h > f.Dy() {
+			return
+		}
+		dx, dy := f.Dx()-w, f.Dy()-h
+		short, long := min(dx, dy), max(dx, dy)
+		if short < bestShort || (short == bestShort && long < bestLong) {
+			best = image.Rect(f.Min.X, f.Min.Y, f.Min.X+w, f.Min.Y+h)
+			rotated, found = rot, true
+			bestShort, bestLong = short, long
+		}
+	}
+	for _, f := range p.free {
+		try(f, w, h, false)
+		if p.Rotate && w != h {
+			try(f, h, w, true)
+		}
+	}
+	if !found {
+		return image.Rectangle{}, false, false
+	}
+
+	// split every free area the rectangle overlaps into the
+	// up to four areas around it that are still free
+	var free []image.Rectangle
+	for _, f := range p.free {
+		if !f.Overlaps(best) {
+			free = append(free, f)
+			continue
+		}
+		if best.Min.X > f.Min.X {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, best.Min.X, f.Max.Y))
+		}
+		if best.Max.X < f.Max.X {
+			free = append(free, image.Rect(best.Max.X, f.Min.Y, f.Max.X, f.Max.Y))
+		}
+		if best.Min.Y > f.Min.Y {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, f.Max.X, best.Min.Y))
+		}
+		if best.Max.Y < f.Max.Y {
+			free = append(free, image.Rect(f.Min.X, best.Max.Y, f.Max.X, f.Max.Y))
+		}
+	}
+
+	// drop the areas that are inside another one
+	p.free = p.free[:0]
+	for i, f := range free {
+		inside := false
+		for j, g := range free {
+			if i != j && f.In(g) && (f != g || i > j) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			p.free = append(p.free, f)
+		}
+	}
+
+	return best, rotated, true
+}
+
+func (p *RectPacker) insertSkyline(w, h int) (image.Rectangle, bool, bool) {
+	var (
+		best      image.Rectangle
+		bestIndex = -1
+		rotated   bool
+		bestY     = math.MaxInt
+		bestX     = math.MaxInt
+	)
+	try := func(w, h int, rot bool) {
+		for i := range p.sky {
+			y, ok := p.skylineFit(i, w, h)
+			if !ok {
+				continue
+			}
+			x := p.sky[i].x
+			if y+h < bestY || (y+h == bestY && x < bestX) {
+				best = image.Rect(x, y, x+w, y+h)
+				bestIndex, rotated = i, rot
+				bestY, bestX = y+h, x
+			}
+		}
+	}
+	try(w, h, false)
+	if p.Rotate && w != h {
+		try(h, w, true)
+	}
+	if bestIndex < 0 {
+		return image.Rectangle{}, false, false
+	}
+
+	// the new node covers the nodes under the rectangle,
+	// the last of them may only be partly covered
+	n := skyNode{best.Min.X, best.Max.Y, best.Dx()}
+	sky := append([]skyNode{}, p.sky[:bestIndex]...)
+	sky = append(sky, n)
+	for _, s := range p.sky[bestIndex:] {
+		end := s.x + s.w
+		if end <= best.Max.X {
+			continue
+		}
+		if s.x < best.Max.X {
+			s.w = end - best.Max.X
+			s.x = best.Max.X
+		}
+		sky = append(sky, s)
+	}
+
+	// merge neighbors at the same height
+	p.sky = sky[:1]
+	for _, s := range sky[1:] {
+		l := &p.sky[len(p.sky)-1]
+		if l.y == s.y {
+			l.w += s.w
+		} else {
+			p.sky = append(p.sky, s)
+		}
+	}
+
+	return best, rotated, true
+}
+
+// skylineFit returns the height a rectangle starting at
+// node i would rest at, or false if it does not fit
+func (p *RectPacker) skylineFit(i, w, h int) (int, bool) {
+	x := p.sky[i].x
+	if x+w > p.Width {
+		return 0, false
+	}
+
+	y := 0
+	for left := w; left > 0; i++ {
+		y = max(y, p.sky[i].y)
+		if y+h > p.Height {
+			return 0, false
+		}
+		left -= p.sky[i].w
+	}
+	return y, true
+}
@@ -0,0 +1,381 @@
+package imageutil
+
+import (
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	JoinMiter = iota
+	JoinRound
+	JoinBevel
+)
+
+const (
+	CapButt = iota
+	CapRound
+	CapSquare
+)
+
+// maximum distance in pixels between a curve
+// and the line segments it is flattened to
+const flatness = 0.1
+
+// Path is a list of subpaths made of lines and bezier curves,
+// the curves are flattened to lines as they are added
+type Path struct {
+	subs []subpath
+}
+
+type subpath struct {
+	pts    []f64.Vec2
+	closed bool
+}
+
+type StrokeOptions struct {
+	// width of the line, zero means 1
+	Width float64
+
+	Join int
+	Cap  int
+
+	// longest a miter join can be relative to the
+	// half width before it is beveled, zero means 4
+	MiterLimit float64
+
+	// lengths of the dashes and the gaps between them,
+	// an odd number of lengths is repeated to make it
+	// even, the offset shifts where the pattern starts
+	Dash       []float64
+	DashOffset float64
+}
+
+func (p *Path) MoveTo(x, y float64) {
+	p.subs = append(p.subs, subpath{pts: []f64.Vec2{{x, y}}})
+}
+
+func (p *Path) LineTo(x, y float64) {
+	s := p.current()
+	s.pts = append(s.pts, f64.Vec2{x, y})
+}
+
+func (p *Path) QuadTo(cx, cy, x, y float64) {
+	s := p.current()
+	p0 := s.pts[len(s.pts)-1]
+	p1 := f64.Vec2{cx, cy}
+	p2 := f64.Vec2{x, y}
+
+	// the distance to the control polygon bounds the error
+	d := p0.Sub(p1.Scale(2)).Add(p2).Len()
+	n := segments(d / 4)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		s.pts = append(s.pts, p0.Scale(u*u).Add(p1.Scale(2*u*t)).Add(p2.Scale(t*t)))
+	}
+}
+
+func (p *Path) CubicTo(c1x, c1y, c2x, c2y, x, y float64) {
+	s := p.current()
+	p0 := s.pts[len(s.pts)-1]
+	p1 := f64.Vec2{c1x, c1y}
+	p2 := f64.Vec2{c2x, c2y}
+	p3 := f64.Vec2{x, y}
+
+	d1 := p0.Sub(p1.Scale(2)).Add(p2).Len()
+	d2 := p1.Sub(p2.Scale(2)).Add(p3).Len()
+	n := segments(math.Max(d1, d2) * 3 / 4)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		s.pts = append(s.pts, p0.Scale(u*u*u).
+			Add(p1.Scale(3*u*u*t)).
+			Add(p2.Scale(3*u*t*t)).
+			Add(p3.Scale(t*t*t)))
+	}
+}
+
+// Close connects the end of the subpath to its start
+func (p *Path) Close() {
+	if len(p.subs) > 0 {
+		p.subs[len(p.subs)-1].closed = true
+	}
+}
+
+// Ellipse adds a closed ellipse made of four cubic curves
+func (p *Path) Ellipse(cx, cy, rx, ry float64) {
+	// distance of the control points for a quarter circle
+	const k = 0.5522847498307936
+	p.MoveTo(cx+rx, cy)
+	p.CubicTo(cx+rx, cy+ry*k, cx+rx*k, cy+ry, cx, cy+ry)
+	p.CubicTo(cx-rx*k, cy+ry, cx-rx, cy+ry*k, cx-rx, cy)
+	p.CubicTo(cx-rx, cy-ry*k, cx-rx*k, cy-ry, cx, cy-ry)
+	p.CubicTo(cx+rx*k, cy-ry, cx+rx, cy-ry*k, cx+rx, cy)
+	p.Close()
+}
+
+// Polygon adds a closed subpath through the points
+func (p *Path) Polygon(pts ...f64.Vec2) {
+	if len(pts) == 0 {
+		return
+	}
+	p.MoveTo(pts[0].X, pts[0].Y)
+	for _, q := range pts[1:] {
+		p.LineTo(q.X, q.Y)
+	}
+	p.Close()
+}
+
+// current returns the subpath being built, starting
+// one at the origin if there is none
+func (p *Path) current() *subpath {
+	if len(p.subs) == 0 || p.subs[len(p.subs)-1].closed {
+		var q f64.Vec2
+		if n := len(p.subs); n > 0 {
+			q = p.subs[n-1].pts[0]
+		}
+		p.MoveTo(q.X, q.Y)
+	}
+	return &p.subs[len(p.subs)-1]
+}
+
+// segments returns how many lines a curve needs given
+// a bound on the distance of the curve to its chord
+func segments(d float64) int {
+	n := int(math.Ceil(math.Sqrt(d / flatness)))
+	return min(max(n, 1), 1000)
+}
+
+// polygons returns the subpaths as closed polygons to fill
+func (p *Path) polygons() [][]f64.Vec2 {
+	var ps [][]f64.Vec2
+	for _, s := range p.subs {
+		if len(s.pts) > 2 {
+			ps = append(ps, s.pts)
+		}
+	}
+	return ps
+}
+
+// stroke returns the outline of the path as a set of convex
+// polygons wound the same way, so filling them with the
+// non-zero rule draws their union
+func (p *Path) stroke(o *StrokeOptions) [][]f64.Vec2 {
+	if o == nil {
+		o = &StrokeOptions{}
+	}
+	hw := o.Width / 2
+	if hw <= 0 {
+		hw = 0.5
+	}
+	limit := o.MiterLimit
+	if limit <= 0 {
+		limit = 4
+	}
+
+	subs := p.subs
+	if len(o.Dash) > 0 {
+		subs = dash(subs, o.Dash, o.DashOffset)
+	}
+
+	var ps [][]f64.Vec2
+	add := func(pts ...f64.Vec2) {
+		if polygonArea(pts) < 0 {
+			for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+				pts[i], pts[j] = pts[j], pts[i]
+			}
+		}
+		ps = append(ps, pts)
+	}
+
+	for _, s := range subs {
+		pts := dedup(s.pts, s.closed)
+		if len(pts) == 1 {
+			// a lone point only shows up with caps
+			switch o.Cap {
+			case CapRound:
+				add(circlePolygon(pts[0], hw)...)
+			case CapSquare:
+				c := pts[0]
+				add(f64.Vec2{c.X - hw, c.Y - hw}, f64.Vec2{c.X + hw, c.Y - hw},
+					f64.Vec2{c.X + hw, c.Y + hw}, f64.Vec2{c.X - hw, c.Y + hw})
+			}
+			continue
+		}
+
+		n := len(pts) - 1
+		if s.closed {
+			pts = append(pts, pts[0])
+			n++
+		}
+		for i := 0; i < n; i++ {
+			a, b := pts[i], pts[i+1]
+			d := b.Sub(a).Normalize()
+			if !s.closed && o.Cap == CapSquare {
+				if i == 0 {
+					a = a.SubScale(d, hw)
+				}
+				if i == n-1 {
+					b = b.AddScale(d, hw)
+				}
+			}
+			nv := f64.Vec2{-d.Y, d.X}.Scale(hw)
+			add(a.Add(nv), b.Add(nv), b.Sub(nv), a.Sub(nv))
+		}
+
+		// joins go on the inner vertices, and on the
+		// start of a closed subpath as well
+		for i := 1; i < len(pts)-1; i++ {
+			join(add, pts[i-1], pts[i], pts[i+1], hw, o.Join, limit)
+		}
+		if s.closed {
+			join(add, pts[n-1], pts[0], pts[1], hw, o.Join, limit)
+		}
+
+		if !s.closed && o.Cap == CapRound {
+			add(circlePolygon(pts[0], hw)...)
+			add(circlePolygon(pts[n], hw)...)
+		}
+	}
+	return ps
+}
+
+// dash splits the subpaths into open ones along the pattern,
+// a pattern that is not positive leaves them as they are
+func dash(subs []subpath, pattern []float64, offset float64) []subpath {
+	if len(pattern)%2 != 0 {
+		pattern = append(pattern[:len(pattern):len(pattern)], pattern...)
+	}
+	total := 0.0
+	for _, d := range pattern {
+		if d < 0 {
+			return subs
+		}
+		total += d
+	}
+	if total <= 0 {
+		return subs
+	}
+
+	var ds []subpath
+	for _, s := range subs {
+		pts := s.pts
+		if s.closed && len(pts) > 1 {
+			pts = append(pts[:len(pts):len(pts)], pts[0])
+		}
+
+		// find where the offset falls in the pattern
+		i := 0
+		left := pattern[0]
+		t := math.Mod(offset, total)
+		if t < 0 {
+			t += total
+		}
+		for t >= left {
+			t -= left
+			i = (i + 1) % len(pattern)
+			left = pattern[i]
+		}
+		left -= t
+
+		on := i%2 == 0
+		if on {
+			ds = append(ds, subpath{pts: []f64.Vec2{pts[0]}})
+		}
+		for j := 1; j < len(pts); j++ {
+			a, b := pts[j-1], pts[j]
+			l := b.Sub(a).Len()
+			u := 0.0
+			for l-u > left {
+				u += left
+				q := a.Lerp(u/l, b)
+				if on {
+					ds[len(ds)-1].pts = append(ds[len(ds)-1].pts, q)
+				} else {
+					ds = append(ds, subpath{pts: []f64.Vec2{q}})
+				}
+				on = !on
+				i = (i + 1) % len(pattern)
+				left = pattern[i]
+			}
+			left -= l - u
+			if on {
+				ds[len(ds)-1].pts = append(ds[len(ds)-1].pts, b)
+			}
+		}
+	}
+	return ds
+}
+
+func join(add func(...f64.Vec2), a, p, b f64.Vec2, hw float64, op int, limit float64) {
+	d0 := p.Sub(a).Normalize()
+	d1 := b.Sub(p).Normalize()
+	cr := d0.X*d1.Y - d0.Y*d1.X
+	if math.Abs(cr) < 1e-9 && d0.Dot(d1) > 0 {
+		return
+	}
+
+	if op == JoinRound {
+		add(circlePolygon(p, hw)...)
+		return
+	}
+
+	// the outer side of the turn is opposite to the turn direction
+	s := -hw
+	if cr < 0 {
+		s = hw
+	}
+	n0 := f64.Vec2{-d0.Y, d0.X}
+	n1 := f64.Vec2{-d1.Y, d1.X}
+	p0 := p.AddScale(n0, s)
+	p1 := p.AddScale(n1, s)
+
+	if op == JoinMiter {
+		c := n0.Dot(n1)
+		if ratio := math.Sqrt(2 / (1 + c)); 1+c > 1e-9 && ratio <= limit {
+			m := n0.Add(n1).Normalize().Scale(s * ratio)
+			add(p, p0, p.Add(m), p1)
+			return
+		}
+	}
+	add(p, p0, p1)
+}
+
+// circlePolygon returns a polygon close to the circle
+// within the flatness tolerance
+func circlePolygon(c f64.Vec2, r float64) []f64.Vec2 {
+	n := 8
+	if r > flatness {
+		n = max(n, int(math.Ceil(math.Pi/math.Acos(1-flatness/r))))
+	}
+	pts := make([]f64.Vec2, n)
+	for i := range pts {
+		t := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = f64.Vec2{c.X + r*math.Cos(t), c.Y + r*math.Sin(t)}
+	}
+	return pts
+}
+
+func polygonArea(pts []f64.Vec2) float64 {
+	a := 0.0
+	for i := range pts {
+		p, q := pts[i], pts[(i+1)%len(pts)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a / 2
+}
+
+// dedup removes the points that repeat the point before them
+func dedup(pts []f64.Vec2, closed bool) []f64.Vec2 {
+	var p []f64.Vec2
+	for _, q := range pts {
+		if len(p) == 0 || p[len(p)-1] != q {
+			p = append(p, q)
+		}
+	}
+	if closed && len(p) > 1 && p[0] == p[len(p)-1] {
+		p = p[:len(p)-1]
+	}
+	return p
+}
@@ -0,0 +1,322 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	FillNonZero = iota
+	FillEvenOdd
+)
+
+// number of scanlines sampled inside every row of pixels,
+// the coverage along a scanline is computed exactly
+const subScanlines = 16
+
+// FillPath fills the inside of the path, the subpaths are
+// closed if they are not already, pixel centers are at half
+// integer coordinates
+func FillPath(m draw.Image, p *Path, rule int, c color.Color) {
+	fillPolygons(m, p.polygons(), rule, c)
+}
+
+// StrokePath draws the outline of the path
+func StrokePath(m draw.Image, p *Path, o *StrokeOptions, c color.Color) {
+	fillPolygons(m, p.stroke(o), FillNonZero, c)
+}
+
+// RasterizePath calls fn with the coverage of every pixel inside
+// clip the path covers, for drawing into something that is not
+// an image or blending in other ways
+func RasterizePath(p *Path, rule int, clip image.Rectangle, fn func(x, y int, a float64)) {
+	rasterize(p.polygons(), rule, clip, fn)
+}
+
+// RasterizeStroke is RasterizePath for the outline of the path
+func RasterizeStroke(p *Path, o *StrokeOptions, clip image.Rectangle, fn func(x, y int, a float64)) {
+	rasterize(p.stroke(o), FillNonZero, clip, fn)
+}
+
+func FillPolygon(m draw.Image, pts []f64.Vec2, rule int, c color.Color) {
+	fillPolygons(m, [][]f64.Vec2{pts}, rule, c)
+}
+
+func ThickLineAA(m draw.Image, x0, y0, x1, y1, wd float64, c color.Color) {
+	var p Path
+	p.MoveTo(x0, y0)
+	p.LineTo(x1, y1)
+	StrokePath(m, &p, &StrokeOptions{Width: wd}, c)
+}
+
+func CircleAA(m draw.Image, cx, cy, r float64, c color.Color) {
+	EllipseAA(m, cx, cy, r, r, c)
+}
+
+func FilledCircleAA(m draw.Image, cx, cy, r float64, c color.Color) {
+	FilledEllipseAA(m, cx, cy, r, r, c)
+}
+
+// EllipseAA draws the outline of an ellipse one pixel wide
+func EllipseAA(m draw.Image, cx, cy, rx, ry float64, c color.Color) {
+	var p Path
+	p.Ellipse(cx, cy, rx, ry)
+	StrokePath(m, &p, nil, c)
+}
+
+func FilledEllipseAA(m draw.Image, cx, cy, rx, ry float64, c color.Color) {
+	var p Path
+	p.Ellipse(cx, cy, rx, ry)
+	FillPath(m, &p, FillNonZero, c)
+}
+
+// LineAA draws a one pixel wide line with Xiaolin Wu's
+// algorithm, the end points are at pixel coordinates
+// like the rest of the anti-aliased functions
+func LineAA(m draw.Image, x0, y0, x1, y1 float64, c color.Color) {
+	pt := newPainter(m, c)
+	x0, y0, x1, y1 = x0-.5, y0-.5, x1-.5, y1-.5
+
+	steep := math.Abs(y1-y0) > math.Abs(x1-x0)
+	if steep {
+		x0, y0 = y0, x0
+		x1, y1 = y1, x1
+	}
+	if x0 > x1 {
+		x0, x1 = x1, x0
+		y0, y1 = y1, y0
+	}
+	plot := func(x, y int, a float64) {
+		if steep {
+			x, y = y, x
+		}
+		pt.blend(x, y, a)
+	}
+	fpart := func(x float64) float64 {
+		return x - math.Floor(x)
+	}
+
+	dx, dy := x1-x0, y1-y0
+	g := 1.0
+	if dx != 0 {
+		g = dy / dx
+	}
+
+	// the end points are weighted by how much of
+	// their pixel the line covers horizontally
+	xe := math.Round(x0)
+	ye := y0 + g*(xe-x0)
+	xg := 1 - fpart(x0+.5)
+	xp1 := int(xe)
+	yp1 := int(math.Floor(ye))
+	plot(xp1, yp1, (1-fpart(ye))*xg)
+	plot(xp1, yp1+1, fpart(ye)*xg)
+	y := ye + g
+
+	xe = math.Round(x1)
+	ye = y1 + g*(xe-x1)
+	xg = fpart(x1 + .5)
+	xp2 := int(xe)
+	yp2 := int(math.Floor(ye))
+	if xp2 == xp1 {
+		return
+	}
+	plot(xp2, yp2, (1-fpart(ye))*xg)
+	plot(xp2, yp2+1, fpart(ye)*xg)
+
+	for x := xp1 + 1; x < xp2; x++ {
+		iy := int(math.Floor(y))
+		plot(x, iy, 1-fpart(y))
+		plot(x, iy+1, fpart(y))
+		y += g
+	}
+}
+
+type edge struct {
+	x0, y0 float64
+	x1, y1 float64
+	dir    int
+}
+
+func fillPolygons(m draw.Image, ps [][]f64.Vec2, rule int, c color.Color) {
+	pt := newPainter(m, c)
+	rasterize(ps, rule, m.Bounds(), pt.blend)
+}
+
+// rasterize computes how much of each pixel inside clip the
+// polygons cover and calls fn on every pixel that is covered
+func rasterize(ps [][]f64.Vec2, rule int, clip image.Rectangle, fn func(x, y int, a float64)) {
+	var es []edge
+	bb := f64.Rectangle{
+		Min: f64.Vec2{math.MaxFloat64, math.MaxFloat64},
+		Max: f64.Vec2{-math.MaxFloat64, -math.MaxFloat64},
+	}
+	for _, pts := range ps {
+		for i := range pts {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			bb.Min = bb.Min.Min(a)
+			bb.Max = bb.Max.Max(a)
+			if a.Y == b.Y || math.IsNaN(a.X+a.Y+b.X+b.Y) {
+				continue
+			}
+			e := edge{a.X, a.Y, b.X, b.Y, 1}
+			if a.Y > b.Y {
+				e = edge{b.X, b.Y, a.X, a.Y, -1}
+			}
+			es = append(es, e)
+		}
+	}
+	if len(es) == 0 {
+		return
+	}
+
+	r := image.Rect(
+		int(math.Floor(bb.Min.X)), int(math.Floor(bb.Min.Y)),
+		int(math.Ceil(bb.Max.X))+1, int(math.Ceil(bb.Max.Y))+1,
+	).Intersect(clip)
+	if r.Empty() {
+		return
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].y0 < es[j].y0
+	})
+
+	type crossing struct {
+		x   float64
+		dir int
+	}
+
+	w := r.Dx()
+	cov := make([]float64, w+2)
+	acc := make([]float64, w+2)
+	span := func(xa, xb, a float64) {
+		xa = f64.Clamp(xa-float64(r.Min.X), 0, float64(w))
+		xb = f64.Clamp(xb-float64(r.Min.X), 0, float64(w))
+		if xa >= xb {
+			return
+		}
+		ia, ib := int(xa), int(xb)
+		if ia == ib {
+			cov[ia] += (xb - xa) * a
+			return
+		}
+		cov[ia] += (float64(ia+1) - xa) * a
+		acc[ia+1] += a
+		acc[ib] -= a
+		cov[ib] += (xb - float64(ib)) * a
+	}
+
+	var (
+		active []edge
+		xs     []crossing
+		next   int
+	)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for i := range cov {
+			cov[i], acc[i] = 0, 0
+		}
+
+		for s := 0; s < subScanlines; s++ {
+			sy := float64(y) + (float64(s)+.5)/subScanlines
+
+			// update the edges crossing this scanline
+			for next < len(es) && es[next].y0 <= sy {
+				active = append(active, es[next])
+				next++
+			}
+			n := 0
+			for _, e := range active {
+				if e.y1 > sy {
+					active[n] = e
+					n++
+				}
+			}
+			active = active[:n]
+
+			xs = xs[:0]
+			for _, e := range active {
+				if e.y0 > sy {
+					continue
+				}
+				t := (sy - e.y0) / (e.y1 - e.y0)
+				xs = append(xs, crossing{e.x0 + t*(e.x1-e.x0), e.dir})
+			}
+			sort.Slice(xs, func(i, j int) bool {
+				return xs[i].x < xs[j].x
+			})
+
+			wind := 0
+			for i, x := range xs {
+				wind += x.dir
+				in := wind != 0
+				if rule == FillEvenOdd {
+					in = wind&1 != 0
+				}
+				if in && i+1 < len(xs) {
+					span(x.x, xs[i+1].x, 1.0/subScanlines)
+				}
+			}
+		}
+
+		a := 0.0
+		for i := 0; i < w; i++ {
+			a += acc[i]
+			v := math.Min(cov[i]+a, 1)
+			if v > 1e-6 {
+				fn(r.Min.X+i, y, v)
+			}
+		}
+	}
+}
+
+// painter blends a color over the pixels of an
+// image with the alpha scaled by the coverage
+type painter struct {
+	m          draw.Image
+	rgba       *image.RGBA
+	r, g, b, a float64
+}
+
+func newPainter(m draw.Image, c color.Color) *painter {
+	r, g, b, a := c.RGBA()
+	p := &painter{
+		m: m,
+		r: float64(r),
+		g: float64(g),
+		b: float64(b),
+		a: float64(a),
+	}
+	p.rgba, _ = m.(*image.RGBA)
+	return p
+}
+
+func (p *painter) blend(x, y int, cov float64) {
+	if !image.Pt(x, y).In(p.m.Bounds()) || cov <= 0 {
+		return
+	}
+	cov = math.Min(cov, 1)
+	t := 1 - p.a*cov/0xffff
+
+	if m := p.rgba; m != nil {
+		i := m.PixOffset(x, y)
+		s := m.Pix[i : i+4 : i+4]
+		s[0] = uint8((p.r*cov+float64(s[0])*257*t)/257 + .5)
+		s[1] = uint8((p.g*cov+float64(s[1])*257*t)/257 + .5)
+		s[2] = uint8((p.b*cov+float64(s[2])*257*t)/257 + .5)
+		s[3] = uint8((p.a*cov+float64(s[3])*257*t)/257 + .5)
+		return
+	}
+
+	r, g, b, a := p.m.At(x, y).RGBA()
+	p.m.Set(x, y, color.RGBA64{
+		uint16(p.r*cov + float64(r)*t + .5),
+		uint16(p.g*cov + float64(g)*t + .5),
+		uint16(p.b*cov + float64(b)*t + .5),
+		uint16(p.a*cov + float64(a)*t + .5),
+	})
+}
@@ -0,0 +1,122 @@
+package imageutil
+
+import (
+	"image"
+	"math"
+
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	ToneClamp = iota
+	ToneReinhard
+	ToneACES
+	ToneFilmic
+)
+
+type ToneOptions struct {
+	Operator int
+
+	// exposure adjustment in stops applied before the operator
+	Exposure float64
+
+	// smallest luminance that maps to white for the reinhard
+	// operator and the linear white point for the filmic one,
+	// zero means no white point for reinhard and 11.2 for filmic
+	White float64
+
+	// gamma of the output, zero means the srgb curve
+	Gamma float64
+}
+
+// ToneMap maps a float image in linear light to a displayable
+// image, the values are scaled so 255 is 1 like the rest of
+// the float functions, reinhard compresses the luminance while
+// aces and filmic are applied on every channel
+func (f *Float) ToneMap(o *ToneOptions) *image.RGBA {
+	if o == nil {
+		o = &ToneOptions{Operator: ToneReinhard}
+	}
+	exp := math.Exp2(o.Exposure) / 255
+
+	r := f.Rect
+	m := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := f.FloatAt(x, y)
+			a := f64.Clamp(c[3]/255, 0, 1)
+			if a == 0 {
+				continue
+			}
+
+			v := f64.Vec3{c[0], c[1], c[2]}.Scale(exp / a)
+			v = toneMap(v, o)
+			v = f64.Vec3{encodeGamma(v.X, o.Gamma), encodeGamma(v.Y, o.Gamma), encodeGamma(v.Z, o.Gamma)}
+
+			i := m.PixOffset(x, y)
+			m.Pix[i] = f64.Clamp8(v.X*a*255, 0, 255)
+			m.Pix[i+1] = f64.Clamp8(v.Y*a*255, 0, 255)
+			m.Pix[i+2] = f64.Clamp8(v.Z*a*255, 0, 255)
+			m.Pix[i+3] = f64.Clamp8(a*255, 0, 255)
+		}
+	}
+	return m
+}
+
+func toneMap(v f64.Vec3, o *ToneOptions) f64.Vec3 {
+	perChannel := func(fn func(x float64) float64) f64.Vec3 {
+		return f64.Vec3{fn(v.X), fn(v.Y), fn(v.Z)}
+	}
+
+	switch o.Operator {
+	case ToneReinhard:
+		l := 0.2126*v.X + 0.7152*v.Y + 0.0722*v.Z
+		if l <= 0 {
+			return f64.Vec3{}
+		}
+		ld := l / (1 + l)
+		if w := o.White; w > 0 {
+			ld = l * (1 + l/(w*w)) / (1 + l)
+		}
+		return v.Scale(ld / l)
+
+	case ToneACES:
+		// narkowicz's fit of the aces reference rendering transform
+		return perChannel(func(x float64) float64 {
+			x = math.Max(x, 0)
+			return (x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14)
+		})
+
+	case ToneFilmic:
+		// hable's curve from uncharted 2
+		hable := func(x float64) float64 {
+			const (
+				A = 0.15
+				B = 0.50
+				C = 0.10
+				D = 0.20
+				E = 0.02
+				F = 0.30
+			)
+			return (x*(A*x+C*B)+D*E)/(x*(A*x+B)+D*F) - E/F
+		}
+		w := o.White
+		if w <= 0 {
+			w = 11.2
+		}
+		s := 1 / hable(w)
+		return perChannel(func(x float64) float64 {
+			return hable(2*math.Max(x, 0)) * s
+		})
+	}
+	return v
+}
+
+func encodeGamma(x, g float64) float64 {
+	x = f64.Clamp(x, 0, 1)
+	if g > 0 {
+		return math.Pow(x, 1/g)
+	}
+	return chroma.Linear2SRGB(x)
+}
@@ -5,32 +5,27 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/qeedquan/go-media/image/chroma"
-	"github.com/qeedquan/go-media/image/pnm"
-	_ "github.com/qeedquan/go-media/image/psd"
-	"github.com/qeedquan/go-media/image/tga"
 	"github.com/qeedquan/go-media/math/mathutil"
 	"github.com/qeedquan/go-media/xio"
-	"golang.org/x/image/bmp"
 )
 
 func LoadRGBADir(dir string) ([]*image.RGBA, error) {
-	exts := []string{"png", "jpg", "jpeg", "tga", "gif"}
-
 	var m []*image.RGBA
-	for _, ext := range exts {
-		glob := fmt.Sprintf("%v/*.%v", dir, ext)
-		p, _ := LoadRGBAGlob(glob)
-		m = append(m, p...)
+	for _, c := range codecs {
+		if c.Decode == nil {
+			continue
+		}
+		for _, ext := range c.Exts {
+			glob := fmt.Sprintf("%v/*%v", dir, ext)
+			p, _ := LoadRGBAGlob(glob)
+			m = append(m, p...)
+		}
 	}
 	return m, nil
 }
@@ -61,41 +56,30 @@ func LoadRGBAFS(fs xio.FS, name string) (*image.RGBA, error) {
 }
 
 func LoadRGBAFile(name string) (*image.RGBA, error) {
-	f, err := os.Open(name)
+	m, err := LoadImageFile(name)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	m, err := LoadRGBAReader(f)
-	if err != nil {
-		if strings.HasSuffix(strings.ToLower(name), "tga") {
-			f.Seek(0, io.SeekStart)
-			m, xerr := tga.Decode(f)
-			if xerr == nil {
-				return m.(*image.RGBA), nil
-			}
-		}
-
-		return nil, &os.PathError{Op: "decode", Path: name, Err: err}
-	}
-	return m, nil
+	return toRGBA(m), nil
 }
 
 func LoadRGBAReader(rd io.Reader) (*image.RGBA, error) {
-	m, _, err := image.Decode(rd)
+	m, _, err := DecodeImage(rd)
 	if err != nil {
 		return nil, err
 	}
+	return toRGBA(m), nil
+}
 
+func toRGBA(m image.Image) *image.RGBA {
 	if p, _ := m.(*image.RGBA); p != nil {
-		return p, nil
+		return p
 	}
 
 	r := m.Bounds()
 	p := image.NewRGBA(r)
 	draw.Draw(p, p.Bounds(), m, r.Min, draw.Src)
-	return p, nil
+	return p
 }
 
 func LoadGrayFile(name string) (*image.Gray, error) {
@@ -113,7 +97,7 @@ func LoadGrayFile(name string) (*image.Gray, error) {
 }
 
 func LoadGrayReader(rd io.Reader) (*image.Gray, error) {
-	m, _, err := image.Decode(rd)
+	m, _, err := DecodeImage(rd)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +113,7 @@ func LoadGrayReader(rd io.Reader) (*image.Gray, error) {
 }
 
 func LoadFloatFile(name string) (*Float, error) {
-	m, err := LoadRGBAFile(name)
+	m, err := LoadImageFile(name)
 	if err != nil {
 		return nil, err
 	}
@@ -137,7 +121,7 @@ func LoadFloatFile(name string) (*Float, error) {
 }
 
 func LoadFloatReader(rd io.Reader) (*Float, error) {
-	m, err := LoadRGBAReader(rd)
+	m, _, err := DecodeImage(rd)
 	if err != nil {
 		return nil, err
 	}
@@ -145,40 +129,7 @@ func LoadFloatReader(rd io.Reader) (*Float, error) {
 }
 
 func WriteRGBAFile(name string, img image.Image) error {
-	f, err := os.Create(name)
-	if err != nil {
-		return err
-	}
-
-	ext := filepath.Ext(name)
-	switch strings.ToLower(ext) {
-	case ".jpg", ".jpeg":
-		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 100})
-	case ".pbm":
-		err = pnm.Encode(f, img, &pnm.Options{Format: 1})
-	case ".pgm":
-		err = pnm.Encode(f, img, &pnm.Options{Format: 2})
-	case ".ppm":
-		err = pnm.Encode(f, img, &pnm.Options{Format: 3})
-	case ".gif":
-		err = gif.Encode(f, img, &gif.Options{
-			NumColors: 256,
-		})
-	case ".tga":
-		err = tga.Encode(f, img)
-	case ".bmp":
-		err = bmp.Encode(f, img)
-	case ".png":
-		fallthrough
-	default:
-		err = png.Encode(f, img)
-	}
-
-	xerr := f.Close()
-	if err == nil {
-		err = xerr
-	}
-	return err
+	return SaveImageFile(name, img, nil)
 }
 
 func ColorKey(m image.Image, c color.Color) *image.RGBA {
@@ -0,0 +1,38 @@
+package parallel
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers is the number of workers to use when asked
+// for n, zero or less uses all of the processors
+func Workers(n int) int {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return max(n, 1)
+}
+
+// Lines splits n lines into bands and calls fn on
+// each band on its own goroutine, w is the index of the
+// worker so it can use its own scratch buffer
+func Lines(n, nw int, fn func(w, lo, hi int)) {
+	if nw > n {
+		nw = n
+	}
+	if nw <= 1 {
+		fn(0, 0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(nw)
+	for i := 0; i < nw; i++ {
+		go func(w, lo, hi int) {
+			defer wg.Done()
+			fn(w, lo, hi)
+		}(i, n*i/nw, n*(i+1)/nw)
+	}
+	wg.Wait()
+}
@@ -19,6 +19,7 @@ type Model struct {
 	Verts   []f64.Vec4
 	Coords  []f64.Vec4
 	Normals []f64.Vec4
+	Colors  []f64.Vec4
 	Faces   [][3][3]int
 	Mats    []Material
 }
@@ -297,3 +298,69 @@ func scanBool(s *scanner.Scanner) bool {
 	}
 	return false
 }
+
+// vertex is a single face corner, it indexes into
+// the verts, coords and normals of a model
+type vertex [3]int
+
+// indexed flattens the faces so that every face corner
+// refers to the same index in all the attribute arrays,
+// this is the layout formats like ply expects
+func (m *Model) indexed() (verts, coords, normals, colors []f64.Vec4, faces [][3]int) {
+	lut := make(map[vertex]int)
+	for _, f := range m.Faces {
+		var t [3]int
+		for i := range f {
+			v := vertex{
+				resolveIndex(f[i][0], len(m.Verts)),
+				resolveIndex(f[i][1], len(m.Coords)),
+				resolveIndex(f[i][2], len(m.Normals)),
+			}
+			n, found := lut[v]
+			if !found {
+				n = len(verts)
+				lut[v] = n
+
+				var p, c, vt, vn f64.Vec4
+				if v[0] >= 0 {
+					p = m.Verts[v[0]]
+					c = f64.Vec4{1, 1, 1, 1}
+					if v[0] < len(m.Colors) {
+						c = m.Colors[v[0]]
+					}
+				}
+				if v[1] >= 0 {
+					vt = m.Coords[v[1]]
+				}
+				if v[2] >= 0 {
+					vn = m.Normals[v[2]]
+				}
+				verts = append(verts, p)
+				coords = append(coords, vt)
+				normals = append(normals, vn)
+				colors = append(colors, c)
+			}
+			t[i] = n
+		}
+		faces = append(faces, t)
+	}
+	return
+}
+
+// resolveIndex converts a one based index with negative
+// values being relative to the end into a zero based
+// index, returning -1 if the index is absent or invalid
+func resolveIndex(i, n int) int {
+	switch {
+	case i > 0:
+		i--
+	case i < 0:
+		i += n
+	default:
+		return -1
+	}
+	if i < 0 || i >= n {
+		return -1
+	}
+	return i
+}
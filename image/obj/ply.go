@@ -0,0 +1,517 @@
+package obj
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	PLY_ASCII = iota
+	PLY_BINARY_LITTLE_ENDIAN
+	PLY_BINARY_BIG_ENDIAN
+)
+
+var (
+	ErrPLYFormat = errors.New("ply: unsupported format")
+)
+
+type PLYOptions struct {
+	Format int
+}
+
+type plyProp struct {
+	name      string
+	typ       string
+	list      bool
+	countType string
+}
+
+type plyElem struct {
+	name  string
+	count int
+	props []plyProp
+}
+
+type plyDecoder struct {
+	r      *bufio.Reader
+	s      *bufio.Scanner
+	format int
+	order  binary.ByteOrder
+	elems  []plyElem
+	buf    [8]byte
+}
+
+// LoadPLY loads a ascii or binary ply file, vertex positions,
+// normals, texture coordinates and colors are read, polygons
+// are triangulated as a fan around the first vertex
+func LoadPLY(r io.Reader) (*Model, error) {
+	d := &plyDecoder{r: bufio.NewReader(r)}
+	if err := d.decodeHeader(); err != nil {
+		return nil, err
+	}
+	if d.format == PLY_ASCII {
+		d.s = bufio.NewScanner(d.r)
+		d.s.Split(bufio.ScanWords)
+	}
+
+	m := &Model{}
+	for _, e := range d.elems {
+		var err error
+		switch e.name {
+		case "vertex":
+			err = d.decodeVerts(m, &e)
+		case "face":
+			err = d.decodeFaces(m, &e)
+		default:
+			err = d.skipElem(&e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ply: %v", err)
+		}
+	}
+
+	hasCoords := len(m.Coords) > 0
+	hasNormals := len(m.Normals) > 0
+	for i := range m.Faces {
+		for j := range m.Faces[i] {
+			f := &m.Faces[i][j]
+			if f[0] < 1 || f[0] > len(m.Verts) {
+				return nil, fmt.Errorf("ply: face references invalid vertex %d", f[0]-1)
+			}
+			if hasCoords {
+				f[1] = f[0]
+			}
+			if hasNormals {
+				f[2] = f[0]
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (d *plyDecoder) decodeHeader() error {
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "ply" {
+		return ErrPLYFormat
+	}
+
+	format := false
+	for {
+		line, err = d.readLine()
+		if err != nil {
+			return err
+		}
+
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+
+		switch f[0] {
+		case "format":
+			if len(f) < 2 {
+				return ErrPLYFormat
+			}
+			switch f[1] {
+			case "ascii":
+				d.format = PLY_ASCII
+			case "binary_little_endian":
+				d.format = PLY_BINARY_LITTLE_ENDIAN
+				d.order = binary.LittleEndian
+			case "binary_big_endian":
+				d.format = PLY_BINARY_BIG_ENDIAN
+				d.order = binary.BigEndian
+			default:
+				return ErrPLYFormat
+			}
+			format = true
+
+		case "element":
+			if len(f) != 3 {
+				return fmt.Errorf("ply: invalid element declaration %q", line)
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil || n < 0 {
+				return fmt.Errorf("ply: invalid element count %q", line)
+			}
+			d.elems = append(d.elems, plyElem{name: f[1], count: n})
+
+		case "property":
+			if len(d.elems) == 0 {
+				return fmt.Errorf("ply: property declared before element")
+			}
+
+			var p plyProp
+			switch {
+			case len(f) == 5 && f[1] == "list":
+				p = plyProp{name: f[4], typ: f[3], list: true, countType: f[2]}
+			case len(f) == 3:
+				p = plyProp{name: f[2], typ: f[1]}
+			default:
+				return fmt.Errorf("ply: invalid property declaration %q", line)
+			}
+			if plyTypeSize(p.typ) == 0 || (p.list && plyTypeSize(p.countType) == 0) {
+				return fmt.Errorf("ply: unknown property type %q", line)
+			}
+
+			e := &d.elems[len(d.elems)-1]
+			e.props = append(e.props, p)
+
+		case "end_header":
+			if !format {
+				return ErrPLYFormat
+			}
+			return nil
+		}
+	}
+}
+
+func (d *plyDecoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("ply: %v", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (d *plyDecoder) decodeVerts(m *Model, e *plyElem) error {
+	var hasNormals, hasCoords, hasColors bool
+	for _, p := range e.props {
+		switch p.name {
+		case "nx", "ny", "nz":
+			hasNormals = true
+		case "s", "t", "u", "v", "texture_u", "texture_v":
+			hasCoords = true
+		case "red", "green", "blue", "alpha", "diffuse_red", "diffuse_green", "diffuse_blue":
+			hasColors = true
+		}
+	}
+
+	for i := 0; i < e.count; i++ {
+		v := f64.Vec4{0, 0, 0, 1}
+		n := f64.Vec4{}
+		t := f64.Vec4{}
+		c := f64.Vec4{1, 1, 1, 1}
+		for _, p := range e.props {
+			if p.list {
+				if err := d.skipList(&p); err != nil {
+					return err
+				}
+				continue
+			}
+
+			x, err := d.read(p.typ)
+			if err != nil {
+				return err
+			}
+
+			switch p.name {
+			case "x":
+				v.X = x
+			case "y":
+				v.Y = x
+			case "z":
+				v.Z = x
+			case "nx":
+				n.X = x
+			case "ny":
+				n.Y = x
+			case "nz":
+				n.Z = x
+			case "s", "u", "texture_u":
+				t.X = x
+			case "t", "v", "texture_v":
+				t.Y = x
+			case "red", "diffuse_red":
+				c.X = plyColor(p.typ, x)
+			case "green", "diffuse_green":
+				c.Y = plyColor(p.typ, x)
+			case "blue", "diffuse_blue":
+				c.Z = plyColor(p.typ, x)
+			case "alpha":
+				c.W = plyColor(p.typ, x)
+			}
+		}
+
+		m.Verts = append(m.Verts, v)
+		if hasNormals {
+			m.Normals = append(m.Normals, n)
+		}
+		if hasCoords {
+			m.Coords = append(m.Coords, t)
+		}
+		if hasColors {
+			m.Colors = append(m.Colors, c)
+		}
+	}
+	return nil
+}
+
+func (d *plyDecoder) decodeFaces(m *Model, e *plyElem) error {
+	var idx []int
+	for i := 0; i < e.count; i++ {
+		for _, p := range e.props {
+			if !p.list || (p.name != "vertex_indices" && p.name != "vertex_index") {
+				if err := d.skipProp(&p); err != nil {
+					return err
+				}
+				continue
+			}
+
+			n, err := d.read(p.countType)
+			if err != nil {
+				return err
+			}
+
+			idx = idx[:0]
+			for j := 0; j < int(n); j++ {
+				x, err := d.read(p.typ)
+				if err != nil {
+					return err
+				}
+				// the vertices can come after the faces,
+				// the indices are checked once all are read
+				idx = append(idx, int(x)+1)
+			}
+
+			for j := 1; j+1 < len(idx); j++ {
+				m.Faces = append(m.Faces, [3][3]int{
+					{idx[0], 0, 0},
+					{idx[j], 0, 0},
+					{idx[j+1], 0, 0},
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func (d *plyDecoder) skipElem(e *plyElem) error {
+	for i := 0; i < e.count; i++ {
+		for _, p := range e.props {
+			if err := d.skipProp(&p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *plyDecoder) skipProp(p *plyProp) error {
+	if p.list {
+		return d.skipList(p)
+	}
+	_, err := d.read(p.typ)
+	return err
+}
+
+func (d *plyDecoder) skipList(p *plyProp) error {
+	n, err := d.read(p.countType)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(n); i++ {
+		if _, err := d.read(p.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *plyDecoder) read(typ string) (float64, error) {
+	if d.format == PLY_ASCII {
+		if !d.s.Scan() {
+			err := d.s.Err()
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		return strconv.ParseFloat(d.s.Text(), 64)
+	}
+
+	b := d.buf[:plyTypeSize(typ)]
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return 0, err
+	}
+
+	switch typ {
+	case "char", "int8":
+		return float64(int8(b[0])), nil
+	case "uchar", "uint8":
+		return float64(b[0]), nil
+	case "short", "int16":
+		return float64(int16(d.order.Uint16(b))), nil
+	case "ushort", "uint16":
+		return float64(d.order.Uint16(b)), nil
+	case "int", "int32":
+		return float64(int32(d.order.Uint32(b))), nil
+	case "uint", "uint32":
+		return float64(d.order.Uint32(b)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(d.order.Uint32(b))), nil
+	case "double", "float64":
+		return math.Float64frombits(d.order.Uint64(b)), nil
+	}
+	return 0, ErrPLYFormat
+}
+
+func plyTypeSize(typ string) int {
+	switch typ {
+	case "char", "int8", "uchar", "uint8":
+		return 1
+	case "short", "int16", "ushort", "uint16":
+		return 2
+	case "int", "int32", "uint", "uint32", "float", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+	return 0
+}
+
+// plyColor normalizes integer color channels to [0, 1], signed
+// channels use their positive range with negative values as 0,
+// floating point channels are assumed to be normalized already
+func plyColor(typ string, x float64) float64 {
+	switch typ {
+	case "uchar", "uint8":
+		return x / math.MaxUint8
+	case "ushort", "uint16":
+		return x / math.MaxUint16
+	case "uint", "uint32":
+		return x / math.MaxUint32
+	case "char", "int8":
+		return math.Max(x, 0) / math.MaxInt8
+	case "short", "int16":
+		return math.Max(x, 0) / math.MaxInt16
+	case "int", "int32":
+		return math.Max(x, 0) / math.MaxInt32
+	}
+	return x
+}
+
+// WritePLY writes the model as a triangle mesh, face corners
+// that share a position but not a texture coordinate or
+// normal are split into separate vertices
+func WritePLY(w io.Writer, m *Model, o *PLYOptions) (err error) {
+	if o == nil {
+		o = &PLYOptions{Format: PLY_BINARY_LITTLE_ENDIAN}
+	}
+
+	var (
+		format string
+		order  binary.ByteOrder
+	)
+	switch o.Format {
+	case PLY_ASCII:
+		format = "ascii"
+	case PLY_BINARY_LITTLE_ENDIAN:
+		format = "binary_little_endian"
+		order = binary.LittleEndian
+	case PLY_BINARY_BIG_ENDIAN:
+		format = "binary_big_endian"
+		order = binary.BigEndian
+	default:
+		return ErrPLYFormat
+	}
+
+	bw := bufio.NewWriter(w)
+	defer func() {
+		xerr := bw.Flush()
+		if err == nil {
+			err = xerr
+		}
+	}()
+
+	verts, coords, normals, colors, faces := m.indexed()
+	hasCoords := len(m.Coords) > 0
+	hasNormals := len(m.Normals) > 0
+	hasColors := len(m.Colors) > 0
+
+	fmt.Fprintf(bw, "ply\n")
+	fmt.Fprintf(bw, "format %s 1.0\n", format)
+	fmt.Fprintf(bw, "element vertex %d\n", len(verts))
+	fmt.Fprintf(bw, "property float x\nproperty float y\nproperty float z\n")
+	if hasNormals {
+		fmt.Fprintf(bw, "property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasCoords {
+		fmt.Fprintf(bw, "property float s\nproperty float t\n")
+	}
+	if hasColors {
+		fmt.Fprintf(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	}
+	fmt.Fprintf(bw, "element face %d\n", len(faces))
+	fmt.Fprintf(bw, "property list uchar int vertex_indices\n")
+	fmt.Fprintf(bw, "end_header\n")
+
+	var (
+		fv []float32
+		cv [4]uint8
+	)
+	for i := range verts {
+		fv = append(fv[:0], float32(verts[i].X), float32(verts[i].Y), float32(verts[i].Z))
+		if hasNormals {
+			fv = append(fv, float32(normals[i].X), float32(normals[i].Y), float32(normals[i].Z))
+		}
+		if hasCoords {
+			fv = append(fv, float32(coords[i].X), float32(coords[i].Y))
+		}
+		if hasColors {
+			c := colors[i].ToRGBA()
+			cv = [4]uint8{c.R, c.G, c.B, c.A}
+		}
+
+		if order == nil {
+			for j, x := range fv {
+				if j > 0 {
+					fmt.Fprintf(bw, " ")
+				}
+				fmt.Fprintf(bw, "%v", x)
+			}
+			if hasColors {
+				fmt.Fprintf(bw, " %d %d %d %d", cv[0], cv[1], cv[2], cv[3])
+			}
+			fmt.Fprintf(bw, "\n")
+		} else {
+			if err := binary.Write(bw, order, fv); err != nil {
+				return err
+			}
+			if hasColors {
+				if err := binary.Write(bw, order, cv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, f := range faces {
+		if order == nil {
+			fmt.Fprintf(bw, "3 %d %d %d\n", f[0], f[1], f[2])
+		} else {
+			bw.WriteByte(3)
+			err := binary.Write(bw, order, [3]int32{int32(f[0]), int32(f[1]), int32(f[2])})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
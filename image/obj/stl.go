@@ -0,0 +1,244 @@
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	STL_ASCII = iota
+	STL_BINARY
+)
+
+var (
+	ErrSTLFormat = errors.New("stl: unsupported format")
+)
+
+type STLOptions struct {
+	Format int
+	Name   string
+}
+
+type stlTriangle struct {
+	Normal [3]float32
+	Verts  [3][3]float32
+	Attr   uint16
+}
+
+type stlDecoder struct {
+	m    *Model
+	lut  map[f64.Vec3]int
+	face [3]int
+}
+
+// LoadSTL loads a ascii or binary stl file, vertices
+// shared between facets are welded together and
+// each facet gets its own normal
+func LoadSTL(r io.Reader) (*Model, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &stlDecoder{
+		m:   &Model{},
+		lut: make(map[f64.Vec3]int),
+	}
+
+	// binary files can start with solid in the header too,
+	// so use the size of the file to tell them apart
+	if len(buf) >= 84 {
+		n := binary.LittleEndian.Uint32(buf[80:])
+		if 84+50*uint64(n) == uint64(len(buf)) {
+			err = d.decodeBinary(buf[84:], int(n))
+			if err != nil {
+				return nil, err
+			}
+			return d.m, nil
+		}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(buf), []byte("solid")) {
+		return nil, ErrSTLFormat
+	}
+	err = d.decodeASCII(buf)
+	if err != nil {
+		return nil, err
+	}
+	return d.m, nil
+}
+
+func (d *stlDecoder) decodeBinary(buf []byte, n int) error {
+	r := bytes.NewReader(buf)
+	for i := 0; i < n; i++ {
+		var t stlTriangle
+		err := binary.Read(r, binary.LittleEndian, &t)
+		if err != nil {
+			return fmt.Errorf("stl: %v", err)
+		}
+
+		var v [3]f64.Vec3
+		for j := range v {
+			v[j] = f64.Vec3{float64(t.Verts[j][0]), float64(t.Verts[j][1]), float64(t.Verts[j][2])}
+		}
+		n := f64.Vec3{float64(t.Normal[0]), float64(t.Normal[1]), float64(t.Normal[2])}
+		d.addFacet(n, v)
+	}
+	return nil
+}
+
+func (d *stlDecoder) decodeASCII(buf []byte) error {
+	var (
+		n    f64.Vec3
+		v    [3]f64.Vec3
+		nv   int
+		line int
+	)
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		line++
+		f := strings.Fields(s.Text())
+		if len(f) == 0 {
+			continue
+		}
+
+		var err error
+		switch f[0] {
+		case "facet":
+			nv = 0
+			n = f64.Vec3{}
+			if len(f) == 5 && f[1] == "normal" {
+				_, err = fmt.Sscan(strings.Join(f[2:], " "), &n.X, &n.Y, &n.Z)
+			}
+		case "vertex":
+			if nv >= len(v) {
+				return fmt.Errorf("stl: line %d: only triangle facets are supported", line)
+			}
+			if len(f) != 4 {
+				return fmt.Errorf("stl: line %d: invalid vertex", line)
+			}
+			_, err = fmt.Sscan(strings.Join(f[1:], " "), &v[nv].X, &v[nv].Y, &v[nv].Z)
+			nv++
+		case "endfacet":
+			if nv != len(v) {
+				return fmt.Errorf("stl: line %d: facet has %d vertices", line, nv)
+			}
+			d.addFacet(n, v)
+		}
+
+		if err != nil {
+			return fmt.Errorf("stl: line %d: %v", line, err)
+		}
+	}
+	return s.Err()
+}
+
+func (d *stlDecoder) addFacet(n f64.Vec3, v [3]f64.Vec3) {
+	// some exporters do not bother writing the normals
+	if n.LenSquared() == 0 {
+		n = v[1].Sub(v[0]).Cross(v[2].Sub(v[0]))
+		if n.LenSquared() != 0 {
+			n = n.Normalize()
+		}
+	}
+
+	m := d.m
+	m.Normals = append(m.Normals, f64.Vec4{n.X, n.Y, n.Z, 0})
+	for i := range v {
+		p, found := d.lut[v[i]]
+		if !found {
+			m.Verts = append(m.Verts, f64.Vec4{v[i].X, v[i].Y, v[i].Z, 1})
+			p = len(m.Verts)
+			d.lut[v[i]] = p
+		}
+		d.face[i] = p
+	}
+	m.Faces = append(m.Faces, [3][3]int{
+		{d.face[0], 0, len(m.Normals)},
+		{d.face[1], 0, len(m.Normals)},
+		{d.face[2], 0, len(m.Normals)},
+	})
+}
+
+// WriteSTL writes all the faces of the model as facets,
+// the facet normal is computed from the winding order
+func WriteSTL(w io.Writer, m *Model, o *STLOptions) (err error) {
+	if o == nil {
+		o = &STLOptions{Format: STL_BINARY}
+	}
+	if o.Format != STL_ASCII && o.Format != STL_BINARY {
+		return ErrSTLFormat
+	}
+	if uint64(len(m.Faces)) > math.MaxUint32 {
+		return fmt.Errorf("stl: format cannot support %d facets", len(m.Faces))
+	}
+
+	bw := bufio.NewWriter(w)
+	defer func() {
+		xerr := bw.Flush()
+		if err == nil {
+			err = xerr
+		}
+	}()
+
+	name := strings.Fields(o.Name)
+	if o.Format == STL_ASCII {
+		fmt.Fprintf(bw, "solid %s\n", strings.Join(name, "_"))
+	} else {
+		var hdr [80]byte
+		copy(hdr[:], o.Name)
+		bw.Write(hdr[:])
+		binary.Write(bw, binary.LittleEndian, uint32(len(m.Faces)))
+	}
+
+	for _, f := range m.Faces {
+		var v [3]f64.Vec3
+		for i := range f {
+			n := resolveIndex(f[i][0], len(m.Verts))
+			if n < 0 {
+				return fmt.Errorf("stl: face references invalid vertex %d", f[i][0])
+			}
+			v[i] = m.Verts[n].XYZ()
+		}
+
+		n := v[1].Sub(v[0]).Cross(v[2].Sub(v[0]))
+		if n.LenSquared() != 0 {
+			n = n.Normalize()
+		}
+
+		if o.Format == STL_ASCII {
+			fmt.Fprintf(bw, "facet normal %e %e %e\n", n.X, n.Y, n.Z)
+			fmt.Fprintf(bw, "  outer loop\n")
+			for _, p := range v {
+				fmt.Fprintf(bw, "    vertex %e %e %e\n", p.X, p.Y, p.Z)
+			}
+			fmt.Fprintf(bw, "  endloop\n")
+			fmt.Fprintf(bw, "endfacet\n")
+		} else {
+			t := stlTriangle{
+				Normal: [3]float32{float32(n.X), float32(n.Y), float32(n.Z)},
+			}
+			for i, p := range v {
+				t.Verts[i] = [3]float32{float32(p.X), float32(p.Y), float32(p.Z)}
+			}
+			if err := binary.Write(bw, binary.LittleEndian, &t); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.Format == STL_ASCII {
+		fmt.Fprintf(bw, "endsolid %s\n", strings.Join(name, "_"))
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package pnm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// FloatImage is an image that can give its colors at full
+// precision, the values are written to the file as is
+type FloatImage interface {
+	Bounds() image.Rectangle
+	FloatAt(x, y int) [4]float64
+}
+
+// EncodePFM writes a color portable float map, the
+// rows are stored bottom to top in little endian
+func EncodePFM(w io.Writer, m FloatImage) error {
+	b := bufio.NewWriter(w)
+	r := m.Bounds()
+	fmt.Fprintf(b, "PF\n%d %d\n-1.0\n", r.Dx(), r.Dy())
+
+	line := make([]float32, r.Dx()*3)
+	for y := r.Max.Y - 1; y >= r.Min.Y; y-- {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := m.FloatAt(x, y)
+			i := (x - r.Min.X) * 3
+			line[i] = float32(c[0])
+			line[i+1] = float32(c[1])
+			line[i+2] = float32(c[2])
+		}
+		binary.Write(b, binary.LittleEndian, line)
+	}
+
+	err := b.Flush()
+	if err != nil {
+		return fmt.Errorf("pnm: %v", err)
+	}
+	return nil
+}
+
+// PFM is a portable float map kept at full precision,
+// the colors returned by At are clamped to [0, 1]
+type PFM struct {
+	// red, green and blue for every pixel
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *PFM) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (p *PFM) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *PFM) At(x, y int) color.Color {
+	c := p.FloatAt(x, y)
+	return color.RGBA64{
+		unorm16(float32(c[0])),
+		unorm16(float32(c[1])),
+		unorm16(float32(c[2])),
+		unorm16(float32(c[3])),
+	}
+}
+
+func (p *PFM) FloatAt(x, y int) [4]float64 {
+	if !image.Pt(x, y).In(p.Rect) {
+		return [4]float64{}
+	}
+	i := (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*3
+	return [4]float64{float64(p.Pix[i]), float64(p.Pix[i+1]), float64(p.Pix[i+2]), 1}
+}
+
+// DecodePFM reads a color or grayscale portable float map, the
+// values are multiplied by the magnitude of the scale and kept at
+// full precision, grayscale maps are expanded to color
+func DecodePFM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		sig   string
+		w, h  int
+		scale float64
+	)
+	_, err := fmt.Fscan(br, &sig, &w, &h, &scale)
+	if err != nil {
+		return nil, fmt.Errorf("pnm: %v", err)
+	}
+	ch := 0
+	switch sig {
+	case "PF":
+		ch = 3
+	case "Pf":
+		ch = 1
+	default:
+		return nil, ErrFormat
+	}
+	if w < 0 || h < 0 || scale == 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		return nil, ErrFormat
+	}
+	// a single whitespace character ends the header
+	br.ReadByte()
+
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	k := float32(math.Abs(scale))
+	m := &PFM{
+		Pix:    make([]float32, w*h*3),
+		Stride: w * 3,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	line := make([]float32, w*ch)
+	for y := h - 1; y >= 0; y-- {
+		err := binary.Read(br, order, line)
+		if err != nil {
+			return nil, fmt.Errorf("pnm: %v", err)
+		}
+
+		p := m.Pix[y*m.Stride : (y+1)*m.Stride]
+		for i := range p {
+			p[i] = line[i/3*ch+i%3%ch] * k
+		}
+	}
+	return m, nil
+}
+
+func DecodePFMConfig(r io.Reader) (image.Config, error) {
+	var (
+		sig  string
+		w, h int
+	)
+	_, err := fmt.Fscan(r, &sig, &w, &h)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("pnm: %v", err)
+	}
+	if sig != "PF" && sig != "Pf" {
+		return image.Config{}, ErrFormat
+	}
+	return image.Config{
+		ColorModel: color.RGBA64Model,
+		Width:      w,
+		Height:     h,
+	}, nil
+}
+
+func unorm16(x float32) uint16 {
+	v := float64(x)
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	return clamp16(v * 0xffff)
+}
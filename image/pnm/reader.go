@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
 )
 
@@ -21,8 +22,15 @@ func Decode(r io.Reader) (image.Image, error) {
 		return nil, err
 	}
 
+	// keep the extra precision for files
+	// with more than 8 bits per sample
+	var m draw.Image
 	b := image.Rect(0, 0, d.w, d.h)
-	m := image.NewRGBA(b)
+	if d.maxval > 255 {
+		m = image.NewRGBA64(b)
+	} else {
+		m = image.NewRGBA(b)
+	}
 	for y := b.Min.Y; y < b.Max.Y; y++ {
 		for x := b.Min.X; x < b.Max.X; x++ {
 			m.Set(x, y, d.readColor())
@@ -43,8 +51,13 @@ func DecodeConfig(r io.Reader) (image.Config, error) {
 		return image.Config{}, err
 	}
 
+	model := color.RGBAModel
+	if d.maxval > 255 {
+		model = color.RGBA64Model
+	}
+
 	return image.Config{
-		ColorModel: color.RGBAModel,
+		ColorModel: model,
 		Width:      d.w,
 		Height:     d.h,
 	}, nil
@@ -150,60 +163,79 @@ func (d *decoder) readInt() int {
 	return n
 }
 
-func (d *decoder) readColor() color.RGBA {
+func (d *decoder) readColor() color.RGBA64 {
 	var (
-		c color.RGBA
-		y uint8
+		c [3]uint16
+		a uint16
 	)
 
 	if d.err != nil {
-		return c
+		return color.RGBA64{}
 	}
 
 	d.skipws()
 	switch d.format {
 	case 1, 2:
-		_, d.err = fmt.Fscanf(d.b, "%d", &y)
-		if d.format == 1 && y != 0 {
-			y = 255
+		_, d.err = fmt.Fscanf(d.b, "%d", &c[0])
+		if d.format == 1 && c[0] != 0 {
+			c[0] = uint16(d.maxval)
 		}
-		c = color.RGBA{y, y, y, 255}
+		c[1], c[2] = c[0], c[0]
+		a = 0xffff
 	case 3:
-		_, d.err = fmt.Fscanf(d.b, "%d %d %d", &c.R, &c.G, &c.B)
-		c.A = 255
+		_, d.err = fmt.Fscanf(d.b, "%d %d %d", &c[0], &c[1], &c[2])
+		a = 0xffff
 	case 4:
 		if d.bits == 0 {
 			d.err = binary.Read(d.b, binary.LittleEndian, &d.bw)
 			d.bits = 8
 		} else {
-			y := uint8(0)
 			if d.bw&(1<<(7-(d.bits-1))) != 0 {
-				y = 255
+				c = [3]uint16{uint16(d.maxval), uint16(d.maxval), uint16(d.maxval)}
 			}
-			c = color.RGBA{y, y, y, 255}
+			a = 0xffff
 			d.bits--
 		}
 	case 5:
-		d.err = binary.Read(d.b, binary.LittleEndian, &y)
-		c = color.RGBA{y, y, y, 255}
+		c[0] = d.readSample()
+		c[1], c[2] = c[0], c[0]
+		a = 0xffff
 	case 6:
-		var p [3]uint8
-		d.err = binary.Read(d.b, binary.LittleEndian, p)
-		c = color.RGBA{p[0], p[1], p[2], 255}
+		c[0] = d.readSample()
+		c[1] = d.readSample()
+		c[2] = d.readSample()
+		a = 0xffff
+	}
+
+	s := 0xffff / float64(d.maxval)
+	return color.RGBA64{
+		clamp16(float64(c[0]) * s),
+		clamp16(float64(c[1]) * s),
+		clamp16(float64(c[2]) * s),
+		a,
+	}
+}
+
+// readSample reads a binary sample, samples are two
+// bytes with the most significant byte first if the
+// maximum value does not fit in a byte
+func (d *decoder) readSample() uint16 {
+	if d.maxval > 255 {
+		var v uint16
+		d.err = binary.Read(d.b, binary.BigEndian, &v)
+		return v
 	}
 
-	s := 255 / float64(d.maxval)
-	cr := float64(c.R) * s
-	cg := float64(c.G) * s
-	cb := float64(c.B) * s
-	return color.RGBA{clamp(cr), clamp(cg), clamp(cb), c.A}
+	var v uint8
+	d.err = binary.Read(d.b, binary.LittleEndian, &v)
+	return uint16(v)
 }
 
-func clamp(x float64) uint8 {
-	if x > 255 {
-		return 255
+func clamp16(x float64) uint16 {
+	if x > 0xffff {
+		return 0xffff
 	}
-	return uint8(x)
+	return uint16(x + 0.5)
 }
 
 func init() {
@@ -213,4 +245,6 @@ func init() {
 	image.RegisterFormat("pbm", "P4", Decode, DecodeConfig)
 	image.RegisterFormat("pgm", "P5", Decode, DecodeConfig)
 	image.RegisterFormat("ppm", "P6", Decode, DecodeConfig)
+	image.RegisterFormat("pfm", "PF", DecodePFM, DecodePFMConfig)
+	image.RegisterFormat("pfm", "Pf", DecodePFM, DecodePFMConfig)
 }
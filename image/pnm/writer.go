@@ -11,6 +11,11 @@ import (
 
 type Options struct {
 	Format int
+
+	// maximum sample value for the formats that
+	// support it, zero means 255, binary formats
+	// use two bytes per sample if it is above 255
+	MaxVal int
 }
 
 func Encode(w io.Writer, m image.Image, o *Options) error {
@@ -18,73 +23,100 @@ func Encode(w io.Writer, m image.Image, o *Options) error {
 		o = &Options{Format: 3}
 	}
 
+	maxval := o.MaxVal
+	if maxval <= 0 {
+		maxval = 255
+	}
+	if maxval > 0xffff {
+		return ErrFormat
+	}
+
 	b := bufio.NewWriter(w)
 	r := m.Bounds()
 	bits := uint(0)
 	bw := uint8(0)
 
-	fmt.Fprintf(w, "P%d\n", o.Format)
-	fmt.Fprintf(w, "%d %d\n", r.Dx(), r.Dy())
+	fmt.Fprintf(b, "P%d\n", o.Format)
+	fmt.Fprintf(b, "%d %d\n", r.Dx(), r.Dy())
 	switch o.Format {
 	case 1, 4:
 	case 2, 3, 5, 6:
-		fmt.Fprintf(w, "255\n")
+		fmt.Fprintf(b, "%d\n", maxval)
 	default:
 		return ErrFormat
 	}
 
+	sample := func(v uint32) uint16 {
+		return uint16((uint64(v)*uint64(maxval) + 0x7fff) / 0xffff)
+	}
+	writeSample := func(v uint16) {
+		if maxval > 255 {
+			binary.Write(b, binary.BigEndian, v)
+		} else {
+			b.WriteByte(uint8(v))
+		}
+	}
+
 	for y := r.Min.Y; y < r.Max.Y; y++ {
 		for x := r.Min.X; x < r.Max.X; x++ {
 			p := m.At(x, y)
 			switch o.Format {
 			case 1, 2:
-				c := (color.GrayModel.Convert(p)).(color.Gray)
+				c := (color.Gray16Model.Convert(p)).(color.Gray16)
+				v := sample(uint32(c.Y))
 				if o.Format == 1 && c.Y != 0 {
-					c.Y = 1
+					v = 1
 				}
-				fmt.Fprintf(w, "%d ", c.Y)
+				fmt.Fprintf(b, "%d", v)
 
 			case 3:
-				c := color.RGBAModel.Convert(p).(color.RGBA)
-				fmt.Fprintf(w, "%d %d %d", c.R, c.G, c.B)
+				cr, cg, cb, _ := p.RGBA()
+				fmt.Fprintf(b, "%d %d %d", sample(cr), sample(cg), sample(cb))
 
 			case 4:
-				c := color.RGBAModel.Convert(p).(color.Gray)
+				c := color.GrayModel.Convert(p).(color.Gray)
 				if c.Y != 0 {
 					bw |= 1 << (7 - bits)
 				}
 
 				if bits++; bits == 8 {
-					binary.Write(w, binary.LittleEndian, bw)
+					b.WriteByte(bw)
 					bits = 0
 					bw = 0
 				}
 
 			case 5:
-				c := (color.GrayModel.Convert(p)).(color.Gray)
-				binary.Write(w, binary.LittleEndian, c.Y)
+				c := (color.Gray16Model.Convert(p)).(color.Gray16)
+				writeSample(sample(uint32(c.Y)))
 
 			case 6:
-				c := color.RGBAModel.Convert(p).(color.RGBA)
-				p := [3]uint8{c.R, c.G, c.B}
-				binary.Write(w, binary.LittleEndian, p)
+				cr, cg, cb, _ := p.RGBA()
+				writeSample(sample(cr))
+				writeSample(sample(cg))
+				writeSample(sample(cb))
 			}
 
-			if x+1 < r.Max.X {
-				fmt.Fprintf(w, " ")
+			switch o.Format {
+			case 1, 2, 3:
+				if x+1 < r.Max.X {
+					fmt.Fprintf(b, " ")
+				}
 			}
 		}
 
 		switch o.Format {
 		case 1, 2, 3:
-			fmt.Fprintf(w, "\n")
+			fmt.Fprintf(b, "\n")
+		case 4:
+			// rows are padded to a byte boundary
+			if bits != 0 {
+				b.WriteByte(bw)
+				bits = 0
+				bw = 0
+			}
 		}
 	}
 
-	if bits != 0 {
-		binary.Write(w, binary.LittleEndian, bw)
-	}
-
 	err := b.Flush()
 	if err != nil {
 		return fmt.Errorf("pnm: %v", err)
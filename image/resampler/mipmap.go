@@ -0,0 +1,242 @@
+package resampler
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	NPOT_KEEP = iota
+	NPOT_ROUND_UP
+	NPOT_ROUND_DOWN
+	NPOT_ROUND_NEAREST
+)
+
+type MipmapOptions struct {
+	// resampling options for each level, the boundary op
+	// should be wrap for tiling textures and clamp otherwise
+	Resample *Options
+
+	// how to handle the base level if it is not a power of two,
+	// keep halves each axis rounding down until it reaches one
+	NPOT int
+
+	// maximum number of levels to generate, including the
+	// base level, zero means generate all the way down to 1x1
+	Levels int
+
+	// if greater than zero, alpha is scaled on every level so
+	// the fraction of pixels passing an alpha test with this
+	// reference value is the same as the base level
+	AlphaCoverage float64
+
+	// treat the image as a tangent space normal map, the
+	// filtering is done in linear space with straight alpha
+	// and the normals are renormalized on every level
+	NormalMap bool
+}
+
+// Mipmap generates a mip chain for an image, each level is
+// resampled from the previous one
+func Mipmap(m image.Image, o *MipmapOptions) []*image.RGBA {
+	if o == nil {
+		o = &MipmapOptions{}
+	}
+
+	ro := defaultOptions()
+	if o.Resample != nil {
+		xo := *o.Resample
+		ro = &xo
+	}
+	if o.NormalMap {
+		ro.Transfer = TRANSFER_LINEAR
+		ro.AlphaOp = ALPHA_STRAIGHT
+	}
+
+	sr := m.Bounds()
+	size := image.Pt(roundNPOT(sr.Dx(), o.NPOT), roundNPOT(sr.Dy(), o.NPOT))
+	if size.X <= 0 || size.Y <= 0 {
+		return nil
+	}
+
+	base := image.NewRGBA(image.Rectangle{Max: size})
+	if size == sr.Size() {
+		draw.Draw(base, base.Bounds(), m, sr.Min, draw.Src)
+	} else {
+		NewResizer(size, sr.Size(), ro).Resize(m, base)
+	}
+	if o.NormalMap {
+		renormalize(base)
+	}
+
+	coverage := 0.0
+	if o.AlphaCoverage > 0 {
+		coverage = alphaCoverage(base, o.AlphaCoverage, 1)
+	}
+
+	levels := []*image.RGBA{base}
+	prev := base
+	for size.X > 1 || size.Y > 1 {
+		if o.Levels > 0 && len(levels) >= o.Levels {
+			break
+		}
+
+		size = image.Pt(max(size.X/2, 1), max(size.Y/2, 1))
+		p := image.NewRGBA(image.Rectangle{Max: size})
+		NewResizer(size, prev.Bounds().Size(), ro).Resize(prev, p)
+		if o.NormalMap {
+			renormalize(p)
+		}
+
+		// the next level is resampled from the unscaled level,
+		// otherwise the alpha scaling would compound
+		prev = p
+		if o.AlphaCoverage > 0 {
+			p = scaleAlphaCoverage(p, o.AlphaCoverage, coverage)
+		}
+		levels = append(levels, p)
+	}
+
+	return levels
+}
+
+// MipmapAtlas packs a mip chain into a single image, the base
+// level is on the left and the other levels are stacked from
+// top to bottom to the right of it, it returns the location of
+// each level inside the atlas
+func MipmapAtlas(levels []*image.RGBA) (*image.RGBA, []image.Rectangle) {
+	if len(levels) == 0 {
+		return image.NewRGBA(image.Rectangle{}), nil
+	}
+
+	b := levels[0].Bounds()
+	w, h := b.Dx(), b.Dy()
+	if len(levels) > 1 {
+		w += levels[1].Bounds().Dx()
+		sh := 0
+		for _, l := range levels[1:] {
+			sh += l.Bounds().Dy()
+		}
+		h = max(h, sh)
+	}
+
+	atlas := image.NewRGBA(image.Rect(0, 0, w, h))
+	rects := make([]image.Rectangle, len(levels))
+	pt := image.Point{}
+	for i, l := range levels {
+		lb := l.Bounds()
+		rects[i] = image.Rectangle{pt, pt.Add(lb.Size())}
+		draw.Draw(atlas, rects[i], l, lb.Min, draw.Src)
+
+		if i == 0 {
+			pt = image.Pt(lb.Dx(), 0)
+		} else {
+			pt.Y += lb.Dy()
+		}
+	}
+	return atlas, rects
+}
+
+func roundNPOT(n, op int) int {
+	if n <= 0 || n&(n-1) == 0 {
+		return n
+	}
+
+	lo := 1
+	for lo*2 <= n {
+		lo *= 2
+	}
+	hi := lo * 2
+
+	switch op {
+	case NPOT_ROUND_UP:
+		return hi
+	case NPOT_ROUND_DOWN:
+		return lo
+	case NPOT_ROUND_NEAREST:
+		if n-lo < hi-n {
+			return lo
+		}
+		return hi
+	}
+	return n
+}
+
+// renormalize decodes each pixel as a normal in [-1, 1],
+// normalizes it and encodes it back, the pixels are
+// premultiplied so the normal is decoded from the
+// straight color and premultiplied again after
+func renormalize(m *image.RGBA) {
+	for i := 0; i < len(m.Pix); i += 4 {
+		p := m.Pix[i : i+4 : i+4]
+		if p[3] == 0 {
+			continue
+		}
+		a := float64(p[3]) / 255
+		n := f64.Vec3{
+			float64(p[0])/255/a*2 - 1,
+			float64(p[1])/255/a*2 - 1,
+			float64(p[2])/255/a*2 - 1,
+		}
+		if n.LenSquared() == 0 {
+			n = f64.Vec3{0, 0, 1}
+		}
+		n = n.Normalize()
+		p[0] = q8((n.X*.5 + .5) * a)
+		p[1] = q8((n.Y*.5 + .5) * a)
+		p[2] = q8((n.Z*.5 + .5) * a)
+	}
+}
+
+// alphaCoverage returns the fraction of pixels that pass
+// an alpha test against ref with alpha scaled by scale
+func alphaCoverage(m *image.RGBA, ref, scale float64) float64 {
+	n := 0
+	for i := 3; i < len(m.Pix); i += 4 {
+		if float64(m.Pix[i])/255*scale > ref {
+			n++
+		}
+	}
+	return float64(n) / float64(len(m.Pix)/4)
+}
+
+// scaleAlphaCoverage searches for an alpha scale so the
+// coverage of the image matches the target coverage and
+// returns a copy of the image with the scaled alpha
+func scaleAlphaCoverage(m *image.RGBA, ref, coverage float64) *image.RGBA {
+	lo, hi := 0.0, 4.0
+	scale := 1.0
+	for i := 0; i < 16; i++ {
+		c := alphaCoverage(m, ref, scale)
+		if math.Abs(c-coverage) < 1e-3 {
+			break
+		}
+		if c < coverage {
+			lo = scale
+		} else {
+			hi = scale
+		}
+		scale = (lo + hi) / 2
+	}
+
+	p := image.NewRGBA(m.Bounds())
+	copy(p.Pix, m.Pix)
+	for i := 0; i < len(p.Pix); i += 4 {
+		a := float64(p.Pix[i+3]) / 255
+		if a == 0 {
+			continue
+		}
+
+		// keep the straight color the same
+		na := f64.Clamp(a*scale, 0, 1)
+		for j := 0; j < 3; j++ {
+			c := float64(p.Pix[i+j]) / 255 / a
+			p.Pix[i+j] = q8(f64.Clamp(c, 0, 1) * na)
+		}
+		p.Pix[i+3] = q8(na)
+	}
+	return p
+}
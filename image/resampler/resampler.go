@@ -24,6 +24,17 @@ const (
 	BOUNDARY_CLAMP
 )
 
+const (
+	TRANSFER_SRGB = iota
+	TRANSFER_LINEAR
+	TRANSFER_GAMMA
+)
+
+const (
+	ALPHA_PREMULTIPLIED = iota
+	ALPHA_STRAIGHT
+)
+
 type contrib struct {
 	Pixel  int
 	Weight float64
@@ -45,6 +56,21 @@ type Options struct {
 	SampleRange f64.Vec2
 	FilterScale f64.Vec2
 	SourceOff   f64.Vec2
+
+	// transfer function used by the image resizer to convert
+	// to linear space before filtering, Gamma is the exponent
+	// used when it is set to TRANSFER_GAMMA
+	Transfer int
+	Gamma    float64
+
+	// whether the image resizer filters colors premultiplied
+	// by alpha or not, straight alpha bleeds the color of fully
+	// transparent pixels into their neighbors
+	AlphaOp int
+
+	// number of goroutines used by the image resizer,
+	// zero means use GOMAXPROCS
+	Workers int
 }
 
 type Resampler struct {
@@ -62,15 +88,21 @@ type Resampler struct {
 	sn, sc        image.Point
 }
 
+func defaultOptions() *Options {
+	return &Options{
+		BoundaryOp:  BOUNDARY_CLAMP,
+		Filter:      GetFilter("blackman"),
+		SampleRange: f64.Vec2{0, 1},
+		FilterScale: f64.Vec2{1, 1},
+		SourceOff:   f64.Vec2{0, 0},
+		Transfer:    TRANSFER_SRGB,
+		AlphaOp:     ALPHA_PREMULTIPLIED,
+	}
+}
+
 func New(dn, sn image.Point, opt *Options) *Resampler {
 	if opt == nil {
-		opt = &Options{
-			BoundaryOp:  BOUNDARY_CLAMP,
-			Filter:      GetFilter("blackman"),
-			SampleRange: f64.Vec2{0, 1},
-			FilterScale: f64.Vec2{1, 1},
-			SourceOff:   f64.Vec2{0, 0},
-		}
+		opt = defaultOptions()
 	}
 
 	r := &Resampler{
@@ -79,8 +111,8 @@ func New(dn, sn image.Point, opt *Options) *Resampler {
 		sn:      sn,
 		samples: make([]float64, dn.X),
 	}
-	r.pcx = r.makeList(dn.X, sn.X, opt.FilterScale.X, opt.SourceOff.X)
-	r.pcy = r.makeList(dn.Y, sn.Y, opt.FilterScale.Y, opt.SourceOff.Y)
+	r.pcx = makeList(dn.X, sn.X, opt.FilterScale.X, opt.SourceOff.X, opt)
+	r.pcy = makeList(dn.Y, sn.Y, opt.FilterScale.Y, opt.SourceOff.Y, opt)
 
 	r.ycount = make([]int, sn.Y)
 	r.yflag = make([]bool, sn.Y)
@@ -147,7 +179,7 @@ func (r *Resampler) Restart() {
 // reflect ensures that contributing sample
 // is within bounds, if not, clamp/wrap/reflect
 // based on op
-func (r *Resampler) reflect(x, w, op int) int {
+func reflect(x, w, op int) int {
 	var n int
 	switch {
 	case x < 0:
@@ -185,10 +217,10 @@ func (r *Resampler) reflect(x, w, op int) int {
 // makeList generates, for all destination samples,
 // the list of all source samples with non-zero
 // weighted contributions
-func (r *Resampler) makeList(dn, sn int, filterScale float64, sourceOff float64) [][]contrib {
+func makeList(dn, sn int, filterScale float64, sourceOff float64, opt *Options) [][]contrib {
 	const NUDGE = 0.5
 
-	filter := r.opt.Filter
+	filter := opt.Filter
 	contribs := make([][]contrib, dn)
 	contribBounds := make([]contribBound, dn)
 
@@ -243,7 +275,7 @@ func (r *Resampler) makeList(dn, sn int, filterScale float64, sourceOff float64)
 			if weight == 0 {
 				continue
 			}
-			contribs[i][index].Pixel = r.reflect(j, sn, r.opt.BoundaryOp)
+			contribs[i][index].Pixel = reflect(j, sn, opt.BoundaryOp)
 			contribs[i][index].Weight = weight
 
 			// increment the number of source samples which
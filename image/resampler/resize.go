@@ -4,86 +4,427 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"math"
 
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/image/imageutil"
+	"github.com/qeedquan/go-media/image/internal/parallel"
 	"github.com/qeedquan/go-media/math/f64"
 )
 
-var (
-	srgb   [256]float64
-	linear [4096]uint8
-)
+// Resizer resizes images of one size to another, the contributor
+// lists and scratch buffers are kept around so resizing many images
+// of the same size does not have to recompute or reallocate them.
+// A Resizer is not safe to use from multiple goroutines at once,
+// but it uses multiple goroutines internally.
+type Resizer struct {
+	converter
+	opt      *Options
+	dn, sn   image.Point
+	pcx, pcy [][]contrib
+	rows     []bool
+	tmp      []float64
+	bufs     [][]float64
+}
 
-func init() {
-	const gamma = 1.75
-	for i := range srgb {
-		srgb[i] = math.Pow(float64(i)/255, gamma)
+func NewResizer(dn, sn image.Point, opt *Options) *Resizer {
+	if opt == nil {
+		opt = defaultOptions()
 	}
+	z := &Resizer{
+		converter: newConverter(opt),
+		opt:       opt,
+	}
+	z.setup(dn, sn)
+	return z
+}
 
-	for i := range linear {
-		k := 255*math.Pow(float64(i)/float64(len(linear)), 1/gamma) + .5
-		k = f64.Clamp(k, 0, 255)
-		linear[i] = uint8(k)
+func (z *Resizer) setup(dn, sn image.Point) {
+	z.dn = dn
+	z.sn = sn
+	z.pcx = makeList(dn.X, sn.X, z.opt.FilterScale.X, z.opt.SourceOff.X, z.opt)
+	z.pcy = makeList(dn.Y, sn.Y, z.opt.FilterScale.Y, z.opt.SourceOff.Y, z.opt)
+
+	// mark the source lines that contribute to any
+	// destination line so the rest can be skipped
+	z.rows = make([]bool, sn.Y)
+	for i := range z.pcy {
+		for _, c := range z.pcy[i] {
+			z.rows[c.Pixel] = true
+		}
 	}
+
+	z.tmp = make([]float64, sn.Y*dn.X*4)
+	z.bufs = z.bufs[:0]
 }
 
 func ResizeImage(m image.Image, p draw.Image, o *Options) {
-	var (
-		resamplers [4]*Resampler
-		samples    [4][]float64
-	)
+	sr := m.Bounds()
 	dr := p.Bounds()
+	z := NewResizer(dr.Size(), sr.Size(), o)
+	z.Resize(m, p)
+}
+
+// ResizeYCbCr is like ResizeImage but for a YCbCr destination,
+// subsampled chroma samples are taken from the first pixel of
+// the block they cover
+func ResizeYCbCr(m image.Image, p *image.YCbCr, o *Options) {
 	sr := m.Bounds()
-	sn := image.Pt(sr.Dx(), sr.Dy())
-	dn := image.Pt(dr.Dx(), dr.Dy())
-	for i := range resamplers {
-		resamplers[i] = New(dn, sn, o)
-		samples[i] = make([]float64, sn.X)
-	}
-
-	dy := 0
-	for y := sr.Min.Y; y < sr.Max.Y; y++ {
-		for x := sr.Min.X; x < sr.Max.X; x++ {
-			c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
-			samples[0][x] = srgb[c.R]
-			samples[1][x] = srgb[c.G]
-			samples[2][x] = srgb[c.B]
-			samples[3][x] = float64(c.A) / 255
-		}
-
-		for i, rp := range resamplers {
-			rp.PutLine(samples[i])
-		}
-
-	loop:
-		for ; ; dy++ {
-			var out [4][]float64
-			for i := range resamplers {
-				out[i] = resamplers[i].GetLine()
-				if out[i] == nil {
-					break loop
-				}
+	dr := p.Bounds()
+	z := NewResizer(dr.Size(), sr.Size(), o)
+	z.ResizeYCbCr(m, p)
+}
+
+// ResizeFloat is like ResizeImage but writes to a float image,
+// the output is not quantized and is premultiplied in the
+// 0-255 range like the rest of the float images
+func ResizeFloat(m image.Image, p *imageutil.Float, o *Options) {
+	sr := m.Bounds()
+	dr := p.Bounds()
+	z := NewResizer(dr.Size(), sr.Size(), o)
+	z.ResizeFloat(m, p)
+}
+
+func (z *Resizer) Resize(m image.Image, p draw.Image) {
+	z.resize(m, p)
+}
+
+func (z *Resizer) ResizeYCbCr(m image.Image, p *image.YCbCr) {
+	z.resize(m, p)
+}
+
+func (z *Resizer) ResizeFloat(m image.Image, p *imageutil.Float) {
+	z.resize(m, p)
+}
+
+type bounder interface {
+	Bounds() image.Rectangle
+}
+
+// resize does the x axis convolution for all source lines into
+// a intermediate buffer, then does the y axis convolution for
+// all destination lines, both passes are split into bands of
+// lines that are processed in parallel
+func (z *Resizer) resize(m image.Image, p bounder) {
+	sr := m.Bounds()
+	dr := p.Bounds()
+	if sr.Size() != z.sn || dr.Size() != z.dn {
+		z.setup(dr.Size(), sr.Size())
+	}
+	if z.dn.X <= 0 || z.dn.Y <= 0 || z.sn.X <= 0 || z.sn.Y <= 0 {
+		return
+	}
+
+	nw := parallel.Workers(z.opt.Workers)
+	for len(z.bufs) < nw {
+		z.bufs = append(z.bufs, make([]float64, max(z.sn.X, z.dn.X)*4))
+	}
+
+	stride := z.dn.X * 4
+	parallel.Lines(z.sn.Y, nw, func(w, lo, hi int) {
+		buf := z.bufs[w]
+		for y := lo; y < hi; y++ {
+			if z.rows[y] {
+				z.readLine(m, sr.Min.X, sr.Min.Y+y, buf[:z.sn.X*4])
+				z.resampleX(z.tmp[y*stride:(y+1)*stride], buf)
 			}
+		}
+	})
+
+	parallel.Lines(z.dn.Y, nw, func(w, lo, hi int) {
+		buf := z.bufs[w][:stride]
+		for y := lo; y < hi; y++ {
+			z.resampleY(buf, y, stride)
+			z.writeLine(p, dr.Min.X, dr.Min.Y+y, buf)
+		}
+	})
+}
+
+func (z *Resizer) resampleX(dst, src []float64) {
+	for i, pc := range z.pcx {
+		var r, g, b, a float64
+		for _, c := range pc {
+			s := src[c.Pixel*4 : c.Pixel*4+4]
+			r += s[0] * c.Weight
+			g += s[1] * c.Weight
+			b += s[2] * c.Weight
+			a += s[3] * c.Weight
+		}
+		d := dst[i*4 : i*4+4]
+		d[0], d[1], d[2], d[3] = r, g, b, a
+	}
+}
+
+func (z *Resizer) resampleY(dst []float64, y, stride int) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	for _, c := range z.pcy[y] {
+		src := z.tmp[c.Pixel*stride : (c.Pixel+1)*stride]
+		for i := range dst {
+			dst[i] += src[i] * c.Weight
+		}
+	}
+
+	lo := z.opt.SampleRange.X
+	hi := z.opt.SampleRange.Y
+	if lo < hi {
+		for i := range dst {
+			dst[i] = f64.Clamp(dst[i], lo, hi)
+		}
+	}
+}
+
+// converter converts pixels between the image types and the
+// linear samples that are filtered
+type converter struct {
+	tf     *transfer
+	premul bool
+}
+
+func newConverter(o *Options) converter {
+	return converter{
+		tf:     getTransfer(o),
+		premul: o.AlphaOp == ALPHA_PREMULTIPLIED,
+	}
+}
+
+// readLine converts a line of the source image into linear samples,
+// the common image types are read directly to avoid going
+// through the color interfaces
+func (cv *converter) readLine(m image.Image, x0, y int, dst []float64) {
+	switch m := m.(type) {
+	case *image.RGBA:
+		i := m.PixOffset(x0, y)
+		pix := m.Pix[i : i+len(dst)]
+		for x := 0; x < len(dst); x += 4 {
+			cv.load8(dst[x:], pix[x], pix[x+1], pix[x+2], pix[x+3], true)
+		}
+
+	case *image.NRGBA:
+		i := m.PixOffset(x0, y)
+		pix := m.Pix[i : i+len(dst)]
+		for x := 0; x < len(dst); x += 4 {
+			cv.load8(dst[x:], pix[x], pix[x+1], pix[x+2], pix[x+3], false)
+		}
 
-			for dx := 0; dx < dn.X; dx++ {
-				c := color.RGBA{
-					linear2srgb(out[0][dx]),
-					linear2srgb(out[1][dx]),
-					linear2srgb(out[2][dx]),
-					linear2alpha(out[3][dx]),
-				}
-				p.Set(dx, dy, c)
+	case *image.RGBA64:
+		i := m.PixOffset(x0, y)
+		pix := m.Pix[i : i+len(dst)*2]
+		for x := 0; x < len(dst); x += 4 {
+			r, g, b, a := load16(pix[x*2:])
+			cv.load(dst[x:], r, g, b, a, true)
+		}
+
+	case *image.NRGBA64:
+		i := m.PixOffset(x0, y)
+		pix := m.Pix[i : i+len(dst)*2]
+		for x := 0; x < len(dst); x += 4 {
+			r, g, b, a := load16(pix[x*2:])
+			cv.load(dst[x:], r, g, b, a, false)
+		}
+
+	case *image.Gray:
+		i := m.PixOffset(x0, y)
+		pix := m.Pix[i : i+len(dst)/4]
+		for x, v := range pix {
+			cv.load8(dst[x*4:], v, v, v, 0xff, false)
+		}
+
+	case *image.YCbCr:
+		for x := 0; x < len(dst)/4; x++ {
+			yi := m.YOffset(x0+x, y)
+			ci := m.COffset(x0+x, y)
+			c := color.YCbCr{m.Y[yi], m.Cb[ci], m.Cr[ci]}
+			r, g, b, _ := c.RGBA()
+			cv.load(dst[x*4:], r, g, b, 0xffff, false)
+		}
+
+	default:
+		for x := 0; x < len(dst)/4; x++ {
+			r, g, b, a := m.At(x0+x, y).RGBA()
+			cv.load(dst[x*4:], r, g, b, a, true)
+		}
+	}
+}
+
+// writeLine converts linear samples back and stores them in the
+// destination, for image types without a fast path Set is called
+// concurrently on different pixels
+func (cv *converter) writeLine(p bounder, x0, y int, src []float64) {
+	switch p := p.(type) {
+	case *image.RGBA:
+		i := p.PixOffset(x0, y)
+		pix := p.Pix[i : i+len(src)]
+		for x := 0; x < len(src); x += 4 {
+			c := cv.rgba(src[x:])
+			pix[x], pix[x+1], pix[x+2], pix[x+3] = c.R, c.G, c.B, c.A
+		}
+
+	case *image.NRGBA:
+		i := p.PixOffset(x0, y)
+		pix := p.Pix[i : i+len(src)]
+		for x := 0; x < len(src); x += 4 {
+			r, g, b, a := cv.unload(src[x:], false)
+			pix[x], pix[x+1], pix[x+2], pix[x+3] = q8(r), q8(g), q8(b), q8(a)
+		}
+
+	case *image.RGBA64:
+		i := p.PixOffset(x0, y)
+		pix := p.Pix[i : i+len(src)*2]
+		for x := 0; x < len(src); x += 4 {
+			c := cv.rgba64(src[x:])
+			store16(pix[x*2:], uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A))
+		}
+
+	case *image.NRGBA64:
+		i := p.PixOffset(x0, y)
+		pix := p.Pix[i : i+len(src)*2]
+		for x := 0; x < len(src); x += 4 {
+			r, g, b, a := cv.unload(src[x:], true)
+			store16(pix[x*2:], q16(r), q16(g), q16(b), q16(a))
+		}
+
+	case *image.Gray:
+		i := p.PixOffset(x0, y)
+		pix := p.Pix[i : i+len(src)/4]
+		for x := range pix {
+			r, g, b, _ := cv.rgba(src[x*4:]).RGBA()
+			pix[x] = uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+		}
+
+	case *image.YCbCr:
+		for x := 0; x < len(src)/4; x++ {
+			c := cv.rgba(src[x*4:])
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+
+			px := x0 + x
+			p.Y[p.YOffset(px, y)] = yy
+
+			// only the first pixel in a chroma block writes to it,
+			// so bands running in parallel never touch the same sample
+			ci := p.COffset(px, y)
+			if (px == p.Rect.Min.X || ci != p.COffset(px-1, y)) &&
+				(y == p.Rect.Min.Y || ci != p.COffset(px, y-1)) {
+				p.Cb[ci] = cb
+				p.Cr[ci] = cr
 			}
 		}
+
+	case *imageutil.Float:
+		i := (y-p.Rect.Min.Y)*p.Stride + (x0 - p.Rect.Min.X)
+		pix := p.Pix[i : i+len(src)/4]
+		for x := range pix {
+			r, g, b, a := cv.unload(src[x*4:], true)
+			pix[x] = chroma.Float4{r * a * 255, g * a * 255, b * a * 255, a * 255}
+		}
+
+	case draw.Image:
+		for x := 0; x < len(src)/4; x++ {
+			p.Set(x0+x, y, cv.rgba64(src[x*4:]))
+		}
 	}
 }
 
-func linear2srgb(x float64) uint8 {
-	i := float64(len(linear))*x + .5
-	i = f64.Clamp(i, 0, float64(len(linear)-1))
-	return linear[int(i)]
+func (cv *converter) load8(dst []float64, r, g, b, a uint8, premul bool) {
+	if premul && a != 0xff {
+		cv.load(dst, uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101, uint32(a)*0x101, true)
+		return
+	}
+
+	t := cv.tf
+	af := float64(a) / 0xff
+	lr, lg, lb := t.dec8[r], t.dec8[g], t.dec8[b]
+	if cv.premul {
+		lr, lg, lb = lr*af, lg*af, lb*af
+	}
+	dst[0], dst[1], dst[2], dst[3] = lr, lg, lb, af
+}
+
+// load decodes a 16 bit color into linear samples, if the
+// color is premultiplied, it is divided out first since the
+// transfer function is applied to the straight color
+func (cv *converter) load(dst []float64, r, g, b, a uint32, premul bool) {
+	if premul && a != 0xffff {
+		if a == 0 {
+			r, g, b = 0, 0, 0
+		} else {
+			r = min32(r*0xffff/a, 0xffff)
+			g = min32(g*0xffff/a, 0xffff)
+			b = min32(b*0xffff/a, 0xffff)
+		}
+	}
+
+	t := cv.tf
+	af := float64(a) / 0xffff
+	lr, lg, lb := t.decode16(r), t.decode16(g), t.decode16(b)
+	if cv.premul {
+		lr, lg, lb = lr*af, lg*af, lb*af
+	}
+	dst[0], dst[1], dst[2], dst[3] = lr, lg, lb, af
+}
+
+// unload converts linear samples to a straight encoded color,
+// exact uses the transfer function instead of the table
+func (cv *converter) unload(s []float64, exact bool) (r, g, b, a float64) {
+	r, g, b = s[0], s[1], s[2]
+	a = f64.Clamp(s[3], 0, 1)
+	if cv.premul {
+		if a == 0 {
+			return 0, 0, 0, 0
+		}
+		r, g, b = r/a, g/a, b/a
+	}
+
+	t := cv.tf
+	if exact {
+		r, g, b = t.encode(r), t.encode(g), t.encode(b)
+	} else {
+		r, g, b = t.encode8(r), t.encode8(g), t.encode8(b)
+	}
+	return
 }
 
-func linear2alpha(x float64) uint8 {
-	return uint8(f64.Clamp(255*x+.5, 0, 255))
+func (cv *converter) rgba(s []float64) color.RGBA {
+	r, g, b, a := cv.unload(s, false)
+	return color.RGBA{q8(r * a), q8(g * a), q8(b * a), q8(a)}
+}
+
+func (cv *converter) rgba64(s []float64) color.RGBA64 {
+	r, g, b, a := cv.unload(s, true)
+	return color.RGBA64{
+		uint16(q16(r * a)),
+		uint16(q16(g * a)),
+		uint16(q16(b * a)),
+		uint16(q16(a)),
+	}
+}
+
+func load16(p []uint8) (r, g, b, a uint32) {
+	r = uint32(p[0])<<8 | uint32(p[1])
+	g = uint32(p[2])<<8 | uint32(p[3])
+	b = uint32(p[4])<<8 | uint32(p[5])
+	a = uint32(p[6])<<8 | uint32(p[7])
+	return
+}
+
+func store16(p []uint8, r, g, b, a uint32) {
+	p[0], p[1] = uint8(r>>8), uint8(r)
+	p[2], p[3] = uint8(g>>8), uint8(g)
+	p[4], p[5] = uint8(b>>8), uint8(b)
+	p[6], p[7] = uint8(a>>8), uint8(a)
+}
+
+func q8(x float64) uint8 {
+	return uint8(f64.Clamp(x*0xff+.5, 0, 0xff))
+}
+
+func q16(x float64) uint32 {
+	return uint32(f64.Clamp(x*0xffff+.5, 0, 0xffff))
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
 }
@@ -0,0 +1,88 @@
+package resampler
+
+import (
+	"math"
+
+	"github.com/qeedquan/go-media/image/chroma"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// transfer converts between encoded values and linear light,
+// the tables speed up the common 8 bit conversions while
+// the functions are used when precision matters
+type transfer struct {
+	dec8   [256]float64
+	enc    [4097]float64
+	decode func(float64) float64
+	encode func(float64) float64
+}
+
+var (
+	srgbTransfer   = newTransfer(chroma.SRGB2Linear, chroma.Linear2SRGB)
+	linearTransfer = newTransfer(identity, identity)
+)
+
+func newTransfer(decode, encode func(float64) float64) *transfer {
+	t := &transfer{
+		decode: decode,
+		encode: encode,
+	}
+	for i := range t.dec8 {
+		t.dec8[i] = decode(float64(i) / 255)
+	}
+	for i := range t.enc {
+		t.enc[i] = encode(float64(i) / float64(len(t.enc)-1))
+	}
+	return t
+}
+
+func getTransfer(o *Options) *transfer {
+	switch o.Transfer {
+	case TRANSFER_LINEAR:
+		return linearTransfer
+	case TRANSFER_GAMMA:
+		g := o.Gamma
+		if g <= 0 {
+			g = 1
+		}
+		return newTransfer(
+			func(x float64) float64 { return spow(x, g) },
+			func(x float64) float64 { return spow(x, 1/g) },
+		)
+	}
+	return srgbTransfer
+}
+
+// decode16 decodes a 16 bit value, values that came from
+// a 8 bit value can use the table
+func (t *transfer) decode16(x uint32) float64 {
+	if x>>8 == x&0xff {
+		return t.dec8[x>>8]
+	}
+	return t.decode(float64(x) / 0xffff)
+}
+
+// encode8 approximates the encoding function by interpolating
+// the table, good enough for 8 bit output
+func (t *transfer) encode8(x float64) float64 {
+	n := float64(len(t.enc) - 1)
+	x = f64.Clamp(x, 0, 1) * n
+	i := int(x)
+	if i >= len(t.enc)-1 {
+		return t.enc[len(t.enc)-1]
+	}
+	return f64.Lerp(x-float64(i), t.enc[i], t.enc[i+1])
+}
+
+func identity(x float64) float64 {
+	return x
+}
+
+// spow is a power function that preserves the sign
+// so filter ringing below zero does not produce NaN
+func spow(x, y float64) float64 {
+	if x < 0 {
+		return -math.Pow(-x, y)
+	}
+	return math.Pow(x, y)
+}
@@ -0,0 +1,387 @@
+package resampler
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/qeedquan/go-media/image/internal/parallel"
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+const (
+	WARP_SEPARABLE = iota
+	WARP_EWA
+)
+
+// the largest footprint a destination pixel can have in the
+// source, limits the cost of extreme minification like the
+// horizon of a perspective transform
+const maxFootprint = 32
+
+// InverseMap maps the center of a destination pixel to a
+// position in the source image, both in image coordinates,
+// returning false means the destination pixel has no source
+type InverseMap func(p f64.Vec2) (f64.Vec2, bool)
+
+type WarpOptions struct {
+	Options
+
+	// how the filter footprint is computed, separable uses a
+	// axis aligned box around the footprint while ewa uses an
+	// elliptical weighted average that handles rotations and
+	// anisotropy better at a higher cost
+	Method int
+
+	// destination pixels that map outside of the source
+	// are transparent instead of using the boundary op
+	Clip bool
+}
+
+type warper struct {
+	converter
+	opt *WarpOptions
+	src []float32
+	sr  image.Rectangle
+}
+
+// WarpTransform warps the source into the destination using
+// a affine or perspective transform that maps source coordinates
+// to destination coordinates, the transform has to be invertible
+func WarpTransform(m image.Image, p draw.Image, xf *f64.Mat3, o *WarpOptions) error {
+	inv := *xf
+	det := inv.Det()
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return errors.New("resampler: singular transform")
+	}
+	inv.Inverse()
+	Warp(m, p, TransformMap(&inv), o)
+	return nil
+}
+
+// TransformMap returns an inverse map for a transform that maps
+// destination coordinates to source coordinates
+func TransformMap(xf *f64.Mat3) InverseMap {
+	t := *xf
+	return func(p f64.Vec2) (f64.Vec2, bool) {
+		q := t.Transform(f64.Vec3{p.X, p.Y, 1})
+		// points at or behind the horizon of a perspective
+		// transform do not map back into the source
+		if q.Z <= 0 {
+			return f64.Vec2{}, false
+		}
+		return f64.Vec2{q.X / q.Z, q.Y / q.Z}, true
+	}
+}
+
+// Warp warps the source into the destination by sampling the
+// source at the locations given by the inverse map, the filter
+// is scaled by the local derivatives of the map so minified
+// areas are properly filtered
+func Warp(m image.Image, p draw.Image, f InverseMap, o *WarpOptions) {
+	if o == nil {
+		o = &WarpOptions{
+			Options: *defaultOptions(),
+			Method:  WARP_SEPARABLE,
+			Clip:    true,
+		}
+	}
+
+	w := &warper{
+		converter: newConverter(&o.Options),
+		opt:       o,
+		sr:        m.Bounds(),
+	}
+	dr := p.Bounds()
+	sn := w.sr.Size()
+	if sn.X <= 0 || sn.Y <= 0 || dr.Empty() {
+		return
+	}
+
+	nw := parallel.Workers(o.Workers)
+	w.src = make([]float32, sn.X*sn.Y*4)
+	bufs := make([][]float64, nw)
+	for i := range bufs {
+		bufs[i] = make([]float64, max(sn.X, dr.Dx())*4)
+	}
+
+	parallel.Lines(sn.Y, nw, func(n, lo, hi int) {
+		buf := bufs[n][:sn.X*4]
+		for y := lo; y < hi; y++ {
+			w.readLine(m, w.sr.Min.X, w.sr.Min.Y+y, buf)
+			dst := w.src[y*sn.X*4 : (y+1)*sn.X*4]
+			for i := range dst {
+				dst[i] = float32(buf[i])
+			}
+		}
+	})
+
+	parallel.Lines(dr.Dy(), nw, func(n, lo, hi int) {
+		buf := bufs[n][:dr.Dx()*4]
+		var wx, wy []float64
+		for y := dr.Min.Y + lo; y < dr.Min.Y+hi; y++ {
+			for x := dr.Min.X; x < dr.Max.X; x++ {
+				s := buf[(x-dr.Min.X)*4 : (x-dr.Min.X)*4+4]
+				wx, wy = w.sample(s, f, f64.Vec2{float64(x) + .5, float64(y) + .5}, wx, wy)
+			}
+			w.writeLine(p, dr.Min.X, y, buf)
+		}
+	})
+}
+
+// sample computes a destination pixel at q, wx and wy are
+// scratch buffers for the separable weights
+func (w *warper) sample(s []float64, f InverseMap, q f64.Vec2, wx, wy []float64) ([]float64, []float64) {
+	for i := range s {
+		s[i] = 0
+	}
+
+	c, ok := f(q)
+	if !ok {
+		return wx, wy
+	}
+
+	// source position relative to the source buffer
+	c = c.Sub(f64.Vec2{float64(w.sr.Min.X), float64(w.sr.Min.Y)})
+	sn := w.sr.Size()
+	if w.opt.Clip && !(c.X >= 0 && c.Y >= 0 && c.X < float64(sn.X) && c.Y < float64(sn.Y)) {
+		return wx, wy
+	}
+
+	// estimate the footprint of the destination pixel in the
+	// source with the jacobian of the map, M = J*J^T
+	J := [2][2]float64{{1, 0}, {0, 1}}
+	if a, ok := f(q.Add(f64.Vec2{1, 0})); ok {
+		J[0][0] = a.X - c.X - float64(w.sr.Min.X)
+		J[1][0] = a.Y - c.Y - float64(w.sr.Min.Y)
+	}
+	if b, ok := f(q.Add(f64.Vec2{0, 1})); ok {
+		J[0][1] = b.X - c.X - float64(w.sr.Min.X)
+		J[1][1] = b.Y - c.Y - float64(w.sr.Min.Y)
+	}
+	mxx := J[0][0]*J[0][0] + J[0][1]*J[0][1]
+	mxy := J[0][0]*J[1][0] + J[0][1]*J[1][1]
+	myy := J[1][0]*J[1][0] + J[1][1]*J[1][1]
+
+	filter := w.opt.Filter
+	fs := w.opt.FilterScale.X
+	if fs <= 0 {
+		fs = 1
+	}
+	support := filter.Support * fs
+
+	var total float64
+	if w.opt.Method == WARP_EWA {
+		mxx, mxy, myy = clampFootprint(mxx, mxy, myy)
+		det := mxx*myy - mxy*mxy
+		qa, qb, qc := myy/det, -mxy/det, mxx/det
+
+		ex := support * math.Sqrt(mxx)
+		ey := support * math.Sqrt(myy)
+		x0, x1 := int(math.Floor(c.X-.5-ex)), int(math.Ceil(c.X-.5+ex))
+		y0, y1 := int(math.Floor(c.Y-.5-ey)), int(math.Ceil(c.Y-.5+ey))
+		for j := y0; j <= y1; j++ {
+			dy := float64(j) + .5 - c.Y
+			for i := x0; i <= x1; i++ {
+				dx := float64(i) + .5 - c.X
+				r2 := qa*dx*dx + 2*qb*dx*dy + qc*dy*dy
+				if r2 >= support*support {
+					continue
+				}
+				wt := filter.Sample(math.Sqrt(r2) / fs)
+				if wt != 0 {
+					w.accumulate(s, i, j, wt)
+					total += wt
+				}
+			}
+		}
+	} else {
+		sx := f64.Clamp(math.Sqrt(mxx), 1, maxFootprint)
+		sy := f64.Clamp(math.Sqrt(myy), 1, maxFootprint)
+		ex := support * sx
+		ey := support * sy
+		x0, x1 := int(math.Floor(c.X-.5-ex)), int(math.Ceil(c.X-.5+ex))
+		y0, y1 := int(math.Floor(c.Y-.5-ey)), int(math.Ceil(c.Y-.5+ey))
+
+		wx = wx[:0]
+		for i := x0; i <= x1; i++ {
+			wx = append(wx, filter.Sample((float64(i)+.5-c.X)/(sx*fs)))
+		}
+		wy = wy[:0]
+		for j := y0; j <= y1; j++ {
+			wy = append(wy, filter.Sample((float64(j)+.5-c.Y)/(sy*fs)))
+		}
+
+		for j := y0; j <= y1; j++ {
+			if wy[j-y0] == 0 {
+				continue
+			}
+			for i := x0; i <= x1; i++ {
+				wt := wx[i-x0] * wy[j-y0]
+				if wt != 0 {
+					w.accumulate(s, i, j, wt)
+					total += wt
+				}
+			}
+		}
+	}
+
+	// the footprint can miss every tap with a
+	// non-zero weight, use the nearest sample then
+	if math.Abs(total) < 1e-8 {
+		for i := range s {
+			s[i] = 0
+		}
+		w.accumulate(s, int(math.Floor(c.X)), int(math.Floor(c.Y)), 1)
+		total = 1
+	}
+
+	lo := w.opt.SampleRange.X
+	hi := w.opt.SampleRange.Y
+	for i := range s {
+		s[i] /= total
+		if lo < hi {
+			s[i] = f64.Clamp(s[i], lo, hi)
+		}
+	}
+	return wx, wy
+}
+
+func (w *warper) accumulate(s []float64, x, y int, wt float64) {
+	sn := w.sr.Size()
+	x = reflect(x, sn.X, w.opt.BoundaryOp)
+	y = reflect(y, sn.Y, w.opt.BoundaryOp)
+	p := w.src[(y*sn.X+x)*4:]
+	s[0] += float64(p[0]) * wt
+	s[1] += float64(p[1]) * wt
+	s[2] += float64(p[2]) * wt
+	s[3] += float64(p[3]) * wt
+}
+
+// clampFootprint clamps the axes of the footprint ellipse so it
+// covers at least one source pixel and at most maxFootprint
+func clampFootprint(mxx, mxy, myy float64) (float64, float64, float64) {
+	tr := mxx + myy
+	det := mxx*myy - mxy*mxy
+	d := math.Sqrt(math.Max(tr*tr/4-det, 0))
+	l1 := tr/2 + d
+	l2 := tr/2 - d
+
+	// eigenvector of the largest eigenvalue
+	e := f64.Vec2{1, 0}
+	switch {
+	case mxy != 0:
+		e = f64.Vec2{l1 - myy, mxy}.Normalize()
+	case myy > mxx:
+		e = f64.Vec2{0, 1}
+	}
+
+	l1 = f64.Clamp(l1, 1, maxFootprint*maxFootprint)
+	l2 = f64.Clamp(l2, 1, maxFootprint*maxFootprint)
+	return l1*e.X*e.X + l2*e.Y*e.Y,
+		(l1 - l2) * e.X * e.Y,
+		l1*e.Y*e.Y + l2*e.X*e.X
+}
+
+// Homography computes the perspective transform that maps
+// the four source points to the four destination points,
+// useful for deskewing a quad into a rectangle
+func Homography(src, dst [4]f64.Vec2) (f64.Mat3, error) {
+	var a [8][9]float64
+	for i := 0; i < 4; i++ {
+		s, d := src[i], dst[i]
+		a[i*2] = [9]float64{s.X, s.Y, 1, 0, 0, 0, -d.X * s.X, -d.X * s.Y, d.X}
+		a[i*2+1] = [9]float64{0, 0, 0, s.X, s.Y, 1, -d.Y * s.X, -d.Y * s.Y, d.Y}
+	}
+
+	// gaussian elimination with partial pivoting
+	for i := 0; i < 8; i++ {
+		p := i
+		for j := i + 1; j < 8; j++ {
+			if math.Abs(a[j][i]) > math.Abs(a[p][i]) {
+				p = j
+			}
+		}
+		if math.Abs(a[p][i]) < 1e-12 {
+			return f64.Mat3{}, errors.New("resampler: degenerate homography")
+		}
+		a[i], a[p] = a[p], a[i]
+
+		for j := i + 1; j < 8; j++ {
+			k := a[j][i] / a[i][i]
+			for l := i; l < 9; l++ {
+				a[j][l] -= k * a[i][l]
+			}
+		}
+	}
+
+	var h [8]float64
+	for i := 7; i >= 0; i-- {
+		v := a[i][8]
+		for j := i + 1; j < 8; j++ {
+			v -= a[i][j] * h[j]
+		}
+		h[i] = v / a[i][i]
+	}
+
+	return f64.Mat3{
+		{h[0], h[1], h[2]},
+		{h[3], h[4], h[5]},
+		{h[6], h[7], 1},
+	}, nil
+}
+
+// PolarUnwrapMap maps a destination image of the given size
+// to a polar view of the source around center, the x axis is
+// the angle going around once and the y axis is the radius
+func PolarUnwrapMap(center f64.Vec2, radius float64, size image.Point) InverseMap {
+	return func(p f64.Vec2) (f64.Vec2, bool) {
+		t := p.X / float64(size.X) * 2 * math.Pi
+		r := p.Y / float64(size.Y) * radius
+		return f64.Vec2{center.X + r*math.Cos(t), center.Y + r*math.Sin(t)}, true
+	}
+}
+
+// PolarWrapMap is the inverse of PolarUnwrapMap, the source
+// is a unwrapped polar image of the given size that gets
+// wrapped around center in the destination
+func PolarWrapMap(center f64.Vec2, radius float64, size image.Point) InverseMap {
+	return func(p f64.Vec2) (f64.Vec2, bool) {
+		d := p.Sub(center)
+		r := d.Len()
+		if r > radius {
+			return f64.Vec2{}, false
+		}
+		t := math.Atan2(d.Y, d.X)
+		if t < 0 {
+			t += 2 * math.Pi
+		}
+		return f64.Vec2{t / (2 * math.Pi) * float64(size.X), r / radius * float64(size.Y)}, true
+	}
+}
+
+// Lens describes the distortion of a camera lens using the
+// Brown-Conrady model, K are the radial coefficients and P
+// are the tangential coefficients
+type Lens struct {
+	Center f64.Vec2
+	Focal  f64.Vec2
+	K      [3]float64
+	P      [2]float64
+}
+
+// UndistortMap maps the undistorted destination image
+// to the distorted source image taken with the lens
+func (l *Lens) UndistortMap() InverseMap {
+	c := *l
+	return func(p f64.Vec2) (f64.Vec2, bool) {
+		x := (p.X - c.Center.X) / c.Focal.X
+		y := (p.Y - c.Center.Y) / c.Focal.Y
+		r2 := x*x + y*y
+		k := 1 + r2*(c.K[0]+r2*(c.K[1]+r2*c.K[2]))
+		dx := x*k + 2*c.P[0]*x*y + c.P[1]*(r2+2*x*x)
+		dy := y*k + c.P[0]*(r2+2*y*y) + 2*c.P[1]*x*y
+		return f64.Vec2{c.Center.X + dx*c.Focal.X, c.Center.Y + dy*c.Focal.Y}, true
+	}
+}
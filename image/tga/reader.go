@@ -218,3 +218,11 @@ func decode24(_ *decoder, p []byte) color.RGBA {
 func decode32(_ *decoder, p []byte) color.RGBA {
 	return color.RGBA{p[2], p[1], p[0], p[3]}
 }
+
+func init() {
+	// tga has no signature, so match on the color map
+	// and image type fields of the supported formats
+	for _, t := range []string{"\x02", "\x03", "\x0a", "\x0b"} {
+		image.RegisterFormat("tga", "?\x00"+t, Decode, DecodeConfig)
+	}
+}
@@ -0,0 +1,160 @@
+// http://iquilezles.org/www/articles/smin/smin.htm
+// http://iquilezles.org/www/articles/normalsSDF/normalsSDF.htm
+
+package sdf
+
+import (
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+// SmoothMin blends the minimum of two distances over a
+// width of k, it is the plain minimum when k is zero
+func SmoothMin(a, b, k float64) float64 {
+	if k <= 0 {
+		return math.Min(a, b)
+	}
+	h := f64.Clamp(0.5+0.5*(b-a)/k, 0, 1)
+	return f64.Lerp(h, b, a) - k*h*(1-h)
+}
+
+func SmoothMax(a, b, k float64) float64 {
+	return -SmoothMin(-a, -b, k)
+}
+
+func SmoothUnion(d1, d2, k float64) float64 {
+	return SmoothMin(d1, d2, k)
+}
+
+// SmoothSubtract removes d2 from d1 like Subtract
+func SmoothSubtract(d1, d2, k float64) float64 {
+	return SmoothMax(d1, -d2, k)
+}
+
+func SmoothIntersect(d1, d2, k float64) float64 {
+	return SmoothMax(d1, d2, k)
+}
+
+// Round grows a shape by r rounding its corners
+func Round(d, r float64) float64 {
+	return d - r
+}
+
+// the domain operators move the point a shape is evaluated at,
+// the distance of the shape at the returned point is the distance
+// of the changed shape, those that bend space give a bound that
+// can overestimate and should be marched with smaller steps
+
+// Repeat repeats space every c with the cell around the
+// origin centered on it, a zero period does not repeat
+func Repeat(p, c f64.Vec3) f64.Vec3 {
+	return f64.Vec3{repeat(p.X, c.X), repeat(p.Y, c.Y), repeat(p.Z, c.Z)}
+}
+
+func Repeat2(p, c f64.Vec2) f64.Vec2 {
+	return f64.Vec2{repeat(p.X, c.X), repeat(p.Y, c.Y)}
+}
+
+// RepeatLimited repeats space every c only l
+// times on each side of the origin
+func RepeatLimited(p, c, l f64.Vec3) f64.Vec3 {
+	return f64.Vec3{
+		repeatLimited(p.X, c.X, l.X),
+		repeatLimited(p.Y, c.Y, l.Y),
+		repeatLimited(p.Z, c.Z, l.Z),
+	}
+}
+
+func RepeatLimited2(p, c, l f64.Vec2) f64.Vec2 {
+	return f64.Vec2{repeatLimited(p.X, c.X, l.X), repeatLimited(p.Y, c.Y, l.Y)}
+}
+
+func repeat(x, c float64) float64 {
+	if c == 0 {
+		return x
+	}
+	return mod(x+0.5*c, c) - 0.5*c
+}
+
+func repeatLimited(x, c, l float64) float64 {
+	if c == 0 {
+		return x
+	}
+	return x - c*f64.Clamp(math.Round(x/c), -l, l)
+}
+
+// Mirror reflects the side of the plane through the origin
+// with normal n behind it onto the side in front of it
+func Mirror(p, n f64.Vec3) f64.Vec3 {
+	return p.Sub(n.Scale(2 * math.Min(p.Dot(n), 0)))
+}
+
+func Mirror2(p, n f64.Vec2) f64.Vec2 {
+	return p.Sub(n.Scale(2 * math.Min(p.Dot(n), 0)))
+}
+
+// Twist rotates the xz plane by k radians per unit of y
+func Twist(p f64.Vec3, k float64) f64.Vec3 {
+	s, c := math.Sincos(k * p.Y)
+	return f64.Vec3{c*p.X - s*p.Z, p.Y, s*p.X + c*p.Z}
+}
+
+// Bend rotates the xy plane by k radians per unit of x
+func Bend(p f64.Vec3, k float64) f64.Vec3 {
+	q := Bend2(p.XY(), k)
+	return f64.Vec3{q.X, q.Y, p.Z}
+}
+
+func Bend2(p f64.Vec2, k float64) f64.Vec2 {
+	s, c := math.Sincos(k * p.X)
+	return f64.Vec2{c*p.X + s*p.Y, c*p.Y - s*p.X}
+}
+
+// Elongate stretches a shape by h on each side of the origin
+// along every axis, the distance is exact outside of the shape
+func Elongate(p, h f64.Vec3) f64.Vec3 {
+	return p.Sub(p.Clamp3(h.Neg(), h))
+}
+
+func Elongate2(p, h f64.Vec2) f64.Vec2 {
+	return p.Sub(p.Clamp2(h.Neg(), h))
+}
+
+// Gradient estimates the gradient of a distance function with
+// central differences of step eps, the length is close to one
+// where the function is a true distance
+func Gradient(f func(f64.Vec3) float64, p f64.Vec3, eps float64) f64.Vec3 {
+	dx := f64.Vec3{eps, 0, 0}
+	dy := f64.Vec3{0, eps, 0}
+	dz := f64.Vec3{0, 0, eps}
+	return f64.Vec3{
+		f(p.Add(dx)) - f(p.Sub(dx)),
+		f(p.Add(dy)) - f(p.Sub(dy)),
+		f(p.Add(dz)) - f(p.Sub(dz)),
+	}.Scale(1 / (2 * eps))
+}
+
+func Gradient2(f func(f64.Vec2) float64, p f64.Vec2, eps float64) f64.Vec2 {
+	dx := f64.Vec2{eps, 0}
+	dy := f64.Vec2{0, eps}
+	return f64.Vec2{
+		f(p.Add(dx)) - f(p.Sub(dx)),
+		f(p.Add(dy)) - f(p.Sub(dy)),
+	}.Scale(1 / (2 * eps))
+}
+
+// Normal is the direction of the gradient, it samples the
+// corners of a tetrahedron so it takes four evaluations
+// instead of the six of central differences
+func Normal(f func(f64.Vec3) float64, p f64.Vec3, eps float64) f64.Vec3 {
+	var n f64.Vec3
+	for _, k := range [4]f64.Vec3{{1, -1, -1}, {-1, -1, 1}, {-1, 1, -1}, {1, 1, 1}} {
+		n = n.AddScale(k, f(p.AddScale(k, eps)))
+	}
+	return n.Normalize()
+}
+
+func Normal2(f func(f64.Vec2) float64, p f64.Vec2, eps float64) f64.Vec2 {
+	return Gradient2(f, p, eps).Normalize()
+}
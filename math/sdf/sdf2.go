@@ -0,0 +1,200 @@
+// http://iquilezles.org/www/articles/distfunctions2d/distfunctions2d.htm
+
+package sdf
+
+import (
+	"math"
+
+	"github.com/qeedquan/go-media/math/f64"
+)
+
+func Circle(p f64.Vec2, r float64) float64 {
+	return p.Len() - r
+}
+
+// Box2 is a box centered at the origin with half extents b
+func Box2(p, b f64.Vec2) float64 {
+	d := p.Abs().Sub(b)
+	return math.Min(d.MaxComp(), 0) + d.MaxScalar(0).Len()
+}
+
+// RoundedBox2 is a box with the corners rounded by r,
+// the rounding stays inside of the half extents
+func RoundedBox2(p, b f64.Vec2, r float64) float64 {
+	q := p.Abs().Sub(b).Add(f64.Vec2{r, r})
+	return math.Min(q.MaxComp(), 0) + q.MaxScalar(0).Len() - r
+}
+
+// Segment is the unsigned distance to the line segment from a to b
+func Segment(p, a, b f64.Vec2) float64 {
+	pa := p.Sub(a)
+	ba := b.Sub(a)
+	h := f64.Clamp(pa.Dot(ba)/ba.Dot(ba), 0, 1)
+	if math.IsNaN(h) {
+		h = 0
+	}
+	return pa.Sub(ba.Scale(h)).Len()
+}
+
+// Polygon is a closed polygon that can be concave,
+// the winding of the vertices does not matter
+func Polygon(p f64.Vec2, v []f64.Vec2) float64 {
+	if len(v) == 0 {
+		return math.Inf(1)
+	}
+
+	d := p.Sub(v[0]).LenSquared()
+	s := 1.0
+	for i, j := 0, len(v)-1; i < len(v); j, i = i, i+1 {
+		e := v[j].Sub(v[i])
+		w := p.Sub(v[i])
+		h := f64.Clamp(w.Dot(e)/e.Dot(e), 0, 1)
+		if math.IsNaN(h) {
+			h = 0
+		}
+		b := w.Sub(e.Scale(h))
+		d = math.Min(d, b.Dot(b))
+
+		// count the crossings of a ray going right
+		c1 := p.Y >= v[i].Y
+		c2 := p.Y < v[j].Y
+		c3 := e.X*w.Y > e.Y*w.X
+		if (c1 && c2 && c3) || (!c1 && !c2 && !c3) {
+			s = -s
+		}
+	}
+	return s * math.Sqrt(d)
+}
+
+func Triangle2(p, p0, p1, p2 f64.Vec2) float64 {
+	e0, e1, e2 := p1.Sub(p0), p2.Sub(p1), p0.Sub(p2)
+	v0, v1, v2 := p.Sub(p0), p.Sub(p1), p.Sub(p2)
+	pq0 := v0.Sub(e0.Scale(f64.Clamp(v0.Dot(e0)/e0.Dot(e0), 0, 1)))
+	pq1 := v1.Sub(e1.Scale(f64.Clamp(v1.Dot(e1)/e1.Dot(e1), 0, 1)))
+	pq2 := v2.Sub(e2.Scale(f64.Clamp(v2.Dot(e2)/e2.Dot(e2), 0, 1)))
+
+	// x holds the squared distance to an edge, y which side of it p is
+	s := f64.Sign(e0.X*e2.Y - e0.Y*e2.X)
+	d := f64.Vec2{pq0.Dot(pq0), s * (v0.X*e0.Y - v0.Y*e0.X)}
+	d = d.Min(f64.Vec2{pq1.Dot(pq1), s * (v1.X*e1.Y - v1.Y*e1.X)})
+	d = d.Min(f64.Vec2{pq2.Dot(pq2), s * (v2.X*e2.Y - v2.Y*e2.X)})
+	return -math.Sqrt(d.X) * f64.Sign(d.Y)
+}
+
+// Star is a star with n points reaching out to r, m in
+// [2, n] sets how sharp they are with 2 the sharpest
+func Star(p f64.Vec2, r float64, n int, m float64) float64 {
+	an := math.Pi / float64(n)
+	en := math.Pi / m
+	acs := f64.Vec2{math.Cos(an), math.Sin(an)}
+	ecs := f64.Vec2{math.Cos(en), math.Sin(en)}
+
+	// fold into the sector of one point
+	bn := mod(math.Atan2(p.X, p.Y), 2*an) - an
+	p = f64.Vec2{math.Cos(bn), math.Abs(math.Sin(bn))}.Scale(p.Len())
+	p = p.Sub(acs.Scale(r))
+	p = p.Add(ecs.Scale(f64.Clamp(-p.Dot(ecs), 0, r*acs.Y/ecs.Y)))
+	return p.Len() * f64.Sign(p.X)
+}
+
+// Arc is a circular arc of radius ra and thickness rb symmetric
+// around the y axis, the aperture is the half angle it spans
+func Arc(p f64.Vec2, aperture, ra, rb float64) float64 {
+	sc := f64.Vec2{math.Sin(aperture), math.Cos(aperture)}
+	p.X = math.Abs(p.X)
+	if sc.Y*p.X > sc.X*p.Y {
+		return p.Sub(sc.Scale(ra)).Len() - rb
+	}
+	return math.Abs(p.Len()-ra) - rb
+}
+
+// Bezier is the unsigned distance to the quadratic bezier curve
+// from a to c with control point b, it solves the cubic for the
+// closest point on the curve
+func Bezier(p, a, b, c f64.Vec2) float64 {
+	A := b.Sub(a)
+	B := a.Sub(b.Scale(2)).Add(c)
+	C := A.Scale(2)
+	D := a.Sub(p)
+
+	// a straight curve makes the cubic degenerate
+	bb := B.Dot(B)
+	if bb < 1e-12 {
+		return Segment(p, a, c)
+	}
+
+	kk := 1 / bb
+	kx := kk * A.Dot(B)
+	ky := kk * (2*A.Dot(A) + D.Dot(B)) / 3
+	kz := kk * D.Dot(A)
+
+	at := func(t float64) float64 {
+		return D.Add(C.Add(B.Scale(t)).Scale(t)).LenSquared()
+	}
+
+	pp := ky - kx*kx
+	p3 := pp * pp * pp
+	q := kx*(2*kx*kx-3*ky) + kz
+	h := q*q + 4*p3
+	if h >= 0 {
+		h = math.Sqrt(h)
+		u := math.Cbrt((h - q) / 2)
+		v := math.Cbrt((-h - q) / 2)
+		return math.Sqrt(at(f64.Clamp(u+v-kx, 0, 1)))
+	}
+
+	// three real roots, the third one is never the closest
+	z := math.Sqrt(-pp)
+	v := math.Acos(q/(pp*z*2)) / 3
+	m := math.Cos(v)
+	n := math.Sin(v) * math.Sqrt(3)
+	t0 := f64.Clamp((m+m)*z-kx, 0, 1)
+	t1 := f64.Clamp((-n-m)*z-kx, 0, 1)
+	return math.Sqrt(math.Min(at(t0), at(t1)))
+}
+
+// CircleGrad returns the distance to a circle and its gradient
+func CircleGrad(p f64.Vec2, r float64) (float64, f64.Vec2) {
+	l := p.Len()
+	if l == 0 {
+		return -r, f64.Vec2{}
+	}
+	return l - r, p.Scale(1 / l)
+}
+
+// Box2Grad returns the distance to a box and its gradient
+func Box2Grad(p, b f64.Vec2) (float64, f64.Vec2) {
+	w := p.Abs().Sub(b)
+	s := f64.Vec2{f64.SignStrict(p.X), f64.SignStrict(p.Y)}
+	g := w.MaxComp()
+	if g > 0 {
+		q := w.MaxScalar(0)
+		l := q.Len()
+		return l, s.Scale2(q.Scale(1 / l))
+	}
+	if w.X > w.Y {
+		return g, f64.Vec2{s.X, 0}
+	}
+	return g, f64.Vec2{0, s.Y}
+}
+
+// SegmentGrad returns the distance to a segment and its gradient
+func SegmentGrad(p, a, b f64.Vec2) (float64, f64.Vec2) {
+	pa := p.Sub(a)
+	ba := b.Sub(a)
+	h := f64.Clamp(pa.Dot(ba)/ba.Dot(ba), 0, 1)
+	if math.IsNaN(h) {
+		h = 0
+	}
+	q := pa.Sub(ba.Scale(h))
+	l := q.Len()
+	if l == 0 {
+		return 0, f64.Vec2{}
+	}
+	return l, q.Scale(1 / l)
+}
+
+// mod is the modulo of glsl that has the sign of y
+func mod(x, y float64) float64 {
+	return x - y*math.Floor(x/y)
+}